@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dsymonds/glowbaby/glow"
+)
+
+// defaultConfigPath returns the default location of the config file,
+// or the empty string if there's no sensible place for it.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "glowbaby", "config.json")
+}
+
+// envName returns the name of the environment variable corresponding to a flag.
+func envName(flagName string) string {
+	return "GLOWBABY_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyConfig fills in flags in fs that weren't set on the command line,
+// first from environment variables and then from the config file
+// named by fs's -config flag. It must be called after fs.Parse.
+//
+// The config file is a JSON object whose keys are flag names, such as
+//
+//	{"db": "/home/me/baby.db", "palette": "cb-safe"}
+//
+// It may also have a "colors" object setting plot colours (see glow.ColorElements), as in
+//
+//	{"colors": {"background": "#fdf6e3", "long": "#268bd2"}}
+//
+// It is optional, unless -config is given explicitly.
+func applyConfig(fs *flag.FlagSet) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	path := fs.Lookup("config").Value.String()
+	cfg := make(map[string]interface{})
+	raw, readErr := ioutil.ReadFile(path)
+	if os.IsNotExist(readErr) && !explicit["config"] {
+		// No config file; that's fine.
+	} else if readErr != nil {
+		return fmt.Errorf("loading config from %s: %w", path, readErr)
+	} else {
+		// Keep numbers as written so they parse the same way as flags would.
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&cfg); err != nil {
+			return fmt.Errorf("parsing config from %s: %w", path, err)
+		}
+	}
+	// Plot colours aren't a flag, so are set directly.
+	if section, ok := cfg["colors"]; ok {
+		colors, err := glow.ParseColors(section)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		customColors = colors
+		delete(cfg, "colors")
+	}
+	for name := range cfg {
+		if fs.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("config file %s has unknown key %q", path, name)
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || explicit[f.Name] || f.Name == "config" {
+			return
+		}
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			if err = f.Value.Set(v); err != nil {
+				err = fmt.Errorf("bad value %q for $%s: %w", v, envName(f.Name), err)
+			}
+			return
+		}
+		if v, ok := cfg[f.Name]; ok {
+			if err = f.Value.Set(fmt.Sprint(v)); err != nil {
+				err = fmt.Errorf("bad value %v for %q in config file %s: %w", v, f.Name, path, err)
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFlagSet(configPath string) (*flag.FlagSet, *string, *string, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", configPath, "")
+	db := fs.String("db", "baby.db", "")
+	theme := fs.String("theme", "light", "")
+	palette := fs.String("palette", "default", "")
+	return fs, db, theme, palette
+}
+
+func TestApplyConfigAbsentFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	fs, db, _, _ := newTestFlagSet(path)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs); err != nil {
+		t.Fatalf("applyConfig with absent default config file: %v", err)
+	}
+	if *db != "baby.db" {
+		t.Errorf("-db = %q, want built-in default", *db)
+	}
+
+	// An explicitly named config file must exist, though.
+	fs, _, _, _ = newTestFlagSet("")
+	if err := fs.Parse([]string{"-config", path}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs); err == nil {
+		t.Errorf("applyConfig with absent explicit config file succeeded, want error")
+	}
+}
+
+func TestApplyConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{"db": "config.db", "theme": "dark", "palette": "cb-safe"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GLOWBABY_DB", "env.db")
+	t.Setenv("GLOWBABY_THEME", "env-theme")
+
+	fs, db, theme, palette := newTestFlagSet(path)
+	if err := fs.Parse([]string{"-db", "flag.db"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs); err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+	if *db != "flag.db" {
+		t.Errorf("-db = %q, want the command-line value", *db)
+	}
+	if *theme != "env-theme" {
+		t.Errorf("-theme = %q, want the environment value", *theme)
+	}
+	if *palette != "cb-safe" {
+		t.Errorf("-palette = %q, want the config file value", *palette)
+	}
+}
+
+func TestApplyConfigUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"foo": 1}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, _, _, _ := newTestFlagSet(path)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs); err == nil {
+		t.Errorf("applyConfig with unknown key succeeded, want error")
+	}
+}
+
+func TestConfigColors(t *testing.T) {
+	defer func(cc map[string]color.NRGBA) { customColors = cc }(customColors)
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{"db": "config.db", "colors": {"long": "#112233", "grid": "#44556680"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, db, _, _ := newTestFlagSet(path)
+	if err := fs.Parse(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfig(fs); err != nil {
+		t.Fatalf("applyConfig: %v", err)
+	}
+	if *db != "config.db" {
+		t.Errorf("-db = %q, want the config file value", *db)
+	}
+	if want := (color.NRGBA{0x11, 0x22, 0x33, 0xff}); customColors["long"] != want {
+		t.Errorf("long colour = %v, want %v from the config file", customColors["long"], want)
+	}
+	if want := (color.NRGBA{0x44, 0x55, 0x66, 0x80}); customColors["grid"] != want {
+		t.Errorf("grid colour = %v, want %v from the config file", customColors["grid"], want)
+	}
+
+	for _, bad := range []string{
+		`{"colors": "blue"}`,
+		`{"colors": {"sky": "#0000ff"}}`,
+		`{"colors": {"long": "blue"}}`,
+		`{"colors": {"long": 255}}`,
+	} {
+		if err := ioutil.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, _, _, _ := newTestFlagSet(path)
+		if err := fs.Parse(nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyConfig(fs); err == nil {
+			t.Errorf("applyConfig with %s succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package glow
+
+import "time"
+
+// The age helpers below work with calendar dates in the birthday's time zone,
+// so that, for instance, a baby born on the 31st of January turns one month old
+// on the last day of February, and every day is a day even when it is 23 or 25
+// hours long. Times before the birthday give negative ages, rounded down.
+
+// ageDays returns the number of calendar days from birthday to t.
+func ageDays(birthday, t time.Time) int {
+	t = t.In(birthday.Location())
+	if t.Before(birthday) {
+		return -dayDiff(t, birthday)
+	}
+	return dayDiff(birthday, t)
+}
+
+// ageWeeks returns the number of whole weeks from birthday to t.
+func ageWeeks(birthday, t time.Time) int {
+	days := ageDays(birthday, t)
+	weeks := days / 7
+	if days < 0 && days%7 != 0 {
+		weeks-- // round down, not towards zero
+	}
+	return weeks
+}
+
+// ageMonths returns the number of whole calendar months from birthday to t.
+func ageMonths(birthday, t time.Time) int {
+	t = t.In(birthday.Location())
+	bY, bM, _ := birthday.Date()
+	tY, tM, tD := t.Date()
+	months := 12*(tY-bY) + int(tM-bM)
+	// Not a whole month yet if t is before this month's anniversary.
+	if _, _, aD := addMonths(birthday, months).Date(); tD < aD {
+		months--
+	}
+	return months
+}
+
+// addMonths returns the date n calendar months after t, at the same time of day.
+// Where that month is too short for t's day, it is the month's last day,
+// rather than overflowing into the next month as time.AddDate does.
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
@@ -0,0 +1,68 @@
+package glow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAge(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	at := func(y int, mon time.Month, day, hour int) time.Time {
+		return time.Date(y, mon, day, hour, 0, 0, 0, loc)
+	}
+	tests := []struct {
+		desc                string
+		birthday, t         time.Time
+		days, weeks, months int
+	}{
+		{"birth", at(2024, time.January, 31, 15), at(2024, time.January, 31, 20), 0, 0, 0},
+		{"end of birth day", at(2024, time.January, 31, 15), at(2024, time.January, 31, 23), 0, 0, 0},
+		{"short month, not yet", at(2024, time.January, 31, 15), at(2024, time.February, 28, 12), 28, 4, 0},
+		{"short month anniversary", at(2024, time.January, 31, 15), at(2024, time.February, 29, 1), 29, 4, 1},
+		{"after short month", at(2024, time.January, 31, 15), at(2024, time.March, 30, 12), 59, 8, 1},
+		{"long month anniversary", at(2024, time.January, 31, 15), at(2024, time.March, 31, 1), 60, 8, 2},
+		{"mid month", at(2024, time.March, 15, 9), at(2024, time.May, 14, 9), 60, 8, 1},
+		{"across DST end", at(2024, time.April, 1, 12), at(2024, time.April, 8, 0), 7, 1, 0},
+		{"across a year", at(2024, time.November, 20, 3), at(2025, time.February, 20, 3), 92, 13, 3},
+		{"first birthday", at(2024, time.February, 29, 3), at(2025, time.February, 28, 3), 365, 52, 12},
+		{"before birth", at(2024, time.March, 15, 9), at(2024, time.March, 14, 23), -1, -1, -1},
+		{"weeks before birth", at(2024, time.March, 15, 9), at(2024, time.March, 1, 9), -14, -2, -1},
+		{"other time zone", at(2024, time.March, 15, 9), time.Date(2024, time.March, 14, 14, 0, 0, 0, time.UTC), 0, 0, 0},
+	}
+	for _, test := range tests {
+		if got := ageDays(test.birthday, test.t); got != test.days {
+			t.Errorf("%s: ageDays(%v, %v) = %d, want %d", test.desc, test.birthday, test.t, got, test.days)
+		}
+		if got := ageWeeks(test.birthday, test.t); got != test.weeks {
+			t.Errorf("%s: ageWeeks(%v, %v) = %d, want %d", test.desc, test.birthday, test.t, got, test.weeks)
+		}
+		if got := ageMonths(test.birthday, test.t); got != test.months {
+			t.Errorf("%s: ageMonths(%v, %v) = %d, want %d", test.desc, test.birthday, test.t, got, test.months)
+		}
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		start string
+		n     int
+		want  string
+	}{
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2023-01-31", 1, "2023-02-28"},
+		{"2024-01-31", 2, "2024-03-31"},
+		{"2024-08-31", 4, "2024-12-31"},
+		{"2024-10-31", 4, "2025-02-28"},
+		{"2024-03-31", -1, "2024-02-29"},
+		{"2024-01-15", 12, "2025-01-15"},
+	}
+	for _, test := range tests {
+		start, _ := time.ParseInLocation("2006-01-02", test.start, time.Local)
+		if got := addMonths(start, test.n).Format("2006-01-02"); got != test.want {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", test.start, test.n, got, test.want)
+		}
+	}
+}
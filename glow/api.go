@@ -0,0 +1,200 @@
+package glow
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// LoginResponse represents the JSON response from an /android/user/sign_in request.
+type LoginResponse struct {
+	Data struct {
+		Babies []struct {
+			Baby struct {
+				BabyID int64 `json:"baby_id"`
+
+				FirstName string `json:"first_name"`
+				LastName  string `json:"last_name"`
+				Birthday  string `json:"birthday"` // "YYYY/MM/DD" format
+			} `json:"Baby"`
+		} `json:"babies"`
+
+		User struct {
+			AuthToken string `json:"encrypted_token"`
+			FirstName string `json:"first_name"`
+			LastName  string `json:"last_name"`
+		} `json:"user"`
+	} `json:"data"`
+}
+
+// PullResponse represents the JSON response from an /android/user/pull fetch.
+// Keys noted below as "Other keys" are also listed in knownPullKeys,
+// so that -report-unknown only reports new ones.
+type PullResponse struct {
+	Data struct {
+		Babies []PullBaby `json:"babies"`
+
+		// These are nil if the response didn't include them.
+		Insights         *[]Insight `json:"insights"`
+		SyncableInsights *[]Insight `json:"syncable_insights"`
+
+		// Other keys: "user"
+	} `json:"data"`
+
+	// Other keys: "rc" (response code? 0 on success)
+}
+
+// PullBaby is the data for one baby in a PullResponse.
+type PullBaby struct {
+	BabyID    int64  `json:"baby_id"`
+	SyncTime  int64  `json:"sync_time"`
+	SyncToken string `json:"sync_token"`
+
+	BabyData struct {
+		Remove []BabyData `json:"remove"`
+		Update []BabyData `json:"update"`
+	} `json:"BabyData"`
+
+	BabyFeedData struct {
+		Remove []BabyFeedData `json:"remove"`
+		Update []BabyFeedData `json:"update"`
+	} `json:"BabyFeedData"`
+
+	BabyFamily       FamilyData `json:"BabyFamily"`       // parent info
+	UserBabyRelation FamilyData `json:"UserBabyRelation"` // how each user relates to the baby
+
+	// Other keys:
+	//   "Baby" (static info about baby)
+	//   "BabyMilestone"
+	//   "MilestonePhoto"
+	//   "Photo"
+}
+
+// Insight is one of Glow's computed observations about a baby,
+// such as "longest sleep this week".
+// Only the fields that seem generally present are decoded.
+type Insight struct {
+	ID         int64  `json:"id"`
+	BabyID     int64  `json:"baby_id"`
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	CreateTime int64  `json:"create_time"` // unix epoch
+}
+
+// FamilyData is the BabyFamily or UserBabyRelation part of a PullBaby.
+// Neither has been seen in real data yet, so as well as remove and update
+// lists like BabyData's, this accepts a plain list, taken as all updates.
+// Use -report-unknown or -save-raw to check what the server actually sends.
+type FamilyData struct {
+	Remove []FamilyMember `json:"remove"`
+	Update []FamilyMember `json:"update"`
+}
+
+func (fd *FamilyData) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		*fd = FamilyData{}
+		return json.Unmarshal(data, &fd.Update)
+	}
+	type plain FamilyData // without this method
+	return json.Unmarshal(data, (*plain)(fd))
+}
+
+// FamilyMember is a user related to a baby. BabyFamily records are expected
+// to have their name, and UserBabyRelation records the relation.
+// These field names are guesses.
+type FamilyMember struct {
+	UserID    int64  `json:"user_id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Relation  string `json:"relation"` // e.g. "Mother"
+}
+
+type BabyData struct {
+	ID     int64 `json:"id"`
+	BabyID int64 `json:"baby_id"`
+
+	StartTimestamp int64  `json:"start_timestamp"`
+	EndTimestamp   *int64 `json:"end_timestamp"`
+
+	Key string `json:"key"` // e.g. "medicine", "sleep", "tummy"
+
+	// For key=diaper, val_int may have these values:
+	//	65536
+	//	66625
+	//	1089
+	//	1041
+	//	17
+	ValInt int64 `json:"val_int"`
+
+	// Used for key=temperature (ºC), or key=weight (kg), or key=height (cm)
+	ValFloat float32 `json:"val_float"`
+
+	// Used for key=medicine
+	ValStr string `json:"val_str"`
+
+	UUID string `json:"uuid"` // stable across devices
+}
+
+type BabyFeedData struct {
+	ID     int64 `json:"id"`
+	BabyID int64 `json:"baby_id"`
+
+	StartTimestamp int64 `json:"start_timestamp"`
+	// Not seen in real data yet, but the other tables have it,
+	// and it may be there for bottle feeds.
+	EndTimestamp *int64 `json:"end_timestamp"`
+
+	FeedType int64 `json:"feed_type"` // see DecodeFeedType
+
+	BreastUsed  string `json:"breast_used"`       // e.g. "R"
+	BreastLeft  int64  `json:"breast_left_time"`  // seconds
+	BreastRight int64  `json:"breast_right_time"` // seconds
+
+	BottleML float64 `json:"bottle_ml"`
+
+	// For pumping sessions. These field names haven't been seen in real data yet;
+	// use -save-raw to check what the server actually sends.
+	PumpLeftML  float64 `json:"pump_left_ml"`
+	PumpRightML float64 `json:"pump_right_ml"`
+
+	UUID string `json:"uuid"` // stable across devices
+}
+
+// FeedType is the kind of a feed, as recorded in BabyFeedData.FeedType.
+type FeedType int64
+
+// Known feed types.
+// Breast feeds (1) are the only ones seen in real data so far;
+// they have per-breast times and no bottle volume.
+// The others are inferred from the app's feed options and may be wrong.
+const (
+	FeedUnknown FeedType = 0
+	FeedBreast  FeedType = 1
+	FeedBottle  FeedType = 2 // bottle_ml set, no breast times
+	FeedSolids  FeedType = 3
+	FeedPump    FeedType = 4 // pumping, not a feed; pump_*_ml set
+)
+
+// DecodeFeedType maps a raw feed_type value to a FeedType,
+// returning FeedUnknown for unrecognised values.
+func DecodeFeedType(v int64) FeedType {
+	switch ft := FeedType(v); ft {
+	case FeedBreast, FeedBottle, FeedSolids, FeedPump:
+		return ft
+	}
+	return FeedUnknown
+}
+
+func (ft FeedType) String() string {
+	switch ft {
+	case FeedBreast:
+		return "breast"
+	case FeedBottle:
+		return "bottle"
+	case FeedSolids:
+		return "solids"
+	case FeedPump:
+		return "pump"
+	}
+	return "unknown"
+}
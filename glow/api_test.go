@@ -0,0 +1,27 @@
+package glow
+
+import "testing"
+
+func TestDecodeFeedType(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want FeedType
+		str  string
+	}{
+		{0, FeedUnknown, "unknown"},
+		{1, FeedBreast, "breast"},
+		{2, FeedBottle, "bottle"},
+		{3, FeedSolids, "solids"},
+		{4, FeedPump, "pump"},
+		{42, FeedUnknown, "unknown"},
+	}
+	for _, test := range tests {
+		got := DecodeFeedType(test.in)
+		if got != test.want {
+			t.Errorf("DecodeFeedType(%d) = %d, want %d", test.in, got, test.want)
+		}
+		if got.String() != test.str {
+			t.Errorf("DecodeFeedType(%d).String() = %q, want %q", test.in, got.String(), test.str)
+		}
+	}
+}
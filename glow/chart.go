@@ -0,0 +1,626 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linePlot is a simple line chart with linear axes.
+type linePlot struct {
+	opts           PlotOptions
+	title          string
+	xLabel, yLabel string
+	series         []lineSeries
+	smoothed       bool // series are already averaged over opts.Smooth days, so Render shouldn't add one
+}
+
+type lineSeries struct {
+	label  string
+	col    color.NRGBA
+	points []linePoint // in increasing x order
+}
+
+type linePoint struct {
+	x, y float64
+}
+
+// Default colours for charts; see ColorElements.
+var (
+	lineColor   = color.NRGBA{0, 0, 255, 255}   // blue
+	smoothColor = color.NRGBA{230, 159, 0, 255} // orange
+)
+
+// dailyPoints turns per-day values, keyed by days since birth,
+// into points with an x coordinate of age in weeks.
+func dailyPoints(byDay map[int]float64) []linePoint {
+	days := make([]int, 0, len(byDay))
+	for d := range byDay {
+		days = append(days, d)
+	}
+	sort.Ints(days)
+	pts := make([]linePoint, len(days))
+	for i, d := range days {
+		pts[i] = linePoint{float64(d) / 7, byDay[d]}
+	}
+	return pts
+}
+
+func plotLongestSleep(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for longest sleep plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	segs, err := loadSegments(ctx, db, opts.Selection, info.babyID, "sleep")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d sleep ranges", len(segs))
+
+	// Attribute each segment to the day it starts on.
+	longest := make(map[int]float64) // hours, keyed by days since birth
+	for _, seg := range segs {
+		start := time.Unix(seg[0], 0).In(plotLocation)
+		if start.Before(opts.DayStart.dayStart(info.birthday)) {
+			continue
+		}
+		day := opts.DayStart.dayNumber(info.birthday, start)
+		if hours := float64(seg[1]-seg[0]) / 3600; hours > longest[day] {
+			longest[day] = hours
+		}
+	}
+	if len(longest) == 0 {
+		return nil, fmt.Errorf("no sleep recorded")
+	}
+
+	lp := linePlot{
+		opts:   opts,
+		title:  fmt.Sprintf("Longest sleep per day for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "age (weeks)",
+		yLabel: "hours",
+		series: []lineSeries{{label: "longest sleep", col: opts.elementColor("line", lineColor), points: dailyPoints(longest)}},
+	}
+	return lp.Render()
+}
+
+func plotWakeWindows(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for wake window plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	segs, err := loadSegments(ctx, db, opts.Selection, info.babyID, "sleep")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d sleep ranges", len(segs))
+
+	// Average the wake windows starting on each day.
+	total := make(map[int]float64) // hours, keyed by days since birth
+	count := make(map[int]int)
+	for _, ww := range opts.DayStart.wakeWindows(segs) {
+		start := time.Unix(ww.start, 0).In(plotLocation)
+		if start.Before(opts.DayStart.dayStart(info.birthday)) {
+			continue
+		}
+		day := opts.DayStart.dayNumber(info.birthday, start)
+		total[day] += ww.dur.Hours()
+		count[day]++
+	}
+	if len(total) == 0 {
+		return nil, fmt.Errorf("no wake windows found")
+	}
+	for day := range total {
+		total[day] /= float64(count[day])
+	}
+
+	lp := linePlot{
+		opts:   opts,
+		title:  fmt.Sprintf("Average wake window per day for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "age (weeks)",
+		yLabel: "hours",
+		series: []lineSeries{{label: "average wake window", col: opts.elementColor("line", lineColor), points: dailyPoints(total)}},
+	}
+	return lp.Render()
+}
+
+// mlPerFluidOunce is the size of a US fluid ounce, which is what formula is measured in.
+const mlPerFluidOunce = 29.5735
+
+func plotBottleVolume(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	unit, perML := "ml", 1.0
+	switch opts.Units {
+	default:
+		return nil, fmt.Errorf("unknown -units %q", opts.Units)
+	case "metric":
+	case "imperial":
+		unit, perML = "fl oz", 1/mlPerFluidOunce
+	}
+
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for bottle volume plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+
+	total := make(map[int]float64) // in unit, keyed by days since birth
+	n := 0
+	for _, f := range feeds {
+		start := time.Unix(f.start, 0).In(plotLocation)
+		if f.bottleML <= 0 || start.Before(opts.DayStart.dayStart(info.birthday)) {
+			continue
+		}
+		total[opts.DayStart.dayNumber(info.birthday, start)] += f.bottleML * perML
+		n++
+	}
+	log.Printf("Loaded %d bottle feeds", n)
+	if len(total) == 0 {
+		return nil, fmt.Errorf("no bottle feeds recorded")
+	}
+	if opts.ZeroDays {
+		// Fill in days without bottle feeds, between the first and last with them.
+		first, last := math.MaxInt32, 0
+		for day := range total {
+			if day < first {
+				first = day
+			}
+			if day > last {
+				last = day
+			}
+		}
+		for day := first; day <= last; day++ {
+			total[day] += 0
+		}
+	}
+
+	lp := linePlot{
+		opts:   opts,
+		title:  fmt.Sprintf("Bottle volume per day for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "age (weeks)",
+		yLabel: unit,
+		series: []lineSeries{{label: "bottle volume", col: opts.elementColor("line", lineColor), points: dailyPoints(total)}},
+	}
+	return lp.Render()
+}
+
+// loadDailySleep returns the hours a baby slept on each day, keyed by days since birth.
+// Sleeps spanning midnight are split across the days they cover.
+// Days are divided in the time zone of info.birthday (see babyInfo.in).
+func loadDailySleep(ctx context.Context, db *sql.DB, sel Selection, info babyInfo) (map[int]float64, error) {
+	segs, err := loadClippedSegments(ctx, db, sel, info.babyID, "sleep")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d sleep ranges", len(segs))
+
+	// Segments are already clipped to the -from/-to window,
+	// so days at its edges only count sleep within it.
+	total := make(map[int]float64)
+	for _, seg := range segs {
+		loc := info.birthday.Location()
+		start, end := time.Unix(seg[0], 0).In(loc), time.Unix(seg[1], 0).In(loc)
+		if start.Before(sel.DayStart.dayStart(info.birthday)) {
+			continue
+		}
+		sel.DayStart.splitByDay(info.birthday, start, end, func(day int, dur time.Duration) {
+			total[day] += dur.Hours()
+		})
+	}
+	return total, nil
+}
+
+func plotDailySleep(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for daily sleep plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	total, err := loadDailySleep(ctx, db, opts.Selection, info)
+	if err != nil {
+		return nil, err
+	}
+	if len(total) == 0 {
+		return nil, fmt.Errorf("no sleep recorded")
+	}
+
+	lp := linePlot{
+		opts:   opts,
+		title:  fmt.Sprintf("Total sleep per day for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "age (weeks)",
+		yLabel: "hours",
+		series: []lineSeries{{label: "total sleep", col: opts.elementColor("line", lineColor), points: dailyPoints(total)}},
+	}
+	return lp.Render()
+}
+
+// plotSleepOverview charts the total sleep per day of every baby (in the -account account),
+// by age, so that twins or siblings can be compared. It ignores -baby.
+// With -smooth, each baby's line is replaced by its moving average,
+// since overlaying one on each would be too busy.
+func plotSleepOverview(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	infos, err := loadBabies(ctx, db, opts.Account)
+	if err != nil {
+		return nil, err
+	}
+	pal := opts.plotPalette()
+	cols := []color.NRGBA{pal.long, pal.short, pal.medium, opts.elementColor("smooth", smoothColor)}
+	lp := linePlot{
+		opts:     opts,
+		xLabel:   "age (weeks)",
+		yLabel:   "hours",
+		smoothed: opts.Smooth > 1,
+	}
+	var names []string
+	for _, info := range infos {
+		total, err := loadDailySleep(ctx, db, opts.Selection, info)
+		if err != nil {
+			return nil, err
+		}
+		if len(total) == 0 {
+			log.Printf("No sleep recorded for %s %s; leaving them out", info.firstName, info.lastName)
+			continue
+		}
+		ls := lineSeries{
+			label:  info.firstName,
+			col:    cols[len(lp.series)%len(cols)],
+			points: dailyPoints(total),
+		}
+		if n := opts.Smooth; n > 1 {
+			ls.label += fmt.Sprintf(" (%d-day average)", n)
+			ls.points = smooth(ls.points, n)
+		}
+		lp.series = append(lp.series, ls)
+		names = append(names, info.firstName)
+	}
+	if len(lp.series) == 0 {
+		return nil, errors.New("no sleep recorded for any baby")
+	}
+	lp.title = "Total sleep per day for " + names[0]
+	if n := len(names); n > 1 {
+		lp.title = "Total sleep per day for " + strings.Join(names[:n-1], ", ") + " and " + names[n-1]
+	}
+	return lp.Render()
+}
+
+func plotBMI(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info and growth readings.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := babyGrowth(ctx, db, opts.Selection, info, opts.GrowthTolerance)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for BMI plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	var pts []linePoint
+	for _, gr := range rows {
+		bmi, ok := gr.bmi()
+		if !ok || gr.date.Before(info.birthday) {
+			continue
+		}
+		pts = append(pts, linePoint{float64(ageDays(info.birthday, gr.date)) / 7, bmi})
+	}
+	if len(pts) == 0 {
+		return nil, fmt.Errorf("no weight and height recorded within %s of each other", plural(opts.GrowthTolerance, "day"))
+	}
+
+	lp := linePlot{
+		opts:   opts,
+		title:  fmt.Sprintf("BMI for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "age (weeks)",
+		yLabel: "kg/m²",
+		series: []lineSeries{{label: "BMI", col: opts.elementColor("line", lineColor), points: pts}},
+	}
+	return lp.Render()
+}
+
+func (lp *linePlot) Render() ([]byte, error) {
+	// Overlay a moving average of the first series if requested.
+	if n := lp.opts.Smooth; n > 1 && len(lp.series) > 0 && !lp.smoothed {
+		raw := lp.series[0]
+		lp.series = append(lp.series, lineSeries{
+			label:  fmt.Sprintf("%s (%d-day average)", raw.label, n),
+			col:    lp.opts.elementColor("smooth", smoothColor),
+			points: smooth(raw.points, n),
+		})
+	}
+
+	// Only bother with a legend if there's more than one series.
+	var legend []legendEntry
+	if len(lp.series) > 1 {
+		for _, ls := range lp.series {
+			legend = append(legend, legendEntry{ls.col, ls.label})
+		}
+	}
+
+	c := newCanvas(lp.opts)
+	c.header(lp.title, "", legend)
+
+	// Work out the data range. The Y axis always includes zero.
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	var maxY float64
+	for _, ls := range lp.series {
+		for _, pt := range ls.points {
+			minX, maxX = math.Min(minX, pt.x), math.Max(maxX, pt.x)
+			maxY = math.Max(maxY, pt.y)
+		}
+	}
+	if maxX == minX {
+		maxX = minX + 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	maxY *= 1.05 // headroom
+
+	// Lay out the plot area, leaving room for labels.
+	left, right := 5*c.lineHeight, c.width-2*c.lineHeight
+	top, bottom := c.pad+(len(legend)+4)*c.lineHeight, c.height-3*c.lineHeight
+	mapX := func(x float64) int { return left + int(float64(right-left)*(x-minX)/(maxX-minX)) }
+	mapY := func(y float64) int { return bottom - int(float64(bottom-top)*y/maxY) }
+
+	// Axes, ticks and labels.
+	drawLine(c, left, top, left, bottom, c.th.text)
+	drawLine(c, left, bottom, right, bottom, c.th.text)
+	step := niceStep(maxX-minX, 10)
+	for v := math.Ceil(minX/step) * step; v <= maxX; v += step {
+		x := mapX(v)
+		drawLine(c, x, bottom, x, bottom+c.pad, c.th.text)
+		c.text(x-c.lineHeight/3, bottom+c.pad+c.lineHeight, c.th.text, formatTick(v, step))
+	}
+	step = niceStep(maxY, 8)
+	for v := 0.0; v <= maxY; v += step {
+		y := mapY(v)
+		drawLine(c, left-c.pad, y, left, y, c.th.text)
+		c.text(c.pad, y+c.lineHeight/3, c.th.text, formatTick(v, step))
+	}
+	c.text((left+right)/2, c.height-c.pad, c.th.text, lp.xLabel)
+	c.text(c.pad, top-c.lineHeight, c.th.text, lp.yLabel)
+
+	// Plot data.
+	for _, ls := range lp.series {
+		for i := 1; i < len(ls.points); i++ {
+			p0, p1 := ls.points[i-1], ls.points[i]
+			drawDataLine(c, mapX(p0.x), mapY(p0.y), mapX(p1.x), mapY(p1.y), ls.col)
+		}
+	}
+
+	return c.encode()
+}
+
+// smooth returns a centred moving average of daily points (with x in weeks) over n days.
+// Near the ends of the series, and around missing days, the window shrinks to the available data.
+func smooth(pts []linePoint, n int) []linePoint {
+	half := float64(n-1) / 2 / 7 // weeks
+	const eps = 1e-9
+	out := make([]linePoint, len(pts))
+	var lo, hi int // window is pts[lo:hi]
+	var sum float64
+	for i, pt := range pts {
+		for hi < len(pts) && pts[hi].x <= pt.x+half+eps {
+			sum += pts[hi].y
+			hi++
+		}
+		for pts[lo].x < pt.x-half-eps {
+			sum -= pts[lo].y
+			lo++
+		}
+		out[i] = linePoint{pt.x, sum / float64(hi-lo)}
+	}
+	return out
+}
+
+// barPlot is a simple bar chart of counts.
+type barPlot struct {
+	opts           PlotOptions
+	title          string
+	xLabel, yLabel string
+	labels         []string // one per bar
+	counts         []int
+}
+
+func plotFeedIntervals(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for feed interval plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d feeds", len(feeds))
+	if len(feeds) < 2 {
+		return nil, fmt.Errorf("fewer than two feeds recorded")
+	}
+
+	// Bucket the gaps between consecutive feed starts by the hour,
+	// with everything long lumped into the final bucket.
+	const maxHours = 8
+	bp := barPlot{
+		opts:   opts,
+		title:  fmt.Sprintf("Time between feeds for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "interval",
+		yLabel: "feeds",
+		counts: make([]int, maxHours+1),
+	}
+	for h := 0; h < maxHours; h++ {
+		bp.labels = append(bp.labels, fmt.Sprintf("%d-%dh", h, h+1))
+	}
+	bp.labels = append(bp.labels, fmt.Sprintf("%dh+", maxHours))
+	for i := 1; i < len(feeds); i++ {
+		h := int((feeds[i].start - feeds[i-1].start) / 3600)
+		if h > maxHours {
+			h = maxHours
+		}
+		bp.counts[h]++
+	}
+	return bp.Render()
+}
+
+func plotFeedTOD(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for feed time of day plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d feeds", len(feeds))
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("no feeds recorded")
+	}
+
+	// Bucket feeds by the hour they start in,
+	// starting from the hour that days start in.
+	bp := barPlot{
+		opts:   opts,
+		title:  fmt.Sprintf("Feeds by time of day for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02")),
+		xLabel: "hour of day",
+		yLabel: "feeds",
+		counts: make([]int, 24),
+	}
+	first := int(opts.DayStart) / 60
+	for i := 0; i < 24; i++ {
+		bp.labels = append(bp.labels, fmt.Sprintf("%02d", (first+i)%24))
+	}
+	for _, f := range feeds {
+		h := time.Unix(f.start, 0).In(plotLocation).Hour()
+		bp.counts[(h-first+24)%24]++
+	}
+	return bp.Render()
+}
+
+func (bp *barPlot) Render() ([]byte, error) {
+	c := newCanvas(bp.opts)
+	c.header(bp.title, "", nil)
+
+	maxCount := 1
+	for _, n := range bp.counts {
+		if n > maxCount {
+			maxCount = n
+		}
+	}
+	maxY := float64(maxCount) * 1.1 // headroom for count labels
+
+	// Lay out the plot area, leaving room for labels.
+	left, right := 5*c.lineHeight, c.width-2*c.lineHeight
+	top, bottom := c.pad+4*c.lineHeight, c.height-3*c.lineHeight
+	mapY := func(y float64) int { return bottom - int(float64(bottom-top)*y/maxY) }
+	barWidth := (right - left) / len(bp.counts)
+
+	// Axes, ticks and labels.
+	drawLine(c, left, top, left, bottom, c.th.text)
+	drawLine(c, left, bottom, right, bottom, c.th.text)
+	step := math.Max(1, niceStep(maxY, 8))
+	for v := 0.0; v <= maxY; v += step {
+		y := mapY(v)
+		drawLine(c, left-c.pad, y, left, y, c.th.text)
+		c.text(c.pad, y+c.lineHeight/3, c.th.text, formatTick(v, step))
+	}
+	c.text((left+right)/2, c.height-c.pad, c.th.text, bp.xLabel)
+	c.text(c.pad, top-c.lineHeight, c.th.text, bp.yLabel)
+
+	// Plot data, with a small gap between bars.
+	for i, n := range bp.counts {
+		x0 := left + i*barWidth + barWidth/10
+		x1 := left + (i+1)*barWidth - barWidth/10
+		y := mapY(float64(n))
+		draw.Draw(c.img, image.Rect(x0, y, x1, bottom), &image.Uniform{bp.opts.elementColor("bar", lineColor)}, image.ZP, draw.Src)
+		c.text(x0, y-c.pad, c.th.text, strconv.Itoa(n))
+		c.text(x0, bottom+c.pad+c.lineHeight, c.th.text, bp.labels[i])
+	}
+
+	return c.encode()
+}
+
+// drawLine draws a one pixel wide straight line between two points.
+func drawLine(c *canvas, x0, y0, x1, y1 int, col color.Color) {
+	dx, dy := x1-x0, y1-y0
+	n := int(math.Max(math.Abs(float64(dx)), math.Abs(float64(dy))))
+	if n == 0 {
+		c.img.Set(x0, y0, col)
+		return
+	}
+	for i := 0; i <= n; i++ {
+		x := x0 + int(math.Round(float64(dx*i)/float64(n)))
+		y := y0 + int(math.Round(float64(dy*i)/float64(n)))
+		c.img.Set(x, y, col)
+	}
+}
+
+// drawDataLine draws a straight line of data between two points, opts.LineWidth pixels wide.
+func drawDataLine(c *canvas, x0, y0, x1, y1 int, col color.NRGBA) {
+	if c.opts.LineWidth <= 1 {
+		drawLine(c, x0, y0, x1, y1, col)
+		return
+	}
+	dx, dy := float64(x1-x0), float64(y1-y0)
+	n := int(math.Ceil(math.Hypot(dx, dy)/arcStepPixels)) + 1
+	c.line(col, func(dot func(x, y float64)) {
+		for i := 0; i <= n; i++ {
+			f := float64(i) / float64(n)
+			// Aim for the centres of the pixels, as drawLine fills.
+			dot(float64(x0)+0.5+f*dx, float64(y0)+0.5+f*dy)
+		}
+	})
+}
+
+// niceStep returns a round step size that divides span into roughly n intervals.
+func niceStep(span float64, n int) float64 {
+	raw := span / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*mag {
+			return m * mag
+		}
+	}
+	return 10 * mag
+}
+
+// formatTick formats a tick label with only as much precision as the step size needs.
+func formatTick(v, step float64) string {
+	prec := 0
+	if step < 1 {
+		prec = int(math.Ceil(-math.Log10(step)))
+	}
+	return fmt.Sprintf("%.*f", prec, v)
+}
@@ -0,0 +1,67 @@
+package glow
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSmooth(t *testing.T) {
+	// days builds points from (day, value) pairs, with x in weeks as dailyPoints does.
+	days := func(dv ...float64) []linePoint {
+		var pts []linePoint
+		for i := 0; i < len(dv); i += 2 {
+			pts = append(pts, linePoint{dv[i] / 7, dv[i+1]})
+		}
+		return pts
+	}
+	tests := []struct {
+		desc string
+		in   []linePoint
+		n    int
+		want []float64
+	}{
+		{"no smoothing", days(0, 1, 1, 2, 2, 3), 1, []float64{1, 2, 3}},
+		{"window shrinks at ends", days(0, 1, 1, 2, 2, 3, 3, 4), 3, []float64{1.5, 2, 3, 3.5}},
+		{"missing day", days(0, 1, 1, 2, 3, 6), 3, []float64{1.5, 1.5, 6}},
+		{"wide window", days(0, 1, 1, 2, 2, 3, 3, 4, 4, 5), 5, []float64{2, 2.5, 3, 3.5, 4}},
+		{"even window", days(0, 2, 1, 4, 2, 6), 4, []float64{3, 4, 5}},
+	}
+	for _, test := range tests {
+		got := smooth(test.in, test.n)
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got %d points, want %d", test.desc, len(got), len(test.want))
+			continue
+		}
+		for i, pt := range got {
+			if pt.x != test.in[i].x {
+				t.Errorf("%s: point %d has x=%v, want %v", test.desc, i, pt.x, test.in[i].x)
+			}
+			if math.Abs(pt.y-test.want[i]) > 1e-9 {
+				t.Errorf("%s: point %d has y=%v, want %v", test.desc, i, pt.y, test.want[i])
+			}
+		}
+	}
+}
+
+func TestNiceStep(t *testing.T) {
+	tests := []struct {
+		span float64
+		n    int
+		want float64
+	}{
+		{10, 5, 2},
+		{7, 5, 2},
+		{10, 4, 5},
+		{100, 4, 50},
+		{9, 1, 10},
+		{24, 6, 5},
+		{0.3, 3, 0.1},
+		{0.7, 5, 0.2},
+	}
+	for _, test := range tests {
+		got := niceStep(test.span, test.n)
+		if math.Abs(got-test.want) > 1e-9*test.want {
+			t.Errorf("niceStep(%v, %d) = %v, want %v", test.span, test.n, got, test.want)
+		}
+	}
+}
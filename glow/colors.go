@@ -0,0 +1,101 @@
+package glow
+
+import (
+	"fmt"
+	"image/color"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ColorElements are the plot elements whose colours can be set in PlotOptions.Colors
+// (from the config file's "colors" section), with what they are used for.
+// Those not set keep the colours of the -palette and -theme, or the built-in ones.
+var ColorElements = map[string]string{
+	"long":          "sleep segments of -long-sleep or more, and the main events in other polar plots",
+	"medium":        "sleep segments between -short-sleep and -long-sleep",
+	"short":         "sleep segments under -short-sleep, and marks overlaid on polar plots",
+	"feed":          "feeds in the feed plot",
+	"feed-midnight": "feeds spanning midnight in the feed plot",
+	"line":          "the data in line charts",
+	"smooth":        "the smoothed line in line charts",
+	"bar":           "histogram bars",
+	"background":    "the plot background",
+	"text":          "titles, labels and axes",
+	"grid":          "the gridlines of polar plots",
+}
+
+// ParseColors parses the "colors" section of the config file, a JSON object
+// mapping elements to hex colours like "#1e90ff", for PlotOptions.Colors.
+func ParseColors(section interface{}) (map[string]color.NRGBA, error) {
+	m, ok := section.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(`"colors" should be an object mapping plot elements to colours, not %s`, jsonShape(section))
+	}
+	colors := make(map[string]color.NRGBA)
+	for name, v := range m {
+		if _, ok := ColorElements[name]; !ok {
+			var known []string
+			for k := range ColorElements {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown plot element %q in colors; known elements are %s", name, strings.Join(known, ", "))
+		}
+		s, _ := v.(string)
+		col, err := ParseHexColor(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad colour %v for %q: %w", v, name, err)
+		}
+		colors[name] = col
+	}
+	return colors, nil
+}
+
+// ParseHexColor parses a colour written as "#rrggbb", or "#rrggbbaa" with an alpha.
+func ParseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if !strings.HasPrefix(s, "#") || len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf(`want a hex colour like "#1e90ff"`)
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf(`want a hex colour like "#1e90ff"`)
+	}
+	return color.NRGBA{uint8(n >> 24), uint8(n >> 16), uint8(n >> 8), uint8(n)}, nil
+}
+
+// elementColor returns the colour set for a plot element in opts.Colors, or else def.
+func (opts PlotOptions) elementColor(name string, def color.NRGBA) color.NRGBA {
+	if col, ok := opts.Colors[name]; ok {
+		return col
+	}
+	return def
+}
+
+// plotPalette returns the palette named by opts.Palette, with any colours set in opts.Colors.
+func (opts PlotOptions) plotPalette() palette {
+	pal := palettes[opts.Palette]
+	pal.long = opts.elementColor("long", pal.long)
+	pal.medium = opts.elementColor("medium", pal.medium)
+	pal.short = opts.elementColor("short", pal.short)
+	return pal
+}
+
+// plotTheme returns the theme named by opts.Theme, with any colours set in opts.Colors.
+func (opts PlotOptions) plotTheme() theme {
+	th := themes[opts.Theme]
+	for name, col := range map[string]*color.Color{
+		"background": &th.background,
+		"text":       &th.text,
+		"grid":       &th.grid,
+	} {
+		if c, ok := opts.Colors[name]; ok {
+			*col = c
+		}
+	}
+	return th
+}
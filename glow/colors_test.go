@@ -0,0 +1,61 @@
+package glow
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want color.NRGBA
+		ok   bool
+	}{
+		{"#1e90ff", color.NRGBA{0x1e, 0x90, 0xff, 0xff}, true},
+		{"#1E90FF80", color.NRGBA{0x1e, 0x90, 0xff, 0x80}, true},
+		{"1e90ff", color.NRGBA{}, false},
+		{"#fff", color.NRGBA{}, false},
+		{"#1e90fg", color.NRGBA{}, false},
+		{"#-1e90ff", color.NRGBA{}, false},
+		{"", color.NRGBA{}, false},
+	}
+	for _, test := range tests {
+		got, err := ParseHexColor(test.in)
+		if got != test.want || (err == nil) != test.ok {
+			t.Errorf("ParseHexColor(%q) = %v, %v; want %v, ok=%t", test.in, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestPlotColors(t *testing.T) {
+	colors, err := ParseColors(map[string]interface{}{"long": "#112233", "grid": "#44556680"})
+	if err != nil {
+		t.Fatalf("ParseColors: %v", err)
+	}
+	opts := PlotOptions{Palette: "cb-safe", Theme: "dark", Colors: colors}
+	pal := opts.plotPalette()
+	if want := (color.NRGBA{0x11, 0x22, 0x33, 0xff}); pal.long != want {
+		t.Errorf("long colour = %v, want %v from Colors", pal.long, want)
+	}
+	if want := palettes["cb-safe"].medium; pal.medium != want {
+		t.Errorf("medium colour = %v, want %v from the palette", pal.medium, want)
+	}
+	th := opts.plotTheme()
+	if want := (color.NRGBA{0x44, 0x55, 0x66, 0x80}); th.grid != want {
+		t.Errorf("grid colour = %v, want %v from Colors", th.grid, want)
+	}
+	if want := themes["dark"].background; th.background != want {
+		t.Errorf("background colour = %v, want %v from the theme", th.background, want)
+	}
+
+	for _, bad := range []interface{}{
+		"blue",
+		map[string]interface{}{"sky": "#0000ff"},
+		map[string]interface{}{"long": "blue"},
+		map[string]interface{}{"long": 255},
+	} {
+		if _, err := ParseColors(bad); err == nil {
+			t.Errorf("ParseColors(%v) succeeded, want error", bad)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package glow
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// credentials are what's needed to log in to Glow Baby.
+// This is also the format of the -creds file.
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// normalise trims surrounding whitespace from the credentials, then checks that
+// they look usable, so a typo gets a clear error rather than a confusing one from the server.
+func (c *credentials) normalise() error {
+	c.Email = strings.TrimSpace(c.Email)
+	c.Password = strings.TrimSpace(c.Password)
+	var problems []string
+	if c.Email == "" {
+		problems = append(problems, "email is missing")
+	} else if a, err := mail.ParseAddress(c.Email); err != nil || a.Address != c.Email {
+		problems = append(problems, fmt.Sprintf("email %q doesn't look like an email address", c.Email))
+	}
+	if c.Password == "" {
+		problems = append(problems, "password is missing")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("bad credentials: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// credsStdin is where -creds - reads credentials from. Tests may override it.
+var credsStdin io.Reader = os.Stdin
+
+// loadCreds loads credentials from the OS keyring if opts.Keyring is set and they are there,
+// or else from opts.CredsFile, or standard input if that is "-".
+// If the file doesn't exist and we're running interactively,
+// it prompts for them instead, and reports that it did so.
+func loadCreds(opts LoginOptions) (creds credentials, prompted bool, err error) {
+	if opts.Keyring {
+		creds, err := keyringGet(opts.Account)
+		switch {
+		case err == nil:
+			return creds, false, nil
+		case errors.Is(err, errNoKeyring):
+			log.Printf("Can't use the OS keyring (%v); falling back to %s", err, opts.CredsFile)
+		case errors.Is(err, errNotInKeyring):
+			// Get them another way; login saves them to the keyring once they work.
+		default:
+			return credentials{}, false, err
+		}
+	}
+
+	if opts.CredsFile == "-" {
+		rawCreds, err := ioutil.ReadAll(credsStdin)
+		if err != nil {
+			return credentials{}, false, fmt.Errorf("reading creds from stdin: %w", err)
+		}
+		if err := json.Unmarshal(rawCreds, &creds); err != nil {
+			return credentials{}, false, fmt.Errorf("parsing creds from stdin: %w", err)
+		}
+		return creds, false, nil
+	}
+
+	rawCreds, err := ioutil.ReadFile(opts.CredsFile)
+	if os.IsNotExist(err) && term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "No credentials found in %s.\n", opts.CredsFile)
+		creds, err := promptCreds()
+		return creds, true, err
+	} else if err != nil {
+		return credentials{}, false, fmt.Errorf("loading creds from %s: %w", opts.CredsFile, err)
+	}
+	if err := checkCredsPerms(opts.CredsFile, opts.InsecureCreds); err != nil {
+		return credentials{}, false, err
+	}
+	if err := json.Unmarshal(rawCreds, &creds); err != nil {
+		return credentials{}, false, fmt.Errorf("parsing creds from %s: %w", opts.CredsFile, err)
+	}
+	return creds, false, nil
+}
+
+// checkCredsPerms checks that the creds file isn't readable by other users,
+// much like ssh does for private keys. If insecure is set, it only warns.
+func checkCredsPerms(filename string, insecure bool) error {
+	if runtime.GOOS == "windows" {
+		// Mode bits don't mean the same thing there.
+		return nil
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("checking creds file: %w", err)
+	}
+	if perm := fi.Mode().Perm(); perm&0077 != 0 {
+		if !insecure {
+			return fmt.Errorf("creds file %s is accessible by other users (mode %v); run `chmod 600 %s`, or pass -insecure-creds to ignore this", filename, perm, filename)
+		}
+		log.Printf("WARNING: creds file %s is accessible by other users (mode %v)", filename, perm)
+	}
+	return nil
+}
+
+// secrets are values that must never appear in logs or errors,
+// such as the password and auth token. See redact.
+var secrets []string
+
+// addSecret records s as a secret for redact to mask.
+func addSecret(s string) {
+	if s == "" {
+		return
+	}
+	secrets = append(secrets, s)
+	// It may also turn up JSON-escaped, such as in an echoed request body.
+	if b, err := json.Marshal(s); err == nil {
+		if esc := string(b[1 : len(b)-1]); esc != s {
+			secrets = append(secrets, esc)
+		}
+	}
+}
+
+// redact returns s with any known secrets masked out.
+// Use it on anything that might contain a secret before logging it
+// or putting it in an error.
+func redact(s string) string {
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+	}
+	return s
+}
+
+// stdin is shared by all the interactive prompts,
+// since a bufio.Reader may read ahead.
+var stdin = bufio.NewReader(os.Stdin)
+
+func promptCreds() (credentials, error) {
+	var creds credentials
+	fmt.Fprint(os.Stderr, "Glow Baby email: ")
+	email, err := stdin.ReadString('\n')
+	if err != nil {
+		return credentials{}, fmt.Errorf("reading email: %w", err)
+	}
+	creds.Email = strings.TrimSpace(email)
+
+	fmt.Fprint(os.Stderr, "Glow Baby password: ")
+	pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr) // the user's newline wasn't echoed
+	if err != nil {
+		return credentials{}, fmt.Errorf("reading password: %w", err)
+	}
+	creds.Password = string(pw)
+	return creds, nil
+}
+
+// Confirm asks a yes/no question, defaulting to no.
+func Confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// offerToSaveCreds asks whether to save credentials to filename,
+// and does so if the user agrees.
+func offerToSaveCreds(creds credentials, filename string) error {
+	if !Confirm(fmt.Sprintf("Save credentials to %s?", filename)) {
+		return nil
+	}
+	raw, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("marshaling creds: %w", err)
+	}
+	// The file holds a plaintext password, so keep it private.
+	if err := WriteFile(filename, append(raw, '\n'), 0600); err != nil {
+		return fmt.Errorf("saving creds to %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package glow
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	defer func(secs []string) { secrets = secs }(secrets)
+	secrets = nil
+	addSecret("")
+	addSecret("tok123")
+	addSecret(`pa"ss`)
+
+	tests := []struct {
+		in, want string
+	}{
+		{"nothing to see", "nothing to see"},
+		{"Authorization: tok123", "Authorization: [REDACTED]"},
+		{"tok123tok123", "[REDACTED][REDACTED]"},
+		{`password pa"ss`, "password [REDACTED]"},
+		{`{"password":"pa\"ss"}`, `{"password":"[REDACTED]"}`},
+	}
+	for _, test := range tests {
+		if got := redact(test.in); got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestCredentialsNormalise(t *testing.T) {
+	tests := []struct {
+		in      credentials
+		want    credentials
+		wantErr string
+	}{
+		{credentials{" me@example.com ", "pw\n"}, credentials{"me@example.com", "pw"}, ""},
+		{credentials{"", ""}, credentials{}, "bad credentials: email is missing; password is missing"},
+		{credentials{"me.example.com", "pw"}, credentials{"me.example.com", "pw"}, `bad credentials: email "me.example.com" doesn't look like an email address`},
+		{credentials{"Me <me@example.com>", " "}, credentials{"Me <me@example.com>", ""}, `bad credentials: email "Me <me@example.com>" doesn't look like an email address; password is missing`},
+	}
+	for _, test := range tests {
+		c := test.in
+		err := c.normalise()
+		var gotErr string
+		if err != nil {
+			gotErr = err.Error()
+		}
+		if c != test.want || gotErr != test.wantErr {
+			t.Errorf("normalise(%+v) gave %+v, error %q; want %+v, error %q", test.in, c, gotErr, test.want, test.wantErr)
+		}
+	}
+}
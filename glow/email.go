@@ -0,0 +1,164 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// sendMail sends an email. Tests may override it.
+// smtp.SendMail uses STARTTLS if the server offers it,
+// and refuses to send a password unencrypted except to localhost.
+var sendMail = smtp.SendMail
+
+// EmailOptions controls the emailed digest. The CLI sets them from flags (see emailOptionsFromFlags).
+type EmailOptions struct {
+	To       string // comma-separated recipients
+	From     string
+	Server   string // SMTP server, as host:port
+	User     string // if set, authenticate to Server as this user with Password
+	Password string
+	Account  string // if set, only summarise babies in this Auth account
+
+	// Report, if set, is used to render the PDF report to attach.
+	Report *ReportOptions
+}
+
+// dailyDigest writes a short text summary of yesterday and today so far
+// for each baby (in account, if that isn't empty), as of now.
+func dailyDigest(ctx context.Context, db *sql.DB, w io.Writer, now time.Time, account string) error {
+	infos, err := loadBabies(ctx, db, account)
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return errors.New("no babies found; log in and sync first")
+	}
+	now = now.In(plotLocation)
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, plotLocation)
+	yesterday := today.AddDate(0, 0, -1)
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s %s (born %s)\n", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+		for _, day := range []struct {
+			label    string
+			from, to int64
+		}{
+			{"Yesterday", yesterday.Unix(), today.Unix() - 1},
+			{"Today so far", today.Unix(), now.Unix()},
+		} {
+			bt, err := loadToday(ctx, db, info, day.from, day.to)
+			if err != nil {
+				return err
+			}
+			line := fmt.Sprintf("\t%s: %.1fh sleep, %s", day.label, bt.sleepHours, plural(bt.feeds, "feed"))
+			if bt.bottleML > 0 {
+				line += fmt.Sprintf(", %.0f ml by bottle", bt.bottleML)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
+
+// EmailReport emails the daily digest to the opts.To addresses,
+// attaching the PDF report if opts.Report is set.
+func EmailReport(ctx context.Context, db *sql.DB, now time.Time, opts EmailOptions) error {
+	var to []string
+	for _, addr := range strings.Split(opts.To, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return errors.New("no recipients; set -email-to")
+	}
+	if opts.From == "" || opts.Server == "" {
+		return errors.New("-email-from and -smtp-server must be set to send email")
+	}
+	host, _, err := net.SplitHostPort(opts.Server)
+	if err != nil {
+		return fmt.Errorf("bad -smtp-server %q; want host:port", opts.Server)
+	}
+
+	var body bytes.Buffer
+	if err := dailyDigest(ctx, db, &body, now, opts.Account); err != nil {
+		return err
+	}
+	var pdf []byte
+	if opts.Report != nil {
+		if pdf, err = Report(ctx, db, now, *opts.Report); err != nil {
+			return err
+		}
+	}
+	msg, err := digestMessage(opts.From, to, now, body.String(), pdf)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if opts.User != "" {
+		addSecret(opts.Password)
+		auth = smtp.PlainAuth("", opts.User, opts.Password, host)
+	}
+	if err := sendMail(opts.Server, auth, opts.From, to, msg); err != nil {
+		return fmt.Errorf("sending email: %s", redact(err.Error()))
+	}
+	log.Printf("Emailed the daily digest to %d recipients", len(to))
+	return nil
+}
+
+// digestMessage builds the email for the daily digest,
+// with the report attached if pdf isn't empty.
+func digestMessage(from string, to []string, now time.Time, body string, pdf []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: Glow Baby digest for %s\r\n", now.Format("2006-01-02"))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, fmt.Errorf("building email: %w", err)
+	}
+	io.WriteString(part, strings.ReplaceAll(body, "\n", "\r\n"))
+
+	if len(pdf) > 0 {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/pdf"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf(`attachment; filename="glowbaby-%s.pdf"`, now.Format("2006-01-02"))},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("building email: %w", err)
+		}
+		// Wrap the base64 at 76 characters, as MIME requires.
+		enc := base64.StdEncoding.EncodeToString(pdf)
+		for len(enc) > 76 {
+			io.WriteString(part, enc[:76]+"\r\n")
+			enc = enc[76:]
+		}
+		io.WriteString(part, enc+"\r\n")
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("building email: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+package glow
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDailyDigest(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Date(2024, time.January, 3, 9, 0, 0, 0, time.Local)
+	at := func(day, hour int) int64 { return time.Date(2024, time.January, day, hour, 0, 0, 0, time.Local).Unix() }
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+			(1, %d, %d, "sleep"); -- 2h yesterday, 6h today
+		INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType, BreastUsed, BottleML) VALUES
+			(1, %d, 2, "", 120),
+			(1, %d, 1, "L", 0);`, at(2, 22), at(3, 6), at(2, 12), at(3, 7)))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	var buf strings.Builder
+	if err := dailyDigest(context.Background(), db, &buf, now, ""); err != nil {
+		t.Fatalf("dailyDigest: %v", err)
+	}
+	want := `Ada Test (born 2024-01-01)
+	Yesterday: 2.0h sleep, 1 feed, 120 ml by bottle
+	Today so far: 6.0h sleep, 1 feed
+`
+	if got := buf.String(); got != want {
+		t.Errorf("dailyDigest wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEmailReport(t *testing.T) {
+	defer func(f func(string, smtp.Auth, string, []string, []byte) error) { sendMail = f }(sendMail)
+
+	opts := EmailOptions{
+		To:       "mum@example.com, grandpa@example.com",
+		From:     "baby@example.com",
+		Server:   "smtp.example.com:587",
+		User:     "baby",
+		Password: "hunter2",
+		Report:   &ReportOptions{},
+	}
+
+	var gotTo []string
+	var gotMsg []byte
+	sendMail = func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != opts.Server || auth == nil || from != opts.From {
+			t.Errorf("sendMail(%q, %v, %q, ...) doesn't match the options", addr, auth, from)
+		}
+		gotTo, gotMsg = to, msg
+		return nil
+	}
+	db := newTestDB(t)
+	now := time.Date(2024, time.January, 2, 18, 0, 0, 0, time.Local)
+	if err := EmailReport(context.Background(), db, now, opts); err != nil {
+		t.Fatalf("emailReport: %v", err)
+	}
+	if want := []string{"mum@example.com", "grandpa@example.com"}; !reflect.DeepEqual(gotTo, want) {
+		t.Errorf("email sent to %q, want %q", gotTo, want)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(gotMsg)))
+	if err != nil {
+		t.Fatalf("parsing email: %v", err)
+	}
+	if subj := msg.Header.Get("Subject"); subj != "Glow Baby digest for 2024-01-02" {
+		t.Errorf("email subject is %q", subj)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("parsing email content type: %v", err)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := ioutil.ReadAll(part)
+		types = append(types, part.Header.Get("Content-Type"))
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") && !strings.Contains(string(body), "Ada Test") {
+			t.Errorf("email text doesn't mention the baby:\n%s", body)
+		}
+	}
+	if want := []string{"text/plain; charset=utf-8", "application/pdf"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("email parts are %q, want %q", types, want)
+	}
+
+	opts.To = ""
+	if err := EmailReport(context.Background(), db, now, opts); err == nil {
+		t.Errorf("emailReport with no recipients succeeded, want error")
+	}
+}
@@ -0,0 +1,519 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ExportOptions controls an export. The CLI sets them from flags (see exportOptionsFromFlags).
+// Zero values mean the same as the flags' defaults, except for GrowthTolerance.
+type ExportOptions struct {
+	Selection // which baby and events to export
+
+	Format         string // "csv", "json", or "md" for a Markdown table
+	Aggregate      string // for events, if "day", write one row of totals per day instead of one per event
+	OutputTimezone string // if set, the time zone to write times and divide days in, instead of the local one
+
+	Night           string // for events by day, the window of the day whose sleep is night sleep, as for QueryOptions
+	Sex             string // for growth, the baby's sex, "boy" or "girl", to include WHO percentiles
+	GrowthTolerance int    // for growth, pair weight and height readings at most this many days apart
+}
+
+// withDefaults returns opts with its zero values replaced by the flags' defaults.
+func (opts ExportOptions) withDefaults() ExportOptions {
+	if opts.Format == "" {
+		opts.Format = "csv"
+	}
+	if opts.Night == "" {
+		opts.Night = "19:00-07:00"
+	}
+	return opts
+}
+
+// ExportTypes are the types of data that Export writes.
+var ExportTypes = []string{"growth", "events", "records"}
+
+// Export writes a table of the given type of data (one of ExportTypes) to w, in opts.Format.
+// Times are written, and days divided, in opts.OutputTimezone.
+// The -from/-to dates are still read in the local time zone, like the birthday.
+func Export(ctx context.Context, db *sql.DB, typ string, w io.Writer, opts ExportOptions) error {
+	opts = opts.withDefaults()
+	write, ok := map[string]func(io.Writer, []string, [][]string) error{
+		"csv":  writeCSV,
+		"json": writeJSONTable,
+		"md":   writeMarkdown,
+	}[opts.Format]
+	if !ok {
+		return fmt.Errorf("unknown -format %q; want \"csv\", \"json\" or \"md\"", opts.Format)
+	}
+	if opts.Aggregate != "" && (typ != "events" || opts.Aggregate != "day") {
+		return fmt.Errorf("bad -aggregate %q for %s export; only events can be aggregated, by \"day\"", opts.Aggregate, typ)
+	}
+	loc := plotLocation
+	if opts.OutputTimezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(opts.OutputTimezone); err != nil {
+			return fmt.Errorf("bad -output-timezone: %w", err)
+		}
+	}
+	var header []string
+	var table [][]string
+	var err error
+	switch typ {
+	default:
+		return fmt.Errorf("unknown export type %q", typ)
+	case "growth":
+		header, table, err = growthTable(ctx, db, loc, opts)
+	case "events":
+		if opts.Aggregate == "day" {
+			header, table, err = dailyTable(ctx, db, loc, opts)
+		} else {
+			header, table, err = eventsTable(ctx, db, loc, opts)
+		}
+	case "records":
+		header, table, err = recordsTable(ctx, db, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return write(w, header, table)
+}
+
+func writeCSV(w io.Writer, header []string, table [][]string) error {
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(table) // flushes
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing CSV: %w", err)
+	}
+	return nil
+}
+
+// writeJSONTable writes a table as a JSON object whose "rows" are objects
+// keyed by the header, leaving out empty cells.
+func writeJSONTable(w io.Writer, header []string, table [][]string) error {
+	rows := make([]map[string]string, 0, len(table))
+	for _, row := range table {
+		obj := make(map[string]string)
+		for i, cell := range row {
+			if cell != "" {
+				obj[header[i]] = cell
+			}
+		}
+		rows = append(rows, obj)
+	}
+	return writeJSON(w, struct {
+		Rows []map[string]string `json:"rows"`
+	}{rows})
+}
+
+// writeMarkdown writes a GitHub-flavoured Markdown table, with its columns
+// padded to line up when read as plain text.
+func writeMarkdown(w io.Writer, header []string, table [][]string) error {
+	escape := func(s string) string {
+		s = strings.ReplaceAll(s, "|", `\|`)
+		return strings.Join(strings.Fields(s), " ") // a row must be a single line
+	}
+	rows := make([][]string, 0, len(table)+1)
+	for _, row := range append([][]string{header}, table...) {
+		esc := make([]string, len(row))
+		for i, cell := range row {
+			esc[i] = escape(cell)
+		}
+		rows = append(rows, esc)
+	}
+	widths := make([]int, len(header))
+	for i := range widths {
+		widths[i] = 3 // the minimum for the delimiter row
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	line := func(cells []string) string {
+		var sb strings.Builder
+		sb.WriteString("|")
+		for i, cell := range cells {
+			sb.WriteString(" " + cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)) + " |")
+		}
+		return sb.String()
+	}
+	delim := make([]string, len(widths))
+	for i, n := range widths {
+		delim[i] = strings.Repeat("-", n)
+	}
+	var sb strings.Builder
+	sb.WriteString(line(rows[0]) + "\n")
+	sb.WriteString(line(delim) + "\n")
+	for _, row := range rows[1:] {
+		sb.WriteString(line(row) + "\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// eventsTable returns every event for the baby selected by opts
+// within its -from/-to window, in chronological order, with times in loc.
+func eventsTable(ctx context.Context, db *sql.DB, loc *time.Location, opts ExportOptions) (header []string, table [][]string, err error) {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for exporting events", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	from, to, err := opts.timeWindow()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type event struct {
+		ts         int64
+		typ, about string
+	}
+	var events []event
+	rows, err := db.QueryContext(ctx, `
+		SELECT StartTimestamp, EndTimestamp, Key, ValInt, ValFloat, ValStr FROM BabyData
+		WHERE BabyID = ? AND StartTimestamp BETWEEN ? AND ?
+		ORDER BY StartTimestamp, ID`, info.babyID, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var start int64
+		var end, valInt sql.NullInt64
+		var key, valStr sql.NullString
+		var valFloat sql.NullFloat64
+		if err := rows.Scan(&start, &end, &key, &valInt, &valFloat, &valStr); err != nil {
+			return nil, nil, fmt.Errorf("scanning events from DB: %w", err)
+		}
+		var about string
+		switch key.String {
+		case "temperature":
+			about = fmt.Sprintf("%.1f ºC", valFloat.Float64)
+		case "weight":
+			about = fmt.Sprintf("%.3f kg", valFloat.Float64)
+		case "height":
+			about = fmt.Sprintf("%.1f cm", valFloat.Float64)
+		case "diaper":
+			if !valInt.Valid && valStr.String != "" {
+				about = valStr.String // imported, not from Glow
+				break
+			}
+			// The meaning of these codes isn't known yet.
+			about = fmt.Sprintf("code %d", valInt.Int64)
+		default:
+			about = valStr.String
+			if end.Valid && end.Int64 >= start {
+				d := (time.Duration(end.Int64-start) * time.Second).String()
+				if about == "" {
+					about = d
+				} else {
+					about = d + ", " + about
+				}
+			}
+		}
+		events = append(events, event{start, key.String, about})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("loading events from DB: %w", err)
+	}
+
+	feeds, err := loadFeedData(ctx, db, opts.Selection, info.babyID, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range feeds {
+		var parts []string
+		switch f.typ {
+		case FeedBreast:
+			if f.left > 0 {
+				parts = append(parts, "left "+(time.Duration(f.left)*time.Second).String())
+			}
+			if f.right > 0 {
+				parts = append(parts, "right "+(time.Duration(f.right)*time.Second).String())
+			}
+		case FeedBottle:
+			parts = append(parts, fmt.Sprintf("%.0f ml", f.bottleML))
+		case FeedPump:
+			parts = append(parts, fmt.Sprintf("left %.0f ml", f.pumpLeftML), fmt.Sprintf("right %.0f ml", f.pumpRightML))
+		}
+		typ := "feed"
+		if f.typ == FeedPump {
+			typ = "pump"
+		} else {
+			parts = append([]string{f.typ.String()}, parts...)
+		}
+		events = append(events, event{f.start, typ, strings.Join(parts, ", ")})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].ts < events[j].ts })
+	header = []string{"time", "type", "details"}
+	for _, e := range events {
+		ts := time.Unix(e.ts, 0).In(loc).Format("2006-01-02 15:04")
+		table = append(table, []string{ts, e.typ, e.about})
+	}
+	return header, table, nil
+}
+
+// dayTotals is a row of the daily export.
+type dayTotals struct {
+	sleepHours, longestHours float64
+	naps, feeds              int
+	bottleML, nursingMins    float64
+	wet, dirty               int // diapers
+	unknownDiapers           int // diapers of undecoded type, such as Glow's
+}
+
+// dailyTable returns a row of totals for each day, as for the stats, for the baby
+// selected by opts within its -from/-to window, from the first day with any events
+// to the last. Sleep spanning the start of a day is split between the days, but
+// naps and the longest stretch count on the day a sleep starts, like feeds.
+// Diapers are only known to be wet or dirty if they were imported from Huckleberry;
+// the meaning of Glow's codes isn't known yet, so a day with any of those has its
+// diaper cells left empty rather than undercounted.
+// Days are divided in loc.
+func dailyTable(ctx context.Context, db *sql.DB, loc *time.Location, opts ExportOptions) (header []string, table [][]string, err error) {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	info = info.in(loc)
+	log.Printf("Selected %s %s (born %s) for exporting daily totals", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	from, to, err := opts.timeWindow()
+	if err != nil {
+		return nil, nil, err
+	}
+	nightStart, nightEnd, err := parseNightWindow(opts.Night)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	days := make(map[int]*dayTotals) // keyed by days since birth
+	at := func(ts int64) *dayTotals {
+		t := time.Unix(ts, 0).In(loc)
+		if t.Before(opts.DayStart.dayStart(info.birthday)) {
+			return &dayTotals{} // ignored
+		}
+		d := opts.DayStart.dayNumber(info.birthday, t)
+		if days[d] == nil {
+			days[d] = &dayTotals{}
+		}
+		return days[d]
+	}
+
+	sleepByDay, err := loadDailySleep(ctx, db, opts.Selection, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	for d, hours := range sleepByDay {
+		if days[d] == nil {
+			days[d] = &dayTotals{}
+		}
+		days[d].sleepHours = hours
+	}
+	segs, err := loadSegments(ctx, db, opts.Selection, info.babyID, "sleep")
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, seg := range segs {
+		dt := at(seg[0])
+		start, end := time.Unix(seg[0], 0).In(loc), time.Unix(seg[1], 0).In(loc)
+		if night, day := splitNight(start, end, nightStart, nightEnd); night <= day {
+			dt.naps++
+		}
+		if hours := float64(seg[1]-seg[0]) / 3600; hours > dt.longestHours {
+			dt.longestHours = hours
+		}
+	}
+
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range feeds {
+		dt := at(f.start)
+		dt.feeds++
+		switch f.typ {
+		case FeedBottle:
+			dt.bottleML += f.bottleML
+		case FeedBreast:
+			dt.nursingMins += float64(f.left+f.right) / 60
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT StartTimestamp, ValInt, ValStr FROM BabyData
+		WHERE BabyID = ? AND Key = "diaper" AND StartTimestamp BETWEEN ? AND ?`, info.babyID, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading diapers: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ts int64
+		var code sql.NullInt64
+		var what sql.NullString
+		if err := rows.Scan(&ts, &code, &what); err != nil {
+			return nil, nil, fmt.Errorf("scanning diapers from DB: %w", err)
+		}
+		dt := at(ts)
+		if code.Valid {
+			dt.unknownDiapers++
+			continue
+		}
+		// Huckleberry's notes follow the type after a semicolon.
+		switch strings.TrimSpace(strings.SplitN(what.String, ";", 2)[0]) {
+		case "Pee":
+			dt.wet++
+		case "Poo":
+			dt.dirty++
+		case "Both":
+			dt.wet++
+			dt.dirty++
+		default:
+			dt.unknownDiapers++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("loading diapers from DB: %w", err)
+	}
+
+	header = []string{"date", "sleep_hours", "naps", "longest_stretch_hours", "feeds", "bottle_ml", "nursing_min", "wet_diapers", "dirty_diapers"}
+	if len(days) == 0 {
+		return header, nil, nil
+	}
+	first, last := math.MaxInt32, math.MinInt32
+	for d := range days {
+		if d < first {
+			first = d
+		}
+		if d > last {
+			last = d
+		}
+	}
+	num := func(x float64) string { return strconv.FormatFloat(x, 'f', -1, 64) }
+	for d := first; d <= last; d++ {
+		dt := days[d]
+		if dt == nil {
+			dt = &dayTotals{}
+		}
+		wet, dirty := strconv.Itoa(dt.wet), strconv.Itoa(dt.dirty)
+		if dt.unknownDiapers > 0 {
+			wet, dirty = "", ""
+		}
+		table = append(table, []string{
+			info.birthday.AddDate(0, 0, d).Format("2006-01-02"),
+			num(math.Round(dt.sleepHours*100) / 100),
+			strconv.Itoa(dt.naps),
+			num(math.Round(dt.longestHours*100) / 100),
+			strconv.Itoa(dt.feeds),
+			num(math.Round(dt.bottleML)),
+			num(math.Round(dt.nursingMins)),
+			wet,
+			dirty,
+		})
+	}
+	return header, table, nil
+}
+
+// recordColumns are the columns of the "records" export, which holds the
+// BabyData and BabyFeedData rows exactly as stored, so import can restore them.
+// The table column is "data" or "feed"; columns that don't apply to a table
+// are left empty, as are NULLs. Timestamps are unix epoch seconds.
+var recordColumns = []string{
+	"table", "id", "baby_id", "start", "end", "uuid",
+	"key", "val_int", "val_float", "val_str",
+	"feed_type", "breast_used", "breast_left", "breast_right", "bottle_ml", "pump_left_ml", "pump_right_ml",
+}
+
+// recordsTable returns the stored rows for the baby selected by opts
+// within its -from/-to window, ordered by table and ID.
+func recordsTable(ctx context.Context, db *sql.DB, opts ExportOptions) (header []string, table [][]string, err error) {
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for exporting records", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	from, to, err := opts.timeWindow()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i := func(v sql.NullInt64) string {
+		if !v.Valid {
+			return ""
+		}
+		return strconv.FormatInt(v.Int64, 10)
+	}
+	f := func(v sql.NullFloat64) string {
+		if !v.Valid {
+			return ""
+		}
+		return strconv.FormatFloat(v.Float64, 'g', -1, 64) // shortest exact form
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT ID, StartTimestamp, EndTimestamp, UUID, Key, ValInt, ValFloat, ValStr FROM BabyData
+		WHERE BabyID = ? AND StartTimestamp BETWEEN ? AND ?
+		ORDER BY ID`, info.babyID, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading baby data: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, start, end, valInt sql.NullInt64
+		var uuid, key, valStr sql.NullString
+		var valFloat sql.NullFloat64
+		if err := rows.Scan(&id, &start, &end, &uuid, &key, &valInt, &valFloat, &valStr); err != nil {
+			return nil, nil, fmt.Errorf("scanning baby data from DB: %w", err)
+		}
+		table = append(table, []string{
+			"data", i(id), strconv.FormatInt(info.babyID, 10), i(start), i(end), uuid.String,
+			key.String, i(valInt), f(valFloat), valStr.String,
+			"", "", "", "", "", "", "",
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("loading baby data from DB: %w", err)
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT ID, StartTimestamp, EndTimestamp, UUID, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML, PumpLeftML, PumpRightML FROM BabyFeedData
+		WHERE BabyID = ? AND StartTimestamp BETWEEN ? AND ?
+		ORDER BY ID`, info.babyID, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading feeds: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, start, end, typ, left, right sql.NullInt64
+		var uuid, used sql.NullString
+		var bottle, pumpL, pumpR sql.NullFloat64
+		if err := rows.Scan(&id, &start, &end, &uuid, &typ, &used, &left, &right, &bottle, &pumpL, &pumpR); err != nil {
+			return nil, nil, fmt.Errorf("scanning feeds from DB: %w", err)
+		}
+		table = append(table, []string{
+			"feed", i(id), strconv.FormatInt(info.babyID, 10), i(start), i(end), uuid.String,
+			"", "", "", "",
+			i(typ), used.String, i(left), i(right), f(bottle), f(pumpL), f(pumpR),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("loading feeds from DB: %w", err)
+	}
+	return recordColumns, table, nil
+}
@@ -0,0 +1,167 @@
+package glow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf strings.Builder
+	err := writeMarkdown(&buf, []string{"a", "details"}, [][]string{
+		{"x", "Calpol | 2.5ml"},
+		{"longer", "two\nlines"},
+	})
+	if err != nil {
+		t.Fatalf("writeMarkdown: %v", err)
+	}
+	want := `| a      | details         |
+| ------ | --------------- |
+| x      | Calpol \| 2.5ml |
+| longer | two lines       |
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeMarkdown wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportEvents(t *testing.T) {
+	opts := ExportOptions{Selection: Selection{To: "2024-01-02"}, Format: "md"}
+
+	db := newTestDB(t)
+	at := func(day, hour int) int64 { return time.Date(2024, time.January, day, hour, 0, 0, 0, time.Local).Unix() }
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key, ValFloat, ValStr) VALUES
+			(1, 1, %d, %d, "sleep", NULL, ""),
+			(2, 1, %d, NULL, "medicine", NULL, "Calpol|2.5ml"),
+			(3, 1, %d, NULL, "weight", 3.5, NULL),
+			(4, 1, %d, NULL, "medicine", NULL, "too late");
+		INSERT INTO BabyFeedData(ID, BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML) VALUES
+			(1, 1, %d, 1, "B", 600, 300, 0),
+			(2, 1, %d, 2, "", 0, 0, 90);`,
+		at(1, 20), at(1, 22), at(2, 8), at(2, 9), at(3, 8), at(1, 19), at(2, 12)))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	var buf strings.Builder
+	if err := Export(context.Background(), db, "events", &buf, opts); err != nil {
+		t.Fatalf("export events: %v", err)
+	}
+	want := `| time             | type     | details                        |
+| ---------------- | -------- | ------------------------------ |
+| 2024-01-01 19:00 | feed     | breast, left 10m0s, right 5m0s |
+| 2024-01-01 20:00 | sleep    | 2h0m0s                         |
+| 2024-01-02 08:00 | medicine | Calpol\|2.5ml                  |
+| 2024-01-02 09:00 | weight   | 3.500 kg                       |
+| 2024-01-02 12:00 | feed     | bottle, 90 ml                  |
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export events wrote\n%s\nwant\n%s", got, want)
+	}
+
+	opts.Format = "pdf"
+	if err := Export(context.Background(), db, "events", &buf, opts); err == nil {
+		t.Errorf("export with -format %s succeeded, want error", opts.Format)
+	}
+}
+
+func TestExportDaily(t *testing.T) {
+	opts := ExportOptions{Selection: Selection{To: "2024-01-04"}, Format: "csv", Aggregate: "day"}
+
+	db := newTestDB(t)
+	at := func(day, hour, min int) int64 {
+		return time.Date(2024, time.January, day, hour, min, 0, 0, time.Local).Unix()
+	}
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key, ValInt, ValStr) VALUES
+			(1, %d, %d, "sleep", NULL, ""),
+			(1, %d, %d, "sleep", NULL, ""),
+			(1, %d, NULL, "diaper", NULL, "Both"),
+			(1, %d, NULL, "diaper", NULL, "Pee; leaked"),
+			(1, %d, NULL, "diaper", 1, NULL),
+			(1, %d, NULL, "diaper", NULL, "Poo");
+		INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML) VALUES
+			(1, %d, 2, "", 0, 0, 120),
+			(1, %d, 1, "B", 600, 300, 0),
+			(1, %d, 2, "", 0, 0, 90);`,
+		at(1, 22, 0), at(2, 6, 0), // overnight
+		at(2, 13, 0), at(2, 14, 30), // a nap
+		at(2, 8, 0), at(2, 11, 0), at(4, 9, 0), at(5, 9, 0),
+		at(4, 10, 0), at(4, 12, 0), at(5, 10, 0)))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	var buf strings.Builder
+	if err := Export(context.Background(), db, "events", &buf, opts); err != nil {
+		t.Fatalf("export -aggregate day events: %v", err)
+	}
+	want := `date,sleep_hours,naps,longest_stretch_hours,feeds,bottle_ml,nursing_min,wet_diapers,dirty_diapers
+2024-01-01,2,0,8,0,0,0,0,0
+2024-01-02,7.5,1,1.5,0,0,0,2,1
+2024-01-03,0,0,0,0,0,0,0,0
+2024-01-04,0,0,0,2,120,15,,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export -aggregate day events wrote\n%s\nwant\n%s", got, want)
+	}
+
+	for _, test := range []struct{ agg, typ string }{{"week", "events"}, {"day", "growth"}} {
+		opts.Aggregate = test.agg
+		if err := Export(context.Background(), db, test.typ, &buf, opts); err == nil {
+			t.Errorf("export -aggregate %s %s succeeded, want error", test.agg, test.typ)
+		}
+	}
+}
+
+func TestExportOutputTimezone(t *testing.T) {
+	opts := ExportOptions{Format: "csv", OutputTimezone: "Asia/Tokyo"} // UTC+9, with no daylight saving
+	loc := plotLocation
+
+	db := newTestDB(t)
+	// In Tokyo, this sleep is early on the 2nd.
+	start := time.Date(2024, time.January, 1, 20, 0, 0, 0, time.UTC).Unix()
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES (1, %d, %d, "sleep")`, start, start+2*3600))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := Export(context.Background(), db, "events", &buf, opts); err != nil {
+		t.Fatalf("export events: %v", err)
+	}
+	if want := "time,type,details\n2024-01-02 05:00,sleep,2h0m0s\n"; buf.String() != want {
+		t.Errorf("export events with -output-timezone %s wrote\n%s\nwant\n%s", opts.OutputTimezone, buf.String(), want)
+	}
+
+	buf.Reset()
+	opts.Aggregate = "day"
+	if err := Export(context.Background(), db, "events", &buf, opts); err != nil {
+		t.Fatalf("export -aggregate day events: %v", err)
+	}
+	if want := "2024-01-02,2,0,2,"; !strings.Contains(buf.String(), want) {
+		t.Errorf("export -aggregate day events with -output-timezone %s wrote\n%s\nwant a row starting %s", opts.OutputTimezone, buf.String(), want)
+	}
+	if plotLocation != loc {
+		t.Errorf("export left plotLocation as %v, want it unchanged as %v", plotLocation, loc)
+	}
+
+	// -to is still a date in the local time zone, not the output one,
+	// where the sleep would be after it.
+	defer func(l *time.Location) { plotLocation = l }(plotLocation)
+	plotLocation = time.UTC
+	opts.To, opts.Aggregate = "2024-01-01", ""
+	buf.Reset()
+	if err := Export(context.Background(), db, "events", &buf, opts); err != nil {
+		t.Fatalf("export events with -to: %v", err)
+	}
+	if want := "2024-01-02 05:00,sleep"; !strings.Contains(buf.String(), want) {
+		t.Errorf("export events with -to %s and -output-timezone %s wrote\n%s\nwant the sleep at %s", opts.To, opts.OutputTimezone, buf.String(), want)
+	}
+
+	opts.OutputTimezone = "Mars/Olympus_Mons"
+	if err := Export(context.Background(), db, "events", &buf, opts); err == nil {
+		t.Errorf("export with -output-timezone %s succeeded, want error", opts.OutputTimezone)
+	}
+}
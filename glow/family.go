@@ -0,0 +1,107 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+)
+
+// syncFamily applies a baby's pulled BabyFamily and UserBabyRelation records in tx.
+// Each has only part of what is known about a user, so updates set just the parts
+// they have, keeping the rest. A removal from either removes the user.
+func syncFamily(ctx context.Context, tx *sql.Tx, baby PullBaby) error {
+	var n int
+	for _, fd := range []FamilyData{baby.BabyFamily, baby.UserBabyRelation} {
+		for _, m := range fd.Remove {
+			_, err := tx.ExecContext(ctx, `DELETE FROM Family WHERE BabyID = ? AND UserID = ?`, baby.BabyID, m.UserID)
+			if err != nil {
+				return fmt.Errorf("deleting family member from DB: %w", err)
+			}
+			n++
+		}
+		for _, m := range fd.Update {
+			if m.UserID == 0 {
+				// Nothing to tell who it is, or match it with the other kind of record.
+				continue
+			}
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO Family(BabyID, UserID, FirstName, LastName, Relation) VALUES(?, ?, ?, ?, ?)
+				ON CONFLICT (BabyID, UserID) DO UPDATE SET
+					FirstName = COALESCE(NULLIF(excluded.FirstName, ""), FirstName),
+					LastName = COALESCE(NULLIF(excluded.LastName, ""), LastName),
+					Relation = COALESCE(NULLIF(excluded.Relation, ""), Relation)`,
+				baby.BabyID, m.UserID, m.FirstName, m.LastName, m.Relation)
+			if err != nil {
+				return fmt.Errorf("applying family update in DB: %w", err)
+			}
+			n++
+		}
+	}
+	if n > 0 {
+		log.Printf("Applied %d family updates", n)
+	}
+	return nil
+}
+
+// familyResult is the output of Family.
+type familyResult struct {
+	Family []familyRecord `json:"family"`
+}
+
+type familyRecord struct {
+	BabyID    int64  `json:"baby_id"`
+	Baby      string `json:"baby"` // first name
+	UserID    int64  `json:"user_id"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Relation  string `json:"relation,omitempty"`
+}
+
+// Family lists the users related to each baby selected by opts.Account, as stored by the last sync.
+func Family(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	cond, args := babyFilter(opts.Account)
+	rows, err := db.QueryContext(ctx, `
+		SELECT BabyID, Babies.FirstName, UserID, Family.FirstName, Family.LastName, Relation FROM Family
+		JOIN Babies USING (BabyID)
+		WHERE `+cond+`
+		ORDER BY BabyID, UserID`, args...)
+	if err != nil {
+		return fmt.Errorf("loading family: %w", err)
+	}
+	defer rows.Close()
+	res := familyResult{Family: []familyRecord{}} // so JSON says [] rather than null
+	for rows.Next() {
+		var rec familyRecord
+		if err := rows.Scan(&rec.BabyID, &rec.Baby, &rec.UserID, &rec.FirstName, &rec.LastName, &rec.Relation); err != nil {
+			return fmt.Errorf("scanning family from DB: %w", err)
+		}
+		res.Family = append(res.Family, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading family from DB: %w", err)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, res)
+	}
+	for i, rec := range res.Family {
+		if i == 0 || rec.BabyID != res.Family[i-1].BabyID {
+			fmt.Fprintf(w, "%s:\n", rec.Baby)
+		}
+		name := strings.TrimSpace(rec.FirstName + " " + rec.LastName)
+		if name == "" {
+			name = "unnamed"
+		}
+		if rec.Relation != "" {
+			name += " (" + rec.Relation + ")"
+		}
+		fmt.Fprintf(w, "\t%s, user %d\n", name, rec.UserID)
+	}
+	if len(res.Family) == 0 {
+		fmt.Fprintln(w, "No family recorded; try running sync.")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package glow
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestFamily(t *testing.T) {
+	db := newTestDB(t)
+	// BabyFamily as update and remove lists, and UserBabyRelation as a plain list.
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1",
+		"BabyFamily": {
+			"update": [{"user_id": 10, "first_name": "Grace", "last_name": "Test"}, {"user_id": 11, "first_name": "Alan"}, {"first_name": "Nobody"}],
+			"remove": [{"user_id": 12}]},
+		"UserBabyRelation": [{"user_id": 10, "relation": "Mother"}, {"user_id": 13, "relation": "Nanny"}]}]}}`)
+	if _, err := db.Exec(`INSERT INTO Family(BabyID, UserID, FirstName) VALUES (1, 12, "Gone")`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := Family(context.Background(), db, &buf, QueryOptions{}); err != nil {
+		t.Fatalf("family: %v", err)
+	}
+	want := "Ada:\n" +
+		"\tGrace Test (Mother), user 10\n" +
+		"\tAlan, user 11\n" +
+		"\tunnamed (Nanny), user 13\n"
+	if got := buf.String(); got != want {
+		t.Errorf("family wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,1047 @@
+// Package glow keeps a copy of the data from a Glow Baby account in an SQLite DB,
+// and plots, summarises and exports it. It is the core of the glowbaby command,
+// which sets the options taken by each function from its flags.
+package glow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Domain is the host of the Glow Baby API.
+const Domain = "baby.glowing.com"
+
+// ClockTime is a time of day, in minutes since midnight. As a flag, it is set as "HH:MM".
+type ClockTime int
+
+func (ct ClockTime) String() string { return fmt.Sprintf("%02d:%02d", int(ct)/60, int(ct)%60) }
+
+func (ct *ClockTime) Set(s string) error {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return fmt.Errorf("want a time of day as HH:MM")
+	}
+	*ct = ClockTime(60*t.Hour() + t.Minute())
+	return nil
+}
+
+// apiBase returns raw, an -api-base, checked and parsed, without any trailing slash.
+func apiBase(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("bad -api-base %q; want a URL like https://%s", raw, Domain)
+	}
+	return u, nil
+}
+
+const initDB = `
+CREATE TABLE Auth (
+	Account TEXT NOT NULL PRIMARY KEY DEFAULT "",  -- see -account
+	Domain TEXT NOT NULL,  -- the host of -api-base, normally "baby.glowing.com"
+	Token TEXT NOT NULL,
+	LoginTimestamp INTEGER,  -- unix epoch; NULL if from before this was recorded
+
+	-- Validators from the last pull response, and a hash of the request they go with,
+	-- for making the next identical pull conditional. NULL if there were none.
+	PullHash TEXT,
+	PullETag TEXT,
+	PullLastModified TEXT
+) STRICT;
+
+CREATE TABLE Babies (
+	BabyID INTEGER NOT NULL PRIMARY KEY,
+	Account TEXT NOT NULL DEFAULT "",  -- the Auth account it was found with
+
+	FirstName TEXT NOT NULL,
+	LastName TEXT NOT NULL,
+	Birthday TEXT NOT NULL,  -- YYYY-MM-DD
+
+	-- Sync status.
+	SyncTime INTEGER,
+	SyncToken TEXT
+) STRICT;
+
+CREATE TABLE BabyData (
+	ID INTEGER NOT NULL PRIMARY KEY,
+	BabyID INTEGER NOT NULL,
+
+	StartTimestamp INTEGER NOT NULL,
+	EndTimestamp INTEGER,
+
+	Key TEXT,
+
+	ValInt INTEGER,
+	ValFloat REAL,
+	ValStr TEXT,
+
+	UUID TEXT
+) STRICT;
+CREATE INDEX BabyDataUUID ON BabyData(UUID);
+
+CREATE TABLE BabyFeedData (
+	ID INTEGER NOT NULL PRIMARY KEY,
+	BabyID INTEGER NOT NULL,
+
+	StartTimestamp INTEGER NOT NULL,
+	EndTimestamp INTEGER,
+
+	FeedType INTEGER,
+
+	BreastUsed TEXT,
+	BreastLeft INTEGER,
+	BreastRight INTEGER,
+
+	BottleML REAL,
+	PumpLeftML REAL,
+	PumpRightML REAL,
+
+	UUID TEXT
+) STRICT;
+CREATE INDEX BabyFeedDataUUID ON BabyFeedData(UUID);
+
+CREATE TABLE Family (
+	BabyID INTEGER NOT NULL,
+	UserID INTEGER NOT NULL,
+
+	FirstName TEXT NOT NULL DEFAULT "",
+	LastName TEXT NOT NULL DEFAULT "",
+	Relation TEXT NOT NULL DEFAULT "",  -- e.g. "Mother"; "" if unknown
+
+	PRIMARY KEY (BabyID, UserID)
+) STRICT;
+
+CREATE TABLE Insights (
+	ID INTEGER NOT NULL PRIMARY KEY,
+	BabyID INTEGER,  -- NULL for account-wide insights
+
+	Type TEXT,
+	Title TEXT,
+	Body TEXT,
+	CreateTimestamp INTEGER,
+
+	Account TEXT NOT NULL DEFAULT ""  -- the Auth account that synced it
+) STRICT;
+
+CREATE TABLE SyncHistory (
+	ID INTEGER NOT NULL PRIMARY KEY,
+	Account TEXT NOT NULL,
+	StartTimestamp INTEGER NOT NULL,  -- unix epoch
+	DurationMS INTEGER NOT NULL,
+	Full INTEGER NOT NULL,  -- 1 for a -full sync
+
+	-- Records in the pull response.
+	DataUpdates INTEGER NOT NULL,
+	DataRemoves INTEGER NOT NULL,
+	FeedUpdates INTEGER NOT NULL,
+	FeedRemoves INTEGER NOT NULL,
+	Insights INTEGER NOT NULL,
+
+	Error TEXT  -- NULL if the sync succeeded
+) STRICT;
+`
+
+// migrations bring a DB created by an older initDB up to date.
+// Running migrations[i] takes a DB from user_version i to i+1.
+// Only ever append to this, and make the same change to initDB.
+var migrations = []string{
+	// Insights from the pull response.
+	`CREATE TABLE Insights (
+		ID INTEGER NOT NULL PRIMARY KEY,
+		BabyID INTEGER,
+
+		Type TEXT,
+		Title TEXT,
+		Body TEXT,
+		CreateTimestamp INTEGER
+	) STRICT;`,
+
+	// Event UUIDs.
+	`ALTER TABLE BabyData ADD COLUMN UUID TEXT;
+	CREATE INDEX BabyDataUUID ON BabyData(UUID);
+	ALTER TABLE BabyFeedData ADD COLUMN UUID TEXT;
+	CREATE INDEX BabyFeedDataUUID ON BabyFeedData(UUID);`,
+
+	// Multiple accounts. Existing data belongs to the default account.
+	`CREATE TABLE NewAuth (
+		Account TEXT NOT NULL PRIMARY KEY DEFAULT "",
+		Domain TEXT NOT NULL,
+		Token TEXT NOT NULL
+	) STRICT;
+	INSERT INTO NewAuth(Domain, Token) SELECT Domain, Token FROM Auth;
+	DROP TABLE Auth;
+	ALTER TABLE NewAuth RENAME TO Auth;
+	ALTER TABLE Babies ADD COLUMN Account TEXT NOT NULL DEFAULT "";`,
+
+	// Pumping sessions.
+	`ALTER TABLE BabyFeedData ADD COLUMN PumpLeftML REAL;
+	ALTER TABLE BabyFeedData ADD COLUMN PumpRightML REAL;`,
+
+	// Login times, to spot stale tokens.
+	`ALTER TABLE Auth ADD COLUMN LoginTimestamp INTEGER;`,
+
+	// Sync history.
+	`CREATE TABLE SyncHistory (
+		ID INTEGER NOT NULL PRIMARY KEY,
+		Account TEXT NOT NULL,
+		StartTimestamp INTEGER NOT NULL,  -- unix epoch
+		DurationMS INTEGER NOT NULL,
+		Full INTEGER NOT NULL,  -- 1 for a -full sync
+
+		-- Records in the pull response.
+		DataUpdates INTEGER NOT NULL,
+		DataRemoves INTEGER NOT NULL,
+		FeedUpdates INTEGER NOT NULL,
+		FeedRemoves INTEGER NOT NULL,
+		Insights INTEGER NOT NULL,
+
+		Error TEXT  -- NULL if the sync succeeded
+	) STRICT;`,
+
+	// Conditional pulls.
+	`ALTER TABLE Auth ADD COLUMN PullHash TEXT;
+	ALTER TABLE Auth ADD COLUMN PullETag TEXT;
+	ALTER TABLE Auth ADD COLUMN PullLastModified TEXT;`,
+
+	// Family members.
+	`CREATE TABLE Family (
+		BabyID INTEGER NOT NULL,
+		UserID INTEGER NOT NULL,
+
+		FirstName TEXT NOT NULL DEFAULT "",
+		LastName TEXT NOT NULL DEFAULT "",
+		Relation TEXT NOT NULL DEFAULT "",  -- e.g. "Mother"; "" if unknown
+
+		PRIMARY KEY (BabyID, UserID)
+	) STRICT;`,
+
+	// Insights per account, so syncing one account doesn't replace another's.
+	`ALTER TABLE Insights ADD COLUMN Account TEXT NOT NULL DEFAULT "";
+	UPDATE Insights SET Account = COALESCE((SELECT Account FROM Babies WHERE Babies.BabyID = Insights.BabyID), "");`,
+
+	// Account-wide insights were stored with a BabyID of 0.
+	`UPDATE Insights SET BabyID = NULL WHERE BabyID = 0;`,
+}
+
+// Init creates the tables in a new DB.
+func Init(ctx context.Context, db *sql.DB) error {
+	// TODO: refuse if the DB already has tables?
+	if _, err := db.ExecContext(ctx, initDB); err != nil {
+		return fmt.Errorf("creating tables: %w", err)
+	}
+	// initDB is already up to date.
+	if _, err := db.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, len(migrations))); err != nil {
+		return fmt.Errorf("recording DB schema version: %w", err)
+	}
+	return nil
+}
+
+// Migrate applies any migrations that the DB hasn't had yet.
+// It does nothing to a DB that hasn't been initialised.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	var n int
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = "table" AND name = "Auth"`).Scan(&n)
+	if err != nil {
+		return fmt.Errorf("checking DB schema: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return fmt.Errorf("checking DB schema version: %w", err)
+	}
+	for ; version < len(migrations); version++ {
+		log.Printf("Upgrading DB schema to version %d", version+1)
+		if err := applyMigration(ctx, db, version); err != nil {
+			return fmt.Errorf("upgrading DB schema to version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs migrations[version] and records the new version,
+// in the same transaction.
+func applyMigration(ctx context.Context, db *sql.DB, version int) error {
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, migrations[version]); err != nil {
+		return err
+	}
+	// PRAGMA doesn't accept bind parameters.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+		return fmt.Errorf("recording DB schema version: %w", err)
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return nil
+}
+
+// LoginOptions controls a login. The CLI sets them from flags (see loginOptionsFromFlags).
+type LoginOptions struct {
+	Account       string // the Auth account to log in as
+	APIBase       string // base URL of the Glow Baby API (see apiBase)
+	Proxy         string // if set, the proxy to send API requests through (see newAPIClient)
+	CredsFile     string // file containing credentials, or "-" for standard input
+	InsecureCreds bool   // only warn, rather than fail, if CredsFile is readable by other users
+	Keyring       bool   // keep credentials in the OS keyring rather than CredsFile, where available
+	EncryptToken  bool   // encrypt the stored auth token with a passphrase (see tokenPassphrase)
+}
+
+// Login logs in to Glow Baby as opts.Account, and stores the auth token and babies it gets.
+func Login(ctx context.Context, db *sql.DB, opts LoginOptions) error {
+	// Load credentials.
+	creds, prompted, err := loadCreds(opts)
+	if err != nil {
+		return err
+	}
+	addSecret(creds.Password)
+	if err := creds.normalise(); err != nil {
+		return err
+	}
+	// Trimming may have changed it, and this is the form that is sent.
+	addSecret(creds.Password)
+	// Re-serialise to tidy up, compact, and remove any extraneous keys.
+	rawCreds, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("re-marshaling creds: %w", err)
+	}
+
+	base, err := apiBase(opts.APIBase)
+	if err != nil {
+		return err
+	}
+	if base.Scheme != "https" {
+		log.Printf("Warning: -api-base isn't HTTPS, so credentials will be sent unencrypted")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", base.String()+"/android/user/sign_in", bytes.NewReader(rawCreds))
+	if err != nil {
+		return fmt.Errorf("internal error: constructing HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := doWithRetry(ctx, opts.Proxy, req)
+	if err != nil {
+		return fmt.Errorf("making HTTP login request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return httpError("login", resp)
+	}
+	var loginResp LoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
+		return fmt.Errorf("decoding JSON login response: %w", err)
+	}
+
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	user := loginResp.Data.User
+	addSecret(user.AuthToken)
+	log.Printf("Logging in as %s %s ...", user.FirstName, user.LastName)
+	token := user.AuthToken
+	if opts.EncryptToken {
+		passphrase, err := tokenPassphrase()
+		if err != nil {
+			return err
+		}
+		if token, err = encryptToken(token, passphrase); err != nil {
+			return fmt.Errorf("encrypting auth token: %w", err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO Auth(Account, Domain, Token, LoginTimestamp) VALUES (?, ?, ?, ?)`,
+		opts.Account, base.Host, token, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("recording auth info in DB: %w", err)
+	}
+
+	for _, babyRec := range loginResp.Data.Babies {
+		baby := babyRec.Baby
+		log.Printf("Setting up sync info for baby %s %s (baby ID %d) ...", baby.FirstName, baby.LastName, baby.BabyID)
+
+		// Transform birthday format into ISO 8601.
+		t, err := time.Parse("2006/01/02", baby.Birthday)
+		if err != nil {
+			return fmt.Errorf("baby has malformed birthday %q: %w", baby.Birthday, err)
+		}
+		tStr := t.Format("2006-01-02")
+
+		// A baby may be shared by several accounts, such as both parents'.
+		// It stays with the account it was first found with, which syncs it.
+		_, err = tx.ExecContext(ctx, `INSERT INTO Babies(BabyID, Account, FirstName, LastName, Birthday) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(BabyID) DO UPDATE SET FirstName = excluded.FirstName, LastName = excluded.LastName, Birthday = excluded.Birthday`,
+			baby.BabyID, opts.Account, baby.FirstName, baby.LastName, tStr)
+		if err != nil {
+			return fmt.Errorf("recording baby sync info in DB: %w", err)
+		}
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing DB transaction: %w", err)
+	}
+
+	// Now that we know the credentials work, save them for next time.
+	saved := false
+	if opts.Keyring {
+		if err := keyringSet(opts.Account, creds); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			saved = true
+		}
+	}
+	if prompted && !saved {
+		if err := offerToSaveCreds(creds, opts.CredsFile); err != nil {
+			// The login itself worked, so don't fail because of this.
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// SyncOptions controls a sync. The CLI sets them from flags (see syncOptionsFromFlags).
+type SyncOptions struct {
+	Account       string        // the Auth account to sync
+	APIBase       string        // base URL of the Glow Baby API (see apiBase); if empty, https:// and the account's domain
+	Proxy         string        // if set, the proxy to send API requests through (see newAPIClient)
+	Full          bool          // ignore the stored sync state and re-download everything
+	Only          string        // if set, the only kinds of event to store (see parseOnly)
+	Implausible   string        // whether to "skip" (the default) or "keep" events with implausible start times
+	SaveRaw       string        // if set, a file to save the raw pull response to, with secrets removed
+	TokenAge      time.Duration // if set, warn if the last login was longer ago than this
+	Synchronous   string        // if set, the SQLite synchronous mode to write with (see setSynchronous)
+	ReportUnknown bool          // log keys of the pull response that aren't decoded (see reportUnknown)
+}
+
+// setSynchronous sets SQLite's synchronous mode to "normal" or "off",
+// which skip some or all of the fsyncs that make writes durable.
+// That speeds up big syncs, but with "off", a crash or power loss
+// part way through can corrupt the DB. It returns a func to restore the previous mode.
+// The mode is per connection, so this relies on db having only one.
+func setSynchronous(ctx context.Context, db *sql.DB, mode string) (restore func(), err error) {
+	switch mode {
+	default:
+		return nil, fmt.Errorf("bad -fast-sync %q; want \"normal\" or \"off\"", mode)
+	case "normal":
+	case "off":
+		log.Printf("WARNING: writing without fsync; if the computer crashes or loses power during this sync, the DB may be corrupted")
+	}
+	var prev int
+	if err := db.QueryRowContext(ctx, `PRAGMA synchronous`).Scan(&prev); err != nil {
+		return nil, fmt.Errorf("checking DB synchronous mode: %w", err)
+	}
+	// PRAGMA doesn't accept bind parameters.
+	if _, err := db.ExecContext(ctx, `PRAGMA synchronous = `+mode); err != nil {
+		return nil, fmt.Errorf("setting DB synchronous mode: %w", err)
+	}
+	return func() {
+		// Not using ctx, so this still happens if it is cancelled.
+		if _, err := db.Exec(fmt.Sprintf(`PRAGMA synchronous = %d`, prev)); err != nil {
+			log.Printf("Restoring DB synchronous mode: %v", err)
+		}
+	}, nil
+}
+
+// Sync pulls what has changed for opts.Account since the last sync, and stores it.
+func Sync(ctx context.Context, db *sql.DB, opts SyncOptions) error {
+	start := time.Now()
+
+	// Load auth token.
+	var authDomain, authToken string
+	var loginTS sql.NullInt64
+	var pullHash, pullETag, pullLastModified sql.NullString
+	row := db.QueryRowContext(ctx, `SELECT Domain, Token, LoginTimestamp, PullHash, PullETag, PullLastModified FROM Auth WHERE Account = ?`, opts.Account)
+	if err := row.Scan(&authDomain, &authToken, &loginTS, &pullHash, &pullETag, &pullLastModified); err == sql.ErrNoRows && opts.Account != "" {
+		return fmt.Errorf("no auth token for account %q; have you logged in with -account %s?", opts.Account, opts.Account)
+	} else if err == sql.ErrNoRows {
+		return fmt.Errorf("no auth token; have you logged in?")
+	} else if err != nil {
+		return fmt.Errorf("loading auth token from DB: %w", err)
+	}
+	if strings.HasPrefix(authToken, encryptedTokenPrefix) {
+		passphrase, err := tokenPassphrase()
+		if err != nil {
+			return err
+		}
+		if authToken, err = decryptToken(authToken, passphrase); err != nil {
+			return err
+		}
+	}
+	addSecret(authToken)
+	if loginTS.Valid && opts.TokenAge > 0 {
+		if age := time.Since(time.Unix(loginTS.Int64, 0)); age > opts.TokenAge {
+			// Glow's tokens are opaque, so we can't tell when they really expire.
+			log.Printf("Warning: last logged in %d days ago; if sync fails to authenticate, log in again", int(age.Hours()/24))
+		}
+	}
+
+	// Find all babies to synchronise.
+	type babyReq struct {
+		BabyID    int64  `json:"baby_id"`
+		SyncToken string `json:"sync_token,omitempty"`
+
+		first, last string
+		birthday    time.Time
+	}
+	var pullReq struct {
+		Data struct {
+			Babies []babyReq `json:"babies"`
+			User   struct {
+				// TODO: anything needed? seems not.
+			} `json:"user"`
+		} `json:"data"`
+	}
+	rows, err := db.QueryContext(ctx, `SELECT BabyID, FirstName, LastName, Birthday, SyncToken FROM Babies WHERE Account = ?`, opts.Account)
+	if err != nil {
+		return fmt.Errorf("determining list of babies to sync: %w", err)
+	}
+	for rows.Next() {
+		var br babyReq
+		var bday string
+		var st sql.NullString
+		if err := rows.Scan(&br.BabyID, &br.first, &br.last, &bday, &st); err != nil {
+			return fmt.Errorf("parsing list of babies to sync: %w", err)
+		}
+		br.birthday, err = time.ParseInLocation("2006-01-02", bday, plotLocation)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("baby %d has malformed birthday %q: %w", br.BabyID, bday, err)
+		}
+		if st.Valid && !opts.Full {
+			br.SyncToken = st.String
+		}
+		pullReq.Data.Babies = append(pullReq.Data.Babies, br)
+		log.Printf("Going to sync data for baby %s %s (baby ID %d)", br.first, br.last, br.BabyID)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("querying list of babies to sync: %w", err)
+	}
+	if len(pullReq.Data.Babies) == 0 {
+		// The pull would succeed, but do nothing.
+		return fmt.Errorf("no babies to sync; log in first to find them")
+	}
+	only, err := parseOnly(opts.Only)
+	if err != nil {
+		return err
+	}
+	if only != nil {
+		// The sync token moves on regardless, so skipped events won't come again.
+		log.Printf("Only storing %s; use -full later to fetch the rest", opts.Only)
+	}
+	if opts.Implausible == "" {
+		opts.Implausible = "skip"
+	}
+	if opts.Implausible != "skip" && opts.Implausible != "keep" {
+		return fmt.Errorf("bad -implausible %q; want \"skip\" or \"keep\"", opts.Implausible)
+	}
+	if opts.Full {
+		what := "all local events"
+		if only != nil {
+			what = "the local " + opts.Only + " events"
+		}
+		log.Printf("WARNING: doing a full sync; this re-downloads everything, and replaces %s for these babies", what)
+	}
+	if opts.Synchronous != "" {
+		restore, err := setSynchronous(ctx, db, opts.Synchronous)
+		if err != nil {
+			return err
+		}
+		defer restore()
+	}
+
+	rawPullReq, err := json.Marshal(pullReq)
+	if err != nil {
+		return fmt.Errorf("internal error: marshaling request: %w", err)
+	}
+
+	if opts.APIBase == "" {
+		opts.APIBase = "https://" + authDomain
+	}
+	base, err := apiBase(opts.APIBase)
+	if err != nil {
+		return err
+	}
+	if base.Host != authDomain {
+		log.Printf("Warning: -api-base is %s, but the auth token was issued by %s", base.Host, authDomain)
+	}
+	if base.Scheme != "https" {
+		log.Printf("Warning: -api-base isn't HTTPS, so the auth token will be sent unencrypted")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", base.String()+"/android/user/pull", bytes.NewReader(rawPullReq))
+	if err != nil {
+		return fmt.Errorf("internal error: constructing HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", authToken)
+	// If this is the same request as last time, and the server gave validators
+	// for its response, it can say there are no changes rather than send them again.
+	// Servers that don't support this never give validators, so this does nothing.
+	sum := sha256.Sum256(rawPullReq)
+	hash := hex.EncodeToString(sum[:])
+	conditional := !opts.Full && pullHash.String == hash && (pullETag.Valid || pullLastModified.Valid)
+	if conditional {
+		if pullETag.Valid {
+			req.Header.Set("If-None-Match", pullETag.String)
+		}
+		if pullLastModified.Valid {
+			req.Header.Set("If-Modified-Since", pullLastModified.String)
+		}
+	}
+
+	resp, err := doWithRetry(ctx, opts.Proxy, req)
+	if err != nil {
+		return fmt.Errorf("making HTTP pull request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w (the auth token may have expired; try logging in again)", httpError("pull", resp))
+	}
+	if resp.StatusCode == http.StatusNotModified && conditional {
+		log.Printf("No changes since the last sync")
+		if err := recordSync(ctx, db, opts, start, PullResponse{}, nil); err != nil {
+			log.Printf("Warning: recording sync history: %v", err)
+		}
+		return nil
+	}
+	if resp.StatusCode != 200 {
+		return httpError("pull", resp)
+	}
+	rawPullResp, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading pull response: %w", err)
+	}
+	if opts.SaveRaw != "" {
+		// This is for inspecting fields we don't decode yet,
+		// so keep everything except secrets.
+		if err := WriteFile(opts.SaveRaw, []byte(redact(string(rawPullResp))), 0600); err != nil {
+			return fmt.Errorf("saving raw pull response: %w", err)
+		}
+		log.Printf("Saved raw pull response to %s", opts.SaveRaw)
+	}
+	var pullResp PullResponse
+	if err := json.Unmarshal(rawPullResp, &pullResp); err != nil {
+		return fmt.Errorf("decoding JSON pull response: %w", err)
+	}
+	if opts.ReportUnknown {
+		reportUnknown(rawPullResp)
+	}
+
+	// Apply each baby's data in its own transaction,
+	// so one baby failing doesn't lose the others' updates.
+	reqs := make(map[int64]babyReq)
+	for _, br := range pullReq.Data.Babies {
+		reqs[br.BabyID] = br
+	}
+	var failed []string
+	implausible := 0
+	for _, baby := range pullResp.Data.Babies {
+		br, ok := reqs[baby.BabyID]
+		name := br.first + " " + br.last
+		if !ok {
+			name = fmt.Sprintf("baby ID %d", baby.BabyID)
+		}
+		n, err := syncBaby(ctx, db, name, baby, br.birthday, only, opts.Full, opts.Implausible)
+		implausible += n
+		if err != nil {
+			log.Printf("Syncing %s failed: %v", name, err)
+			failed = append(failed, name)
+			continue
+		}
+		log.Printf("Synced %s OK", name)
+	}
+	if implausible > 0 {
+		verb := map[string]string{"skip": "skipped", "keep": "kept anyway"}[opts.Implausible]
+		log.Printf("Warning: %d events had implausible start times, and were %s (see -implausible)", implausible, verb)
+	}
+	var insightsErr error
+	if only == nil || only["insights"] {
+		insightsErr = syncInsights(ctx, db, opts.Account, pullResp)
+	}
+	if insightsErr != nil {
+		log.Printf("Syncing insights failed: %v", insightsErr)
+	}
+
+	var syncErr error
+	if len(failed) > 0 {
+		syncErr = fmt.Errorf("%d of %d babies failed to sync: %s", len(failed), len(pullResp.Data.Babies), strings.Join(failed, ", "))
+	} else if insightsErr != nil {
+		syncErr = fmt.Errorf("syncing insights: %w", insightsErr)
+	}
+	// Only keep validators for a response that was stored in full,
+	// since a "no changes" answer would otherwise hide what wasn't.
+	etag, lastModified := sqlNullString(resp.Header.Get("ETag")), sqlNullString(resp.Header.Get("Last-Modified"))
+	if syncErr != nil || (!etag.Valid && !lastModified.Valid) {
+		etag, lastModified = sql.NullString{}, sql.NullString{}
+	}
+	_, err = db.ExecContext(ctx, `UPDATE Auth SET PullHash = ?, PullETag = ?, PullLastModified = ? WHERE Account = ?`,
+		sqlNullString(hash), etag, lastModified, opts.Account)
+	if err != nil {
+		log.Printf("Warning: recording pull validators: %v", err)
+	}
+	if err := recordSync(ctx, db, opts, start, pullResp, syncErr); err != nil {
+		// The sync itself is done, so don't fail because of this.
+		log.Printf("Warning: recording sync history: %v", err)
+	}
+	return syncErr
+}
+
+// syncInsights replaces the account's stored insights with those in the pull response.
+// If the response has none at all, the stored ones are left alone.
+func syncInsights(ctx context.Context, db *sql.DB, account string, pullResp PullResponse) error {
+	// TODO: Use remove/update like the baby data does, if the API turns out to support it.
+	if pullResp.Data.Insights == nil && pullResp.Data.SyncableInsights == nil {
+		return nil
+	}
+	// The same insight may appear in both lists.
+	var insights []Insight
+	seen := make(map[int64]bool)
+	for _, list := range []*[]Insight{pullResp.Data.Insights, pullResp.Data.SyncableInsights} {
+		if list == nil {
+			continue
+		}
+		for _, in := range *list {
+			if !seen[in.ID] {
+				seen[in.ID] = true
+				insights = append(insights, in)
+			}
+		}
+	}
+
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	// Insights about babies that aren't stored, such as those removed by forget,
+	// are dropped; account-wide insights have no baby ID.
+	known := make(map[int64]bool)
+	rows, err := tx.QueryContext(ctx, `SELECT BabyID FROM Babies`)
+	if err != nil {
+		return fmt.Errorf("loading babies from DB: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("scanning babies from DB: %w", err)
+		}
+		known[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading babies from DB: %w", err)
+	}
+	var stored int
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM Insights WHERE Account = ?`, account); err != nil {
+		return fmt.Errorf("clearing old insights from DB: %w", err)
+	}
+	for _, in := range insights {
+		if in.BabyID != 0 && !known[in.BabyID] {
+			continue
+		}
+		stored++
+		babyID := sql.NullInt64{Int64: in.BabyID, Valid: in.BabyID != 0} // NULL if account-wide
+		_, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO Insights(ID, BabyID, Type, Title, Body, CreateTimestamp, Account)
+			VALUES(?, ?, ?, ?, ?, ?, ?)`,
+			in.ID, babyID, in.Type, in.Title, in.Body, in.CreateTime, account)
+		if err != nil {
+			return fmt.Errorf("recording insight in DB: %w", err)
+		}
+	}
+	log.Printf("Stored %d insights", stored)
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return nil
+}
+
+// syncBaby applies one baby's pulled data to the DB, along with its new sync token.
+// If anything fails, none of it is applied, so the next sync will fetch it again.
+// If full is set, the pulled data is everything there is,
+// so it replaces all the baby's existing events (of the kinds in only, if set).
+// Updated events whose start times are implausible for a baby born on birthday
+// are logged, and skipped unless implausibleMode is "keep"; it returns how many there were.
+// A zero birthday means it isn't known.
+// If only is non-nil, updates to kinds of event not in it are skipped (see parseOnly).
+// Removals are always applied, since they don't always say what kind of event they were.
+func syncBaby(ctx context.Context, db *sql.DB, name string, baby PullBaby, birthday time.Time, only map[string]bool, full bool, implausibleMode string) (implausible int, err error) {
+	now := time.Now()
+	skip := func(kind string, id, ts int64) bool {
+		if plausible(ts, birthday, now) {
+			return false
+		}
+		implausible++
+		log.Printf("Warning: %s: %s %d has implausible start time %v", name, kind, id, time.Unix(ts, 0).In(time.Local))
+		return implausibleMode == "skip"
+	}
+
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return implausible, fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	// Update sync token and time.
+	_, err = tx.ExecContext(ctx, `UPDATE Babies SET SyncTime = ?, SyncToken = ? WHERE BabyID = ?`,
+		baby.SyncTime, baby.SyncToken, baby.BabyID)
+	if err != nil {
+		return implausible, fmt.Errorf("updating baby sync status in DB: %w", err)
+	}
+
+	if full {
+		// Anything the server no longer has won't be mentioned as removed,
+		// so start from scratch, but only for the kinds of event being stored.
+		// Rows with negative IDs were imported rather than synced (see ImportHuckleberry),
+		// so the server doesn't know about them, and they are kept.
+		for _, table := range []string{"BabyData", "BabyFeedData", "Family"} {
+			cond, args := `BabyID = ?`, []interface{}{baby.BabyID}
+			if table != "Family" {
+				cond += ` AND ID > 0`
+			}
+			switch {
+			case only == nil:
+			case table == "BabyFeedData" && !only["feed"], table == "Family" && !only["family"]:
+				continue
+			case table == "BabyData":
+				var keys []string
+				for kind := range only {
+					if kind != "feed" && kind != "insights" && kind != "family" {
+						keys = append(keys, "?")
+						args = append(args, kind)
+					}
+				}
+				if len(keys) == 0 {
+					continue
+				}
+				cond += ` AND Key IN (` + strings.Join(keys, ", ") + `)`
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE `+cond, args...); err != nil {
+				return implausible, fmt.Errorf("clearing %s for full sync: %w", table, err)
+			}
+		}
+	}
+
+	prog := newProgress(name+": removing baby data", len(baby.BabyData.Remove))
+	for _, bd := range baby.BabyData.Remove {
+		_, err := tx.ExecContext(ctx, `DELETE FROM BabyData WHERE ID = ?`, bd.ID)
+		if err != nil {
+			return implausible, fmt.Errorf("deleting baby data from DB: %w", err)
+		}
+		prog.inc()
+	}
+	prog.finish()
+	if n := len(baby.BabyData.Remove); n > 0 {
+		log.Printf("Removed %d old baby data events", n)
+	}
+	prog = newProgress(name+": applying baby data", len(baby.BabyData.Update))
+	applied := 0
+	for _, bd := range baby.BabyData.Update {
+		prog.inc()
+		if only != nil && !only[bd.Key] {
+			continue
+		}
+		if skip("baby data", bd.ID, bd.StartTimestamp) {
+			continue
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key, ValInt, ValFloat, ValStr, UUID)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			bd.ID, bd.BabyID, bd.StartTimestamp, sqlNullInt64(bd.EndTimestamp), bd.Key, bd.ValInt, bd.ValFloat, bd.ValStr, sqlNullString(bd.UUID))
+		if err != nil {
+			return implausible, fmt.Errorf("applying baby data update in DB: %w", err)
+		}
+		applied++
+	}
+	prog.finish()
+	log.Printf("Applied %d baby data updates", applied)
+
+	prog = newProgress(name+": removing baby feed data", len(baby.BabyFeedData.Remove))
+	for _, bd := range baby.BabyFeedData.Remove {
+		_, err := tx.ExecContext(ctx, `DELETE FROM BabyFeedData WHERE ID = ?`, bd.ID)
+		if err != nil {
+			return implausible, fmt.Errorf("deleting baby data from DB: %w", err)
+		}
+		prog.inc()
+	}
+	prog.finish()
+	if n := len(baby.BabyFeedData.Remove); n > 0 {
+		log.Printf("Removed %d old baby feed data events", n)
+	}
+	feedUpdates := baby.BabyFeedData.Update
+	if only != nil && !only["feed"] {
+		feedUpdates = nil
+	}
+	prog = newProgress(name+": applying baby feed data", len(feedUpdates))
+	applied = 0
+	for _, bfd := range feedUpdates {
+		prog.inc()
+		if skip("baby feed data", bfd.ID, bfd.StartTimestamp) {
+			continue
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT OR REPLACE INTO BabyFeedData(ID, BabyID, StartTimestamp, EndTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML, PumpLeftML, PumpRightML, UUID)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			bfd.ID, bfd.BabyID, bfd.StartTimestamp, sqlNullInt64(bfd.EndTimestamp), bfd.FeedType, bfd.BreastUsed, bfd.BreastLeft, bfd.BreastRight, bfd.BottleML, bfd.PumpLeftML, bfd.PumpRightML, sqlNullString(bfd.UUID))
+		if err != nil {
+			return implausible, fmt.Errorf("applying baby feed data update in DB: %w", err)
+		}
+		applied++
+	}
+	prog.finish()
+	log.Printf("Applied %d baby feed data updates", applied)
+
+	if only == nil || only["family"] {
+		if err := syncFamily(ctx, tx, baby); err != nil {
+			return implausible, err
+		}
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return implausible, fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return implausible, nil
+}
+
+// syncKinds are the kinds of event that -only can select:
+// the keys of BabyData events, plus "feed" for all of BabyFeedData, "insights" and "family".
+var syncKinds = []string{"sleep", "feed", "diaper", "medicine", "tummy", "temperature", "weight", "height", "insights", "family"}
+
+// parseOnly parses the value of -only into a set of syncKinds.
+// It returns nil, meaning everything, if v is empty.
+func parseOnly(v string) (map[string]bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	only := make(map[string]bool)
+	for _, kind := range strings.Split(v, ",") {
+		kind = strings.TrimSpace(kind)
+		known := false
+		for _, k := range syncKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("bad -only kind %q; want some of %s", kind, strings.Join(syncKinds, ","))
+		}
+		only[kind] = true
+	}
+	return only, nil
+}
+
+// plausibleMargin is how far before the birthday, or after now,
+// an event can start without being considered implausible.
+const plausibleMargin = 7 * 24 * time.Hour
+
+// plausible reports whether an event starting at the unix time ts could be genuine
+// for a baby born on birthday (if that isn't zero), given that it is now now.
+// Bad clocks and server bugs sometimes give events an epoch 0 or far future start time.
+func plausible(ts int64, birthday, now time.Time) bool {
+	t := time.Unix(ts, 0)
+	if !birthday.IsZero() && t.Before(birthday.Add(-plausibleMargin)) {
+		return false
+	}
+	return !t.After(now.Add(plausibleMargin))
+}
+
+// httpError describes a failed HTTP request, including the start of the response body.
+// The body may echo back the request, so it is redacted.
+func httpError(what string, resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("HTTP %s request gave non-200 status %q: %s", what, resp.Status, redact(strings.TrimSpace(string(body))))
+}
+
+// WriteFile writes data to the named file with the given permissions.
+// It writes a temporary file in the same directory, then renames it into place,
+// so that if anything fails, any existing file is left as it was, not truncated.
+// Unlike ioutil.WriteFile, it sets the permissions of an existing file too.
+func WriteFile(name string, data []byte, mode os.FileMode) (err error) {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// CheckWritable checks that the named file can be written, without changing it.
+// WriteFile renames a temporary file into place, so that means creating
+// (and removing again) a file in the same directory.
+func CheckWritable(name string) error {
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		return fmt.Errorf("%s is a directory", name)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func sqlNullInt64(x *int64) (ret sql.NullInt64) {
+	if x != nil {
+		ret.Int64, ret.Valid = *x, true
+	}
+	return
+}
+
+// sqlNullString maps the empty string to NULL.
+func sqlNullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
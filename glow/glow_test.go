@@ -0,0 +1,815 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestLoginErrorRedactsPassword(t *testing.T) {
+	const password = `hunter2"secret`
+
+	// A server that rejects the login, unhelpfully echoing the request back.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("bad login: "))
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	defer func(secs []string) { secrets = secs }(secrets)
+
+	// The password is trimmed before it is sent, so padding mustn't stop it being redacted.
+	for _, stored := range []string{`"hunter2\"secret"`, `"  hunter2\"secret\t"`} {
+		creds := filepath.Join(t.TempDir(), "creds.json")
+		err := ioutil.WriteFile(creds, []byte(`{"email": "me@example.com", "password": `+stored+`}`), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets = nil
+
+		// The DB isn't touched until after a successful login.
+		err = Login(context.Background(), nil, LoginOptions{APIBase: srv.URL, CredsFile: creds})
+		if err == nil {
+			t.Fatalf("login with password %s succeeded, want error", stored)
+		}
+		if !strings.Contains(err.Error(), "401") {
+			t.Errorf("login error %q doesn't mention the HTTP status", err)
+		}
+		if !strings.Contains(err.Error(), "[REDACTED]") {
+			t.Errorf("login error %q doesn't include the redacted response body", err)
+		}
+		for _, s := range []string{password, `hunter2\"secret`, "hunter2"} {
+			if strings.Contains(err.Error(), s) {
+				t.Errorf("login error %q contains the password", err)
+				break
+			}
+		}
+	}
+}
+
+func TestLoginCredsFromStdin(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.Write([]byte(`{"data": {"user": {"encrypted_token": "tok2"},
+			"babies": [{"Baby": {"baby_id": 2, "first_name": "Bo", "birthday": "2024/02/01"}}]}}`))
+	}))
+	defer srv.Close()
+	defer func(stdin io.Reader, secs []string) {
+		credsStdin, secrets = stdin, secs
+	}(credsStdin, secrets)
+	credsStdin = strings.NewReader(`{"email": " me@example.com\n", "password": "pw", "comment": "from vault"}`)
+
+	db := newTestDB(t)
+	if err := Login(context.Background(), db, LoginOptions{APIBase: srv.URL, CredsFile: "-"}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	// Extraneous keys and surrounding whitespace are dropped before sending.
+	if want := `{"email":"me@example.com","password":"pw"}`; body != want {
+		t.Errorf("login sent %s, want %s", body, want)
+	}
+}
+
+func TestLoginSharedBaby(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"user": {"encrypted_token": "tok2"},
+			"babies": [{"Baby": {"baby_id": 1, "first_name": "Ada", "last_name": "Renamed", "birthday": "2024/01/01"}}]}}`))
+	}))
+	defer srv.Close()
+	defer func(stdin io.Reader, secs []string) {
+		credsStdin, secrets = stdin, secs
+	}(credsStdin, secrets)
+	credsStdin = strings.NewReader(`{"email": "other@example.com", "password": "pw"}`)
+
+	// The test DB's baby is already stored with the default account.
+	db := newTestDB(t)
+	if err := Login(context.Background(), db, LoginOptions{APIBase: srv.URL, CredsFile: "-", Account: "other"}); err != nil {
+		t.Fatalf("login -account other with a shared baby: %v", err)
+	}
+	var account, last string
+	if err := db.QueryRow(`SELECT Account, LastName FROM Babies WHERE BabyID = 1`).Scan(&account, &last); err != nil {
+		t.Fatal(err)
+	}
+	if account != "" || last != "Renamed" {
+		t.Errorf("shared baby has account %q and last name %q, want %q and %q", account, last, "", "Renamed")
+	}
+}
+
+// newTestDB returns a freshly initialised DB with one baby and an auth token.
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "baby.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(initDB); err != nil {
+		t.Fatalf("Initialising DB: %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO Auth(Domain, Token) VALUES ("baby.glowing.com", "tok");
+		INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (1, "Ada", "Test", "2024-01-01");`)
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	return db
+}
+
+// fakePull serves resp for pull requests, as long as they are authorised.
+// It returns the server's base URL, and where it records the body of the last request.
+func fakePull(t *testing.T, resp string) (base string, req *string) {
+	req = new(string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "tok" {
+			http.Error(w, "bad auth", http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		*req = string(body)
+		w.Write([]byte(resp))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, req
+}
+
+func TestSync(t *testing.T) {
+	db := newTestDB(t)
+	base, _ := fakePull(t, `{"data": {
+		"babies": [{"baby_id": 1, "sync_token": "st1",
+			"BabyData": {"update": [{"id": 5, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000, "end_timestamp": 1704103600, "uuid": "u-5"}]},
+			"BabyFeedData": {"update": [
+				{"id": 6, "baby_id": 1, "feed_type": 2, "start_timestamp": 1704110000, "end_timestamp": 1704110900, "bottle_ml": 90},
+				{"id": 7, "baby_id": 1, "feed_type": 1, "start_timestamp": 1704120000, "breast_left_time": 600}]}}],
+		"insights": [{"id": 10, "baby_id": 1, "title": "Longest sleep this week", "create_time": 1704100000}],
+		"syncable_insights": [{"id": 10, "baby_id": 1, "title": "Longest sleep this week"}, {"id": 11, "title": "Another"}]
+	}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := Insights(context.Background(), db, &buf, QueryOptions{}); err != nil {
+		t.Fatalf("insights: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"Longest sleep this week", "Another"} {
+		if strings.Count(out, want) != 1 {
+			t.Errorf("insights output doesn't list %q once:\n%s", want, out)
+		}
+	}
+
+	var st string
+	if err := db.QueryRow(`SELECT SyncToken FROM Babies WHERE BabyID = 1`).Scan(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st != "st1" {
+		t.Errorf("SyncToken = %q, want %q", st, "st1")
+	}
+	var uuid string
+	if err := db.QueryRow(`SELECT UUID FROM BabyData WHERE ID = 5`).Scan(&uuid); err != nil {
+		t.Fatal(err)
+	}
+	if uuid != "u-5" {
+		t.Errorf("UUID = %q, want %q", uuid, "u-5")
+	}
+	feeds, err := loadFeeds(context.Background(), db, Selection{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ends [][2]int64
+	for _, f := range feeds {
+		ends = append(ends, [2]int64{f.end, f.endTime()})
+	}
+	// The bottle feed has an end time; the breast feed ends after its breast times.
+	if want := [][2]int64{{1704110900, 1704110900}, {0, 1704120600}}; !reflect.DeepEqual(ends, want) {
+		t.Errorf("Feed ends (recorded, used) = %v, want %v", ends, want)
+	}
+}
+
+// TestFeedEndTimestamp checks that every way of storing a feed keeps its end time,
+// or its lack of one, rather than shifting columns or leaving a stale value.
+func TestFeedEndTimestamp(t *testing.T) {
+	ends := func(db *sql.DB) map[int64]sql.NullInt64 {
+		t.Helper()
+		rows, err := db.Query(`SELECT ID, EndTimestamp FROM BabyFeedData`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		m := make(map[int64]sql.NullInt64)
+		for rows.Next() {
+			var id int64
+			var end sql.NullInt64
+			if err := rows.Scan(&id, &end); err != nil {
+				t.Fatal(err)
+			}
+			m[id] = end
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	db := newTestDB(t)
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1",
+		"BabyFeedData": {"update": [
+			{"id": 6, "baby_id": 1, "feed_type": 2, "start_timestamp": 1704110000, "end_timestamp": 1704110900, "bottle_ml": 90},
+			{"id": 7, "baby_id": 1, "feed_type": 2, "start_timestamp": 1704120000, "bottle_ml": 60}]}}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	want := map[int64]sql.NullInt64{6: {Int64: 1704110900, Valid: true}, 7: {}}
+	if got := ends(db); !reflect.DeepEqual(got, want) {
+		t.Errorf("after sync, feed ends = %v, want %v", got, want)
+	}
+
+	// An update without an end time clears it.
+	base, _ = fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st2",
+		"BabyFeedData": {"update": [{"id": 6, "baby_id": 1, "feed_type": 2, "start_timestamp": 1704110000, "bottle_ml": 90}]}}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	want[6] = sql.NullInt64{}
+	if got := ends(db); !reflect.DeepEqual(got, want) {
+		t.Errorf("after second sync, feed ends = %v, want %v", got, want)
+	}
+	if _, err := db.Exec(`UPDATE BabyFeedData SET EndTimestamp = 1704121000 WHERE ID = 7`); err != nil {
+		t.Fatal(err)
+	}
+	want[7] = sql.NullInt64{Int64: 1704121000, Valid: true}
+
+	// Records exported from one DB and imported into another keep them too.
+	var buf bytes.Buffer
+	if err := Export(context.Background(), db, "records", &buf, ExportOptions{}); err != nil {
+		t.Fatalf("export records: %v", err)
+	}
+	db2 := newTestDB(t)
+	if _, _, err := ImportRecords(context.Background(), db2, &buf, ImportOptions{}); err != nil {
+		t.Fatalf("importRecords: %v", err)
+	}
+	if got := ends(db2); !reflect.DeepEqual(got, want) {
+		t.Errorf("after export and import, feed ends = %v, want %v", got, want)
+	}
+}
+
+func TestSyncConditional(t *testing.T) {
+	db := newTestDB(t)
+	var reqs []string // If-None-Match of each pull
+	etag := `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqs = append(reqs, r.Header.Get("If-None-Match"))
+		if etag != "" {
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+		}
+		// The sync token doesn't change when nothing has.
+		w.Write([]byte(`{"data": {"babies": [{"baby_id": 1, "sync_token": "st1"}]}}`))
+	}))
+	defer srv.Close()
+	base := srv.URL
+
+	for i := 0; i < 3; i++ {
+		if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+			t.Fatalf("sync %d: %v", i+1, err)
+		}
+	}
+	// The first pull has a different sync token from the rest,
+	// so only the third is the same request as the one before.
+	if want := []string{"", "", `"v1"`}; !reflect.DeepEqual(reqs, want) {
+		t.Errorf("pulls had If-None-Match %q, want %q", reqs, want)
+	}
+	var syncs int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM SyncHistory WHERE Error IS NULL`).Scan(&syncs); err != nil {
+		t.Fatal(err)
+	}
+	if syncs != 3 {
+		t.Errorf("recorded %d successful syncs, want 3", syncs)
+	}
+
+	// -full always fetches everything.
+	reqs = nil
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Full: true}); err != nil {
+		t.Fatalf("sync -full: %v", err)
+	}
+	if reqs[0] != "" {
+		t.Errorf("sync -full sent If-None-Match %q, want none", reqs[0])
+	}
+
+	// Once the server stops giving validators, pulls stop being conditional.
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	etag, reqs = "", nil
+	for i := 0; i < 2; i++ {
+		if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+			t.Fatalf("sync without validators: %v", err)
+		}
+	}
+	if want := []string{`"v1"`, ""}; !reflect.DeepEqual(reqs, want) {
+		t.Errorf("after the server dropped ETags, pulls had If-None-Match %q, want %q", reqs, want)
+	}
+}
+
+func TestSyncNoBabies(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`DELETE FROM Babies`); err != nil {
+		t.Fatal(err)
+	}
+	base, req := fakePull(t, `{"data": {"babies": []}}`)
+	err := Sync(context.Background(), db, SyncOptions{APIBase: base})
+	if err == nil || !strings.Contains(err.Error(), "log in") {
+		t.Errorf("sync with no babies = %v, want an error about logging in", err)
+	}
+	if *req != "" {
+		t.Errorf("sync with no babies sent a pull request: %s", *req)
+	}
+}
+
+func TestSyncExpiredToken(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`UPDATE Auth SET Token = "old", LoginTimestamp = 1`); err != nil {
+		t.Fatal(err)
+	}
+	base, _ := fakePull(t, `{"data": {"babies": []}}`)
+	err := Sync(context.Background(), db, SyncOptions{APIBase: base})
+	if err == nil || !strings.Contains(err.Error(), "logging in again") {
+		t.Errorf("sync with a rejected token = %v, want an error suggesting logging in again", err)
+	}
+}
+
+func TestSyncImplausible(t *testing.T) {
+	resp := `{"data": {
+		"babies": [{"baby_id": 1,
+			"BabyData": {"update": [
+				{"id": 1, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000},
+				{"id": 2, "baby_id": 1, "key": "sleep", "start_timestamp": 0}]},
+			"BabyFeedData": {"update": [{"id": 3, "baby_id": 1, "start_timestamp": 4102444800}]}}]
+	}}`
+	for _, test := range []struct {
+		mode string
+		want int
+	}{
+		{"skip", 1},
+		{"keep", 3},
+	} {
+		db := newTestDB(t)
+		base, _ := fakePull(t, resp)
+		if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Implausible: test.mode}); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+		var n int
+		if err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM BabyData) + (SELECT COUNT(*) FROM BabyFeedData)`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != test.want {
+			t.Errorf("with -implausible %s, sync stored %d events, want %d", test.mode, n, test.want)
+		}
+	}
+}
+
+func TestSyncEncryptedToken(t *testing.T) {
+	db := newTestDB(t)
+	enc, err := encryptToken("tok", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE Auth SET Token = ?`, enc); err != nil {
+		t.Fatal(err)
+	}
+	base, _ := fakePull(t, `{"data": {"babies": []}}`)
+
+	t.Setenv(passphraseEnv, "wrong")
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("sync with the wrong passphrase = %v, want an error about the passphrase", err)
+	}
+	t.Setenv(passphraseEnv, "pass")
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Errorf("sync with an encrypted token: %v", err)
+	}
+}
+
+func TestSyncOnly(t *testing.T) {
+	db := newTestDB(t)
+	base, req := fakePull(t, `{"data": {
+		"babies": [{"baby_id": 1, "sync_token": "st2",
+			"BabyData": {"update": [
+				{"id": 1, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000},
+				{"id": 2, "baby_id": 1, "key": "diaper", "start_timestamp": 1704100000}]},
+			"BabyFeedData": {"update": [{"id": 3, "baby_id": 1, "start_timestamp": 1704100000}]}}],
+		"insights": [{"id": 10, "title": "Hi"}]
+	}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Only: "sleep"}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	var data, feeds, insights int
+	err := db.QueryRow(`SELECT (SELECT COUNT(*) FROM BabyData), (SELECT COUNT(*) FROM BabyFeedData), (SELECT COUNT(*) FROM Insights)`).Scan(&data, &feeds, &insights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != 1 || feeds != 0 || insights != 0 {
+		t.Errorf("with -only sleep, sync stored %d data, %d feeds and %d insights; want 1, 0 and 0", data, feeds, insights)
+	}
+	// The sync token still advances.
+	var st string
+	if err := db.QueryRow(`SELECT SyncToken FROM Babies WHERE BabyID = 1`).Scan(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st != "st2" {
+		t.Errorf("SyncToken = %q, want %q", st, "st2")
+	}
+
+	*req = ""
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Only: "sleep,naps"}); err == nil {
+		t.Errorf("sync with -only sleep,naps succeeded, want error")
+	}
+	if *req != "" {
+		t.Errorf("sync with bad -only sent a pull request")
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO Auth(Account, Domain, Token) VALUES ("other", "baby.glowing.com", "tok2");
+		INSERT INTO Babies(BabyID, Account, FirstName, LastName, Birthday) VALUES (2, "other", "Bob", "Test", "2024-02-01");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		account string
+		want    []int64
+	}{
+		{"", []int64{1, 2}},
+		{"other", []int64{2}},
+		{"nobody", nil},
+	} {
+		infos, err := loadBabies(context.Background(), db, test.account)
+		if err != nil {
+			t.Fatalf("loadBabies with account %q: %v", test.account, err)
+		}
+		var got []int64
+		for _, info := range infos {
+			got = append(got, info.babyID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("loadBabies with account %q gave babies %v, want %v", test.account, got, test.want)
+		}
+	}
+
+	// Syncing the default account should only use its own token and babies.
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1"}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	var st sql.NullString
+	if err := db.QueryRow(`SELECT SyncToken FROM Babies WHERE BabyID = 2`).Scan(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Valid {
+		t.Errorf("other account's baby got SyncToken %q", st.String)
+	}
+}
+
+func TestSyncInsightsAccounts(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO Auth(Account, Domain, Token) VALUES ("other", "baby.glowing.com", "tok");
+		INSERT INTO Babies(BabyID, Account, FirstName, LastName, Birthday) VALUES (2, "other", "Bob", "Test", "2024-02-01");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1"}],
+		"insights": [{"id": 10, "baby_id": 1, "title": "Ada's"}, {"id": 11, "title": "Ada's account"}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	base, _ = fakePull(t, `{"data": {"babies": [{"baby_id": 2, "sync_token": "st2"}],
+		"insights": [{"id": 20, "baby_id": 2, "title": "Bob's"}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Account: "other"}); err != nil {
+		t.Fatalf("sync -account other: %v", err)
+	}
+	var ids string
+	if err := db.QueryRow(`SELECT GROUP_CONCAT(ID) FROM (SELECT ID FROM Insights ORDER BY ID)`).Scan(&ids); err != nil {
+		t.Fatal(err)
+	}
+	if ids != "10,11,20" {
+		t.Errorf("after syncing both accounts, have insights %s, want 10,11,20", ids)
+	}
+
+	// Insights for one account lists only that account's.
+	var buf strings.Builder
+	if err := Insights(context.Background(), db, &buf, QueryOptions{Selection: Selection{Account: "other"}}); err != nil {
+		t.Fatalf("insights -account other: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "Bob's") || strings.Contains(out, "Ada's") {
+		t.Errorf("insights -account other listed:\n%s\nwant only the other account's", out)
+	}
+
+	// Syncing the first account again replaces only its own insights.
+	base, _ = fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st3"}],
+		"insights": [{"id": 12, "baby_id": 1, "title": "Ada's newer"}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := db.QueryRow(`SELECT GROUP_CONCAT(ID) FROM (SELECT ID FROM Insights ORDER BY ID)`).Scan(&ids); err != nil {
+		t.Fatal(err)
+	}
+	if ids != "12,20" {
+		t.Errorf("after syncing the first account again, have insights %s, want 12,20", ids)
+	}
+}
+
+func TestSyncFastSync(t *testing.T) {
+	db := newTestDB(t)
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1",
+		"BabyData": {"update": [{"id": 5, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000}]}}]}}`)
+	mode := func() int {
+		var n int
+		if err := db.QueryRow(`PRAGMA synchronous`).Scan(&n); err != nil {
+			t.Fatalf("Checking synchronous mode: %v", err)
+		}
+		return n
+	}
+	before := mode()
+	for _, m := range []string{"off", "normal"} {
+		if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Synchronous: m}); err != nil {
+			t.Fatalf("sync with -fast-sync %s: %v", m, err)
+		}
+		if got := mode(); got != before {
+			t.Errorf("After sync with -fast-sync %s, synchronous mode is %d, want it restored to %d", m, got, before)
+		}
+	}
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Synchronous: "sometimes"}); err == nil {
+		t.Errorf("sync with -fast-sync sometimes succeeded, want error")
+	}
+
+	// The mode lasts until restored.
+	restore, err := setSynchronous(context.Background(), db, "off")
+	if err != nil {
+		t.Fatalf("setSynchronous: %v", err)
+	}
+	if got := mode(); got != 0 {
+		t.Errorf("With -fast-sync off, synchronous mode is %d, want 0", got)
+	}
+	restore()
+}
+
+func TestAPIBase(t *testing.T) {
+	for _, test := range []struct {
+		in, want string // want "" for an error
+	}{
+		{"https://baby.glowing.com", "https://baby.glowing.com"},
+		{"http://localhost:8080/glow/", "http://localhost:8080/glow"},
+		{"baby.glowing.com", ""},
+		{"ftp://baby.glowing.com", ""},
+		{"https://", ""},
+	} {
+		u, err := apiBase(test.in)
+		switch {
+		case test.want == "" && err == nil:
+			t.Errorf("-api-base %q: got %v, want error", test.in, u)
+		case test.want != "" && err != nil:
+			t.Errorf("-api-base %q: %v", test.in, err)
+		case test.want != "" && u.String() != test.want:
+			t.Errorf("-api-base %q: got %v, want %s", test.in, u, test.want)
+		}
+	}
+
+	// A trailing slash doesn't break the request paths.
+	db := newTestDB(t)
+	base, _ := fakePull(t, `{"data": {"babies": []}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base + "/"}); err != nil {
+		t.Errorf("sync with -api-base %q: %v", base+"/", err)
+	}
+}
+
+func TestSyncAPIBaseWarnings(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+
+	db := newTestDB(t)
+	base, _ := fakePull(t, `{"data": {"babies": []}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	for _, want := range []string{"auth token was issued by baby.glowing.com", "isn't HTTPS"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("sync with -api-base %s logged %q, want it to contain %q", base, buf.String(), want)
+		}
+	}
+
+	// Once the token comes from the same host, only the lack of HTTPS is worth a warning.
+	buf.Reset()
+	if _, err := db.Exec(`UPDATE Auth SET Domain = ?`, strings.TrimPrefix(base, "http://")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if got := buf.String(); strings.Contains(got, "issued by") || !strings.Contains(got, "isn't HTTPS") {
+		t.Errorf("sync with -api-base %s from the token's own domain logged %q", base, got)
+	}
+}
+
+func TestSyncFull(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		UPDATE Babies SET SyncToken = "old-token";
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, Key) VALUES (99, 1, 1704100000, "sleep");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, req := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "new-token",
+		"BabyData": {"update": [{"id": 5, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000}]}}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Full: true}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if strings.Contains(*req, "old-token") {
+		t.Errorf("full sync sent the stored sync token: %s", *req)
+	}
+	var ids []int64
+	rows, err := db.Query(`SELECT ID FROM BabyData ORDER BY ID`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if !reflect.DeepEqual(ids, []int64{5}) {
+		t.Errorf("after full sync, BabyData has IDs %v, want [5]", ids)
+	}
+}
+
+func TestSyncFullOnly(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, Key) VALUES
+			(98, 1, 1704100000, "sleep"),
+			(99, 1, 1704100000, "diaper");
+		INSERT INTO BabyFeedData(ID, BabyID, StartTimestamp, FeedType) VALUES (97, 1, 1704100000, 2);
+		INSERT INTO Family(BabyID, UserID, FirstName) VALUES (1, 10, "Pat");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "new-token",
+		"BabyData": {"update": [
+			{"id": 5, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000},
+			{"id": 6, "baby_id": 1, "key": "diaper", "start_timestamp": 1704100000}]}}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Full: true, Only: "sleep"}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	// Only the sleeps are replaced; everything else is left alone.
+	var sleeps, diapers, feeds, family string
+	err = db.QueryRow(`SELECT
+		(SELECT GROUP_CONCAT(ID) FROM BabyData WHERE Key = "sleep"),
+		(SELECT GROUP_CONCAT(ID) FROM BabyData WHERE Key = "diaper"),
+		(SELECT GROUP_CONCAT(ID) FROM BabyFeedData),
+		(SELECT GROUP_CONCAT(UserID) FROM Family)`).Scan(&sleeps, &diapers, &feeds, &family)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sleeps != "5" || diapers != "99" || feeds != "97" || family != "10" {
+		t.Errorf("after -full -only sleep, have sleeps %s, diapers %s, feeds %s and family %s; want 5, 99, 97 and 10", sleeps, diapers, feeds, family)
+	}
+}
+
+func TestSyncSaveRaw(t *testing.T) {
+	db := newTestDB(t)
+	raw := filepath.Join(t.TempDir(), "raw.json")
+	defer func(secs []string) { secrets = secs }(secrets)
+
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1", "mystery": 42}], "user": {"encrypted_token": "tok"}}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, SaveRaw: raw}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	got, err := ioutil.ReadFile(raw)
+	if err != nil {
+		t.Fatalf("reading raw response: %v", err)
+	}
+	if !strings.Contains(string(got), `"mystery": 42`) {
+		t.Errorf("raw response is missing undecoded fields: %s", got)
+	}
+	if strings.Contains(string(got), `"tok"`) {
+		t.Errorf("raw response contains the auth token: %s", got)
+	}
+}
+
+func TestWriteFileMode(t *testing.T) {
+	// An existing file gets the new permissions.
+	path := filepath.Join(t.TempDir(), "out.png")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0600 {
+		t.Errorf("after WriteFile, file mode = %v, want %v", got, os.FileMode(0600))
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+
+	// A new file is fine, and nothing is left behind.
+	path := filepath.Join(dir, "new.png")
+	if err := CheckWritable(path); err != nil {
+		t.Errorf("CheckWritable of a new file: %v", err)
+	}
+	if fis, err := ioutil.ReadDir(dir); err != nil || len(fis) != 0 {
+		t.Errorf("CheckWritable left %d files behind (error %v)", len(fis), err)
+	}
+
+	// An existing file is fine, and isn't changed.
+	path = filepath.Join(dir, "old.png")
+	if err := ioutil.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckWritable(path); err != nil {
+		t.Errorf("CheckWritable of an existing file: %v", err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "old" {
+		t.Errorf("after CheckWritable, existing file has %q, %v; want it unchanged", b, err)
+	}
+
+	for _, test := range []struct {
+		bad, named string
+	}{
+		{filepath.Join(dir, "missing", "x.png"), filepath.Join(dir, "missing")},
+		{dir, dir}, // a directory
+	} {
+		err := CheckWritable(test.bad)
+		if err == nil {
+			t.Errorf("CheckWritable(%q) succeeded, want error", test.bad)
+		} else if !strings.Contains(err.Error(), test.named) {
+			t.Errorf("CheckWritable(%q) error %q doesn't name %s", test.bad, err, test.named)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	leftovers := func() []string {
+		t.Helper()
+		names, err := filepath.Glob(filepath.Join(dir, ".*.tmp*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	path := filepath.Join(dir, "out.csv")
+	for _, data := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != data {
+			t.Errorf("after WriteFile, file has %q, %v; want %q", b, err, data)
+		}
+	}
+
+	// If the file can't be put in place, the temporary file is removed.
+	// Renaming a file over a non-empty directory fails.
+	sub := filepath.Join(dir, "sub")
+	if err := os.MkdirAll(filepath.Join(sub, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(sub, []byte("third"), 0644); err == nil {
+		t.Errorf("WriteFile over a directory succeeded, want error")
+	}
+	if got := leftovers(); len(got) != 0 {
+		t.Errorf("WriteFile left temporary files behind: %q", got)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != "second" {
+		t.Errorf("after failed WriteFile elsewhere, file has %q, %v; want it unchanged", b, err)
+	}
+}
@@ -0,0 +1,375 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// measurement is a single weight (kg) or height (cm) reading.
+type measurement struct {
+	t     time.Time
+	value float64
+}
+
+// loadMeasurements loads a baby's readings with the given key
+// ("weight" or "height") within sel's -from/-to window, in chronological order,
+// with their times in loc.
+func loadMeasurements(ctx context.Context, db *sql.DB, sel Selection, babyID int64, key string, loc *time.Location) ([]measurement, error) {
+	from, to, err := sel.timeWindow()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, sel.inOrder(`
+		SELECT StartTimestamp, ValFloat FROM BabyData
+		WHERE BabyID = ? AND Key = ? AND StartTimestamp BETWEEN ? AND ? AND ValFloat > 0`), babyID, key, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s measurements: %w", key, err)
+	}
+	defer rows.Close()
+	var ms []measurement
+	for rows.Next() {
+		var ts int64
+		var m measurement
+		if err := rows.Scan(&ts, &m.value); err != nil {
+			return nil, fmt.Errorf("scanning %s measurements from DB: %w", key, err)
+		}
+		m.t = time.Unix(ts, 0).In(loc)
+		ms = append(ms, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading %s measurements from DB: %w", key, err)
+	}
+	return ms, nil
+}
+
+// growthRow is a baby's weight and height on one date.
+// Either may be zero if there was no reading close enough.
+type growthRow struct {
+	date     time.Time // midnight
+	weightKG float64
+	heightCM float64
+}
+
+// bmi reports the body mass index for the row, if it has both a weight and a height.
+func (gr growthRow) bmi() (float64, bool) {
+	if gr.weightKG <= 0 || gr.heightCM <= 0 {
+		return 0, false
+	}
+	m := gr.heightCM / 100
+	return gr.weightKG / (m * m), true
+}
+
+// growthRows returns a row for each date with a weight or height reading.
+// Each row has the reading nearest to its date of each kind,
+// if that is no more than maxDays calendar days away.
+// Of several equally near readings, the latest is used.
+// Weight and height are rarely measured on exactly the same day,
+// so a little tolerance is needed to compute BMI.
+func growthRows(weights, heights []measurement, maxDays int) []growthRow {
+	seen := make(map[time.Time]bool)
+	var dates []time.Time
+	for _, ms := range [][]measurement{weights, heights} {
+		for _, m := range ms {
+			y, mo, d := m.t.Date()
+			date := time.Date(y, mo, d, 0, 0, 0, 0, m.t.Location())
+			if !seen[date] {
+				seen[date] = true
+				dates = append(dates, date)
+			}
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	rows := make([]growthRow, 0, len(dates))
+	for _, date := range dates {
+		rows = append(rows, growthRow{
+			date:     date,
+			weightKG: nearestMeasurement(weights, date, maxDays),
+			heightCM: nearestMeasurement(heights, date, maxDays),
+		})
+	}
+	return rows
+}
+
+// nearestMeasurement returns the value of the reading nearest to date,
+// or zero if none is within maxDays days of it.
+func nearestMeasurement(ms []measurement, date time.Time, maxDays int) float64 {
+	var val float64
+	best := maxDays + 1
+	for _, m := range ms {
+		var days int
+		if m.t.Before(date) {
+			days = dayDiff(m.t, date)
+		} else {
+			days = dayDiff(date, m.t)
+		}
+		if days <= best {
+			best, val = days, m.value
+		}
+	}
+	if best > maxDays {
+		return 0
+	}
+	return val
+}
+
+// babyGrowth loads the growth rows for a baby within sel's -from/-to window,
+// pairing readings at most tolerance days apart, dated in the time zone of its birthday.
+func babyGrowth(ctx context.Context, db *sql.DB, sel Selection, info babyInfo, tolerance int) ([]growthRow, error) {
+	if tolerance < 0 {
+		return nil, fmt.Errorf("-growth-tolerance must not be negative")
+	}
+	weights, err := loadMeasurements(ctx, db, sel, info.babyID, "weight", info.birthday.Location())
+	if err != nil {
+		return nil, err
+	}
+	heights, err := loadMeasurements(ctx, db, sel, info.babyID, "height", info.birthday.Location())
+	if err != nil {
+		return nil, err
+	}
+	return growthRows(weights, heights, tolerance), nil
+}
+
+// growthStats lists a baby's growth readings by date.
+type growthStats struct {
+	Readings []growthReading `json:"readings"`
+}
+
+type growthReading struct {
+	Date     string   `json:"date"` // YYYY-MM-DD
+	AgeDays  int      `json:"age_days"`
+	WeightKG *float64 `json:"weight_kg"` // nil if no weight within -growth-tolerance
+	HeightCM *float64 `json:"height_cm"` // nil if no height within -growth-tolerance
+	BMI      *float64 `json:"bmi"`       // nil unless both are present
+}
+
+func statsGrowth(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	rows, err := babyGrowth(ctx, db, opts.Selection, info, opts.GrowthTolerance)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for growth stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	st := growthStats{Readings: []growthReading{}} // so JSON says [] rather than null
+	for _, gr := range rows {
+		if gr.date.Before(info.birthday) {
+			continue
+		}
+		rd := growthReading{Date: gr.date.Format("2006-01-02"), AgeDays: ageDays(info.birthday, gr.date)}
+		if gr.weightKG > 0 {
+			v := gr.weightKG
+			rd.WeightKG = &v
+		}
+		if gr.heightCM > 0 {
+			v := gr.heightCM
+			rd.HeightCM = &v
+		}
+		if bmi, ok := gr.bmi(); ok {
+			rd.BMI = &bmi
+		}
+		st.Readings = append(st.Readings, rd)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, st)
+	}
+	if len(st.Readings) == 0 {
+		fmt.Fprintf(w, "No weight or height recorded for %s %s.\n", info.firstName, info.lastName)
+		return nil
+	}
+	fmt.Fprintf(w, "Growth for %s %s, pairing readings up to %s apart\n", info.firstName, info.lastName, plural(opts.GrowthTolerance, "day"))
+	fmt.Fprintln(w, "Per date (date, age in days, weight, height, BMI):")
+	opt := func(v *float64, format string) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprintf(format, *v)
+	}
+	for _, rd := range st.Readings {
+		fmt.Fprintf(w, "\t%s\t%d\t%s\t%s\t%s\n", rd.Date, rd.AgeDays,
+			opt(rd.WeightKG, "%.3f kg"), opt(rd.HeightCM, "%.1f cm"), opt(rd.BMI, "%.1f"))
+	}
+	return nil
+}
+
+// Newborns normally lose weight for their first few days,
+// and take up to two weeks to regain it, so weight loss before this age isn't flagged.
+const newbornWeightLossDays = 14
+
+// growthVelocityStats reports how fast a baby is growing.
+type growthVelocityStats struct {
+	Weight []velocity `json:"weight"` // grams per week
+	Height []velocity `json:"height"` // centimetres per week
+
+	// The velocities over the most recent intervals; nil if there aren't any.
+	RecentWeight *float64 `json:"recent_weight_g_per_week"`
+	RecentHeight *float64 `json:"recent_height_cm_per_week"`
+}
+
+// velocity is the rate of change between two consecutive readings.
+type velocity struct {
+	From    string  `json:"from"` // YYYY-MM-DD
+	To      string  `json:"to"`   // YYYY-MM-DD
+	PerWeek float64 `json:"per_week"`
+	Concern string  `json:"concern,omitempty"` // why this looks worrying, if it does
+}
+
+// velocities computes the change between consecutive readings, scaled by
+// scale (e.g. 1000 for kg to g), per week. Readings on the same day as the
+// previous one are skipped, since their rate is meaningless.
+// Drops are flagged: any fall, except in weight while a newborn,
+// and a gain less than half the previous one.
+func velocities(ms []measurement, birthday time.Time, scale float64, weight bool) []velocity {
+	vs := []velocity{} // so JSON says [] rather than null
+	var prev *measurement
+	for i := range ms {
+		m := &ms[i]
+		if m.t.Before(birthday) {
+			continue
+		}
+		if prev == nil {
+			prev = m
+			continue
+		}
+		days := dayDiff(prev.t, m.t)
+		if days == 0 {
+			continue
+		}
+		v := velocity{
+			From:    prev.t.Format("2006-01-02"),
+			To:      m.t.Format("2006-01-02"),
+			PerWeek: (m.value - prev.value) * scale / float64(days) * 7,
+		}
+		switch {
+		case v.PerWeek < 0 && (!weight || ageDays(birthday, m.t) > newbornWeightLossDays):
+			v.Concern = "falling"
+		case len(vs) > 0 && vs[len(vs)-1].PerWeek > 0 && v.PerWeek < vs[len(vs)-1].PerWeek/2:
+			v.Concern = "less than half the previous rate"
+		}
+		vs = append(vs, v)
+		prev = m
+	}
+	return vs
+}
+
+func statsGrowthVelocity(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for growth velocity stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	weights, err := loadMeasurements(ctx, db, opts.Selection, info.babyID, "weight", plotLocation)
+	if err != nil {
+		return err
+	}
+	heights, err := loadMeasurements(ctx, db, opts.Selection, info.babyID, "height", plotLocation)
+	if err != nil {
+		return err
+	}
+	st := growthVelocityStats{
+		Weight: velocities(weights, info.birthday, 1000, true),
+		Height: velocities(heights, info.birthday, 1, false),
+	}
+	if n := len(st.Weight); n > 0 {
+		st.RecentWeight = &st.Weight[n-1].PerWeek
+	}
+	if n := len(st.Height); n > 0 {
+		st.RecentHeight = &st.Height[n-1].PerWeek
+	}
+
+	if opts.JSON {
+		return writeJSON(w, st)
+	}
+	if len(st.Weight) == 0 && len(st.Height) == 0 {
+		fmt.Fprintf(w, "Not enough weights or heights recorded for %s %s; need two of either on different days.\n", info.firstName, info.lastName)
+		return nil
+	}
+	fmt.Fprintf(w, "Growth velocity for %s %s\n", info.firstName, info.lastName)
+	for _, kind := range []struct {
+		name, format string
+		vs           []velocity
+		recent       *float64
+	}{
+		{"Weight", "%+.0f g/week", st.Weight, st.RecentWeight},
+		{"Height", "%+.2f cm/week", st.Height, st.RecentHeight},
+	} {
+		if kind.recent == nil {
+			fmt.Fprintf(w, "%s: not enough readings\n", kind.name)
+			continue
+		}
+		fmt.Fprintf(w, "%s: recently "+kind.format+"\n", kind.name, *kind.recent)
+		fmt.Fprintln(w, "Per interval (from, to, rate):")
+		for _, v := range kind.vs {
+			line := fmt.Sprintf("\t%s\t%s\t"+kind.format, v.From, v.To, v.PerWeek)
+			if v.Concern != "" {
+				line += "\tCONCERN: " + v.Concern
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
+
+// growthTable returns the selected baby's weights and heights for export,
+// one row per measurement date, for handing to a doctor.
+// With opts.Sex, each has its WHO percentile (see whoPercentile).
+// Missing values are left empty, as are percentiles past the WHO tables' 24 months.
+// Dates are in loc.
+func growthTable(ctx context.Context, db *sql.DB, loc *time.Location, opts ExportOptions) (header []string, table [][]string, err error) {
+	// Glow doesn't tell us the baby's sex, and the standards differ by it.
+	var weightStd, lengthStd []whoLMS
+	if opts.Sex != "" {
+		if weightStd, lengthStd, err = whoStandards(opts.Sex); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		log.Printf("Leaving out WHO percentiles; set -sex to include them")
+	}
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, nil, err
+	}
+	info = info.in(loc)
+	rows, err := babyGrowth(ctx, db, opts.Selection, info, opts.GrowthTolerance)
+	if err != nil {
+		return nil, nil, err
+	}
+	header = []string{"date", "age_days", "weight_kg", "height_cm", "bmi", "weight_percentile", "height_percentile"}
+	for _, gr := range rows {
+		if gr.date.Before(info.birthday) {
+			continue
+		}
+		age := ageDays(info.birthday, gr.date)
+		rec := []string{gr.date.Format("2006-01-02"), strconv.Itoa(age), "", "", "", "", ""}
+		if gr.weightKG > 0 {
+			rec[2] = strconv.FormatFloat(gr.weightKG, 'f', 3, 64)
+			if p, ok := whoPercentile(weightStd, age, gr.weightKG); ok {
+				rec[5] = strconv.FormatFloat(p, 'f', 1, 64)
+			}
+		}
+		if gr.heightCM > 0 {
+			rec[3] = strconv.FormatFloat(gr.heightCM, 'f', 1, 64)
+			if p, ok := whoPercentile(lengthStd, age, gr.heightCM); ok {
+				rec[6] = strconv.FormatFloat(p, 'f', 1, 64)
+			}
+		}
+		if bmi, ok := gr.bmi(); ok {
+			rec[4] = strconv.FormatFloat(bmi, 'f', 1, 64)
+		}
+		table = append(table, rec)
+	}
+	return header, table, nil
+}
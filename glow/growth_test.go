@@ -0,0 +1,126 @@
+package glow
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrowthRows(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 10, 0, 0, 0, time.Local) }
+	weights := []measurement{{day(1), 4.0}, {day(10), 4.5}}
+	heights := []measurement{{day(3), 55}, {day(20), 58}}
+	got := growthRows(weights, heights, 7)
+	want := []struct {
+		day            int
+		weight, height float64
+	}{
+		{1, 4.0, 55},
+		{3, 4.0, 55},
+		{10, 4.5, 55}, // height from day 3 is exactly a week away
+		{20, 0, 58},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("growthRows returned %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		gr := got[i]
+		if gr.date.Day() != w.day || gr.weightKG != w.weight || gr.heightCM != w.height {
+			t.Errorf("row %d = {%s %v %v}, want {day %d %v %v}", i, gr.date.Format("2006-01-02"), gr.weightKG, gr.heightCM, w.day, w.weight, w.height)
+		}
+	}
+	if bmi, ok := got[0].bmi(); !ok || fmt.Sprintf("%.2f", bmi) != "13.22" {
+		t.Errorf("row 0 BMI = %v, %t; want 13.22, true", bmi, ok)
+	}
+	if _, ok := got[3].bmi(); ok {
+		t.Errorf("row 3 has a BMI without a weight")
+	}
+}
+
+func TestExportGrowth(t *testing.T) {
+	db := newTestDB(t)
+	// The test baby was born on 2024-01-01.
+	jan := func(d int) int64 { return time.Date(2024, time.January, d, 12, 0, 0, 0, time.Local).Unix() }
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, Key, ValFloat) VALUES
+			(1, 1, %d, "weight", 3.5),
+			(2, 1, %d, "height", 51),
+			(3, 1, %d, "weight", 4.25);`, jan(1), jan(2), jan(30)))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	opts := ExportOptions{GrowthTolerance: 7}
+	var buf strings.Builder
+	if err := Export(context.Background(), db, "growth", &buf, opts); err != nil {
+		t.Fatalf("export growth: %v", err)
+	}
+	want := `date,age_days,weight_kg,height_cm,bmi,weight_percentile,height_percentile
+2024-01-01,0,3.500,51.0,13.5,,
+2024-01-02,1,3.500,51.0,13.5,,
+2024-01-30,29,4.250,,,,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export growth wrote\n%s\nwant\n%s", got, want)
+	}
+
+	opts.Sex = "girl"
+	buf.Reset()
+	if err := Export(context.Background(), db, "growth", &buf, opts); err != nil {
+		t.Fatalf("export growth with -sex: %v", err)
+	}
+	want = `date,age_days,weight_kg,height_cm,bmi,weight_percentile,height_percentile
+2024-01-01,0,3.500,51.0,13.5,71.6,84.0
+2024-01-02,1,3.500,51.0,13.5,69.2,81.9
+2024-01-30,29,4.250,,,57.4,
+`
+	if got := buf.String(); got != want {
+		t.Errorf("export growth with -sex %s wrote\n%s\nwant\n%s", opts.Sex, got, want)
+	}
+
+	opts.Sex = "unknown"
+	if err := Export(context.Background(), db, "growth", &buf, opts); err == nil {
+		t.Errorf("export growth with -sex %s succeeded, want error", opts.Sex)
+	}
+}
+
+func TestVelocities(t *testing.T) {
+	birthday := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local)
+	day := func(d int) time.Time { return birthday.AddDate(0, 0, d).Add(10 * time.Hour) }
+	weights := []measurement{
+		{day(0), 3.5},
+		{day(4), 3.3},  // newborn weight loss; fine
+		{day(4), 3.31}, // same day; skipped
+		{day(18), 3.8},
+		{day(25), 4.0},
+		{day(32), 4.05}, // slowing sharply
+		{day(39), 4.0},  // falling
+	}
+	got := velocities(weights, birthday, 1000, true)
+	want := []struct {
+		perWeek float64
+		concern string
+	}{
+		{-350, ""},
+		{250, ""},
+		{200, ""},
+		{50, "less than half the previous rate"},
+		{-50, "falling"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("velocities returned %d intervals, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if math.Abs(got[i].PerWeek-w.perWeek) > 1e-6 || got[i].Concern != w.concern {
+			t.Errorf("interval %d (%s to %s) = %v g/week, concern %q; want %v, %q",
+				i, got[i].From, got[i].To, got[i].PerWeek, got[i].Concern, w.perWeek, w.concern)
+		}
+	}
+
+	heights := []measurement{{day(0), 50}, {day(7), 49.5}}
+	if got := velocities(heights, birthday, 1, false); len(got) != 1 || got[0].Concern != "falling" {
+		t.Errorf("velocities of a shrinking newborn = %+v, want one falling interval", got)
+	}
+}
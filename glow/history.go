@@ -0,0 +1,141 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	syncHistoryKeep  = 100 // syncs to keep in SyncHistory
+	syncHistoryShown = 10  // syncs listed by sync-log
+)
+
+// recordSync adds a sync that started at start to SyncHistory,
+// with the number of records of each kind in its pull response,
+// and prunes the oldest entries.
+// syncErr is how the sync failed, if it did.
+func recordSync(ctx context.Context, db *sql.DB, opts SyncOptions, start time.Time, pullResp PullResponse, syncErr error) error {
+	var dataUpdates, dataRemoves, feedUpdates, feedRemoves, insights int
+	for _, baby := range pullResp.Data.Babies {
+		dataUpdates += len(baby.BabyData.Update)
+		dataRemoves += len(baby.BabyData.Remove)
+		feedUpdates += len(baby.BabyFeedData.Update)
+		feedRemoves += len(baby.BabyFeedData.Remove)
+	}
+	for _, list := range []*[]Insight{pullResp.Data.Insights, pullResp.Data.SyncableInsights} {
+		if list != nil {
+			insights += len(*list)
+		}
+	}
+	var errText sql.NullString
+	if syncErr != nil {
+		errText = sqlNullString(redact(syncErr.Error()))
+	}
+
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO SyncHistory(Account, StartTimestamp, DurationMS, Full,
+			DataUpdates, DataRemoves, FeedUpdates, FeedRemoves, Insights, Error)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		opts.Account, start.Unix(), time.Since(start).Milliseconds(), opts.Full,
+		dataUpdates, dataRemoves, feedUpdates, feedRemoves, insights, errText)
+	if err != nil {
+		return fmt.Errorf("recording sync in DB: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM SyncHistory WHERE ID NOT IN
+		(SELECT ID FROM SyncHistory ORDER BY ID DESC LIMIT ?)`, syncHistoryKeep)
+	if err != nil {
+		return fmt.Errorf("pruning sync history: %w", err)
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return nil
+}
+
+// syncLogResult is the output of sync-log.
+type syncLogResult struct {
+	Syncs []syncRecord `json:"syncs"`
+}
+
+type syncRecord struct {
+	Account         string    `json:"account,omitempty"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Full            bool      `json:"full"`
+	DataUpdates     int       `json:"data_updates"`
+	DataRemoves     int       `json:"data_removes"`
+	FeedUpdates     int       `json:"feed_updates"`
+	FeedRemoves     int       `json:"feed_removes"`
+	Insights        int       `json:"insights"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// SyncLog lists the most recent syncs, newest first.
+func SyncLog(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT Account, StartTimestamp, DurationMS, Full,
+			DataUpdates, DataRemoves, FeedUpdates, FeedRemoves, Insights, Error
+		FROM SyncHistory ORDER BY ID DESC LIMIT ?`, syncHistoryShown)
+	if err != nil {
+		return fmt.Errorf("loading sync history: %w", err)
+	}
+	defer rows.Close()
+	res := syncLogResult{Syncs: []syncRecord{}} // so JSON says [] rather than null
+	for rows.Next() {
+		var rec syncRecord
+		var start, ms int64
+		var errText sql.NullString
+		err := rows.Scan(&rec.Account, &start, &ms, &rec.Full,
+			&rec.DataUpdates, &rec.DataRemoves, &rec.FeedUpdates, &rec.FeedRemoves, &rec.Insights, &errText)
+		if err != nil {
+			return fmt.Errorf("scanning sync history from DB: %w", err)
+		}
+		rec.Start = time.Unix(start, 0).In(time.Local)
+		rec.DurationSeconds = float64(ms) / 1000
+		rec.Error = errText.String
+		res.Syncs = append(res.Syncs, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading sync history from DB: %w", err)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, res)
+	}
+	if len(res.Syncs) == 0 {
+		fmt.Fprintln(w, "No syncs recorded yet.")
+		return nil
+	}
+	fmt.Fprintln(w, "Recent syncs (start, duration, data +updates/-removes, feeds +updates/-removes, insights):")
+	for _, rec := range res.Syncs {
+		line := fmt.Sprintf("\t%s\t%v\t+%d/-%d\t+%d/-%d\t%d", rec.Start.Format("2006-01-02 15:04:05"),
+			time.Duration(rec.DurationSeconds*float64(time.Second)).Round(100*time.Millisecond),
+			rec.DataUpdates, rec.DataRemoves, rec.FeedUpdates, rec.FeedRemoves, rec.Insights)
+		if rec.Account != "" {
+			line += "\taccount " + rec.Account
+		}
+		if rec.Full {
+			line += "\tfull"
+		}
+		if rec.Error != "" {
+			line += "\tFAILED: " + rec.Error
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package glow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncHistory(t *testing.T) {
+	db := newTestDB(t)
+	base, _ := fakePull(t, `{"data": {
+		"babies": [{"baby_id": 1, "sync_token": "st1",
+			"BabyData": {"update": [{"id": 5, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000, "end_timestamp": 1704103600}]},
+			"BabyFeedData": {"remove": [{"id": 6, "baby_id": 1}]}}]
+	}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := SyncLog(context.Background(), db, &buf, QueryOptions{}); err != nil {
+		t.Fatalf("syncLog: %v", err)
+	}
+	if out := buf.String(); !strings.Contains(out, "\t+1/-0\t+0/-1\t0") {
+		t.Errorf("sync-log output doesn't show the sync's counts:\n%s", out)
+	}
+
+	// Failures are recorded, and old entries pruned.
+	ctx := context.Background()
+	for i := 0; i < syncHistoryKeep+5; i++ {
+		if err := recordSync(ctx, db, SyncOptions{}, time.Now(), PullResponse{}, errors.New("oops")); err != nil {
+			t.Fatalf("recordSync: %v", err)
+		}
+	}
+	var n, failed int
+	if err := db.QueryRow(`SELECT COUNT(*), COUNT(Error) FROM SyncHistory`).Scan(&n, &failed); err != nil {
+		t.Fatal(err)
+	}
+	if n != syncHistoryKeep || failed != syncHistoryKeep {
+		t.Errorf("after many syncs, SyncHistory has %d rows with %d failures, want %d of each", n, failed, syncHistoryKeep)
+	}
+}
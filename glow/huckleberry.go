@@ -0,0 +1,223 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Huckleberry exports a CSV file with a header row and one row per event.
+// The columns used, found by name, are:
+//
+//	Type             "Sleep", "Feed" or "Diaper"; other types are skipped
+//	Start, End       local times, as "2006-01-02 15:04"; End is empty for instant events
+//	Start Location   for feeds, "Breast", "Bottle" or "Solids"
+//	Start Condition  for breast feeds, the left time, as "MM:SSL";
+//	                 for diapers, what was in it ("Pee", "Poo" or "Both")
+//	End Condition    for breast feeds, the right time, as "MM:SSR";
+//	                 for bottle feeds, the amount, as "120ml" or "4oz"
+//	Notes            kept for diapers
+//
+// These map to BabyData rows with key "sleep" or "diaper" (with the condition
+// and any notes in ValStr), and BabyFeedData rows of the corresponding type,
+// which keep their end time if they have one.
+// Times are read in ImportOptions.Timezone, or the local time zone if that isn't set.
+//
+// Imported rows get negative IDs, which Glow never uses, derived from their
+// contents, so importing the same file again replaces rather than duplicates them.
+// A -full sync keeps them.
+
+// huckleberryTimeLayout is the format of Huckleberry's Start and End columns.
+const huckleberryTimeLayout = "2006-01-02 15:04"
+
+var huckleberryBreastTime = regexp.MustCompile(`^(\d+):(\d\d)\s*([LR])$`)
+
+// HuckleberryCounts reports what ImportHuckleberry did.
+type HuckleberryCounts struct {
+	Sleeps, Feeds, Diapers int // events imported
+	Skipped                int // rows of other types, or without a start time
+}
+
+// ImportHuckleberry imports a Huckleberry CSV export for the baby selected by opts.
+func ImportHuckleberry(ctx context.Context, db *sql.DB, r io.Reader, opts ImportOptions) (HuckleberryCounts, error) {
+	var hc HuckleberryCounts
+	info, err := loadBaby(ctx, db, Selection{Account: opts.Account, Baby: opts.Baby})
+	if err != nil {
+		return hc, err
+	}
+	log.Printf("Importing into %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	loc := time.Local
+	if opts.Timezone != "" {
+		if loc, err = time.LoadLocation(opts.Timezone); err != nil {
+			return hc, fmt.Errorf("bad -import-tz: %w", err)
+		}
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // trailing empty columns are sometimes left off
+	header, err := cr.Read()
+	if err != nil {
+		return hc, fmt.Errorf("reading CSV header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, name := range []string{"Type", "Start"} {
+		if _, ok := cols[name]; !ok {
+			return hc, fmt.Errorf("CSV has no %q column; is it a Huckleberry export?", name)
+		}
+	}
+
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return hc, fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return hc, fmt.Errorf("reading CSV: %w", err)
+		}
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		start, err := time.ParseInLocation(huckleberryTimeLayout, get("Start"), loc)
+		if err != nil {
+			return hc, fmt.Errorf("line %d: bad start time: %w", line, err)
+		}
+		var end sql.NullInt64
+		if v := get("End"); v != "" {
+			t, err := time.ParseInLocation(huckleberryTimeLayout, v, loc)
+			if err != nil {
+				return hc, fmt.Errorf("line %d: bad end time: %w", line, err)
+			}
+			end = sql.NullInt64{Int64: t.Unix(), Valid: true}
+		}
+		id := huckleberryID(info.babyID, rec)
+
+		switch typ := get("Type"); typ {
+		default:
+			hc.Skipped++
+		case "Sleep":
+			if !end.Valid {
+				// Still asleep when exported; there's nothing useful to store yet.
+				hc.Skipped++
+				continue
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT OR REPLACE INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key, ValStr)
+				VALUES(?, ?, ?, ?, "sleep", "")`, id, info.babyID, start.Unix(), end)
+			hc.Sleeps++
+		case "Diaper":
+			what := get("Start Condition")
+			if notes := get("Notes"); notes != "" {
+				what = strings.TrimSpace(what + "; " + notes)
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT OR REPLACE INTO BabyData(ID, BabyID, StartTimestamp, Key, ValStr)
+				VALUES(?, ?, ?, "diaper", ?)`, id, info.babyID, start.Unix(), what)
+			hc.Diapers++
+		case "Feed":
+			f, ok, ferr := huckleberryFeed(get("Start Location"), get("Start Condition"), get("End Condition"))
+			if ferr != nil {
+				return hc, fmt.Errorf("line %d: %w", line, ferr)
+			}
+			if !ok {
+				hc.Skipped++
+				continue
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT OR REPLACE INTO BabyFeedData(ID, BabyID, StartTimestamp, EndTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML)
+				VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`, id, info.babyID, start.Unix(), end, int64(f.typ), f.breastUsed, f.left, f.right, f.bottleML)
+			hc.Feeds++
+		}
+		if err != nil {
+			return hc, fmt.Errorf("line %d: storing in DB: %w", line, err)
+		}
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return hc, fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return hc, nil
+}
+
+// huckleberryFeed interprets the columns of a Huckleberry feed.
+// It reports false for kinds of feed that aren't understood.
+func huckleberryFeed(location, startCond, endCond string) (f feed, ok bool, err error) {
+	switch location {
+	default:
+		return feed{}, false, nil
+	case "Breast":
+		f.typ = FeedBreast
+		for _, cond := range []string{startCond, endCond} {
+			if cond == "" {
+				continue
+			}
+			m := huckleberryBreastTime.FindStringSubmatch(cond)
+			if m == nil {
+				return feed{}, false, fmt.Errorf("bad breast feed time %q", cond)
+			}
+			mins, _ := strconv.ParseInt(m[1], 10, 64)
+			secs, _ := strconv.ParseInt(m[2], 10, 64)
+			if m[3] == "L" {
+				f.left += 60*mins + secs
+			} else {
+				f.right += 60*mins + secs
+			}
+		}
+		switch {
+		case f.left > 0 && f.right > 0:
+			f.breastUsed = "B"
+		case f.left > 0:
+			f.breastUsed = "L"
+		case f.right > 0:
+			f.breastUsed = "R"
+		}
+	case "Bottle":
+		f.typ = FeedBottle
+		amount := strings.ToLower(strings.ReplaceAll(endCond, " ", ""))
+		scale := 1.0
+		if strings.HasSuffix(amount, "oz") {
+			scale = mlPerFluidOunce
+		}
+		amount = strings.TrimRight(amount, "mloz")
+		if amount != "" {
+			v, err := strconv.ParseFloat(amount, 64)
+			if err != nil {
+				return feed{}, false, fmt.Errorf("bad bottle amount %q", endCond)
+			}
+			f.bottleML = v * scale
+		}
+	case "Solids":
+		f.typ = FeedSolids
+	}
+	return f, true, nil
+}
+
+// huckleberryID returns a negative ID for an imported row,
+// which is the same each time the same row is imported for the same baby.
+func huckleberryID(babyID int64, rec []string) int64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "huckleberry\x00%d\x00%s", babyID, strings.Join(rec, "\x00"))
+	return -int64(h.Sum64()>>2) - 1 // in [-2^62, -1]
+}
@@ -0,0 +1,88 @@
+package glow
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestImportHuckleberry(t *testing.T) {
+	db := newTestDB(t)
+	const csv = "\ufeffType,Start,End,Duration,Start Condition,Start Location,End Condition,Notes\n" +
+		"Sleep,2024-01-01 20:00,2024-01-01 22:30,02:30,,,,\n" +
+		"Feed,2024-01-01 19:00,2024-01-01 19:15,00:15,10:00L,Breast,05:00R,\n" +
+		"Feed,2024-01-02 12:00,,,,Bottle,4oz,\n" +
+		"Feed,2024-01-02 17:00,,,,Solids,,carrot\n" +
+		"Diaper,2024-01-02 08:00,,,Both,,,big one\n" +
+		"Growth,2024-01-02 09:00,,,,,,\n" +
+		"Sleep,2024-01-02 21:00,,,,,,\n"
+	for i := 0; i < 2; i++ { // the second import should change nothing
+		hc, err := ImportHuckleberry(context.Background(), db, strings.NewReader(csv), ImportOptions{})
+		if err != nil {
+			t.Fatalf("importHuckleberry: %v", err)
+		}
+		if want := (HuckleberryCounts{Sleeps: 1, Feeds: 3, Diapers: 1, Skipped: 2}); hc != want {
+			t.Errorf("importHuckleberry counted %+v, want %+v", hc, want)
+		}
+	}
+
+	var buf strings.Builder
+	if err := Export(context.Background(), db, "events", &buf, ExportOptions{Format: "md"}); err != nil {
+		t.Fatalf("export events: %v", err)
+	}
+	want := `| time             | type   | details                        |
+| ---------------- | ------ | ------------------------------ |
+| 2024-01-01 19:00 | feed   | breast, left 10m0s, right 5m0s |
+| 2024-01-01 20:00 | sleep  | 2h30m0s                        |
+| 2024-01-02 08:00 | diaper | Both; big one                  |
+| 2024-01-02 12:00 | feed   | bottle, 118 ml                 |
+| 2024-01-02 17:00 | feed   | solids                         |
+`
+	if got := buf.String(); got != want {
+		t.Errorf("after import, export events wrote\n%s\nwant\n%s", got, want)
+	}
+
+	var ids int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM BabyData WHERE ID >= 0`).Scan(&ids); err != nil {
+		t.Fatalf("Counting IDs: %v", err)
+	}
+	if ids != 0 {
+		t.Errorf("%d imported rows have non-negative IDs", ids)
+	}
+
+	for _, bad := range []string{
+		"Kind,When\nSleep,2024-01-01 20:00\n",
+		"Type,Start\nSleep,yesterday\n",
+		"Type,Start,Start Location,Start Condition\nFeed,2024-01-01 19:00,Breast,ten minutes\n",
+	} {
+		if _, err := ImportHuckleberry(context.Background(), db, strings.NewReader(bad), ImportOptions{}); err == nil {
+			t.Errorf("ImportHuckleberry(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestImportHuckleberryFullSync(t *testing.T) {
+	db := newTestDB(t)
+	const csv = "Type,Start,End,Start Location,End Condition\n" +
+		"Sleep,2024-01-01 20:00,2024-01-01 22:30,,\n" +
+		"Feed,2024-01-02 12:00,,Bottle,4oz\n"
+	if _, err := ImportHuckleberry(context.Background(), db, strings.NewReader(csv), ImportOptions{}); err != nil {
+		t.Fatalf("importHuckleberry: %v", err)
+	}
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1",
+		"BabyData": {"update": [{"id": 5, "baby_id": 1, "key": "sleep", "start_timestamp": 1704100000}]}}]}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base, Full: true}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	var imported, synced, feeds int
+	err := db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM BabyData WHERE ID < 0),
+		(SELECT COUNT(*) FROM BabyData WHERE ID > 0),
+		(SELECT COUNT(*) FROM BabyFeedData WHERE ID < 0)`).Scan(&imported, &synced, &feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 1 || synced != 1 || feeds != 1 {
+		t.Errorf("after full sync, have %d imported and %d synced sleeps, and %d imported feeds; want 1, 1 and 1", imported, synced, feeds)
+	}
+}
@@ -0,0 +1,186 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ImportOptions controls an import. The CLI sets them from flags (see importOptionsFromFlags).
+type ImportOptions struct {
+	Account  string // if set, only import into babies in this Auth account
+	Baby     string // for Huckleberry, the ID of the baby to import into, or "" for the first one
+	Format   string // for records, the format they were exported in, "csv" (the default) or "json"
+	Timezone string // for Huckleberry, the time zone of its times, if not the local one
+}
+
+// readTable reads a table written by export in the given format,
+// returning each row keyed by column name.
+func readTable(r io.Reader, format string) ([]map[string]string, error) {
+	switch format {
+	default:
+		return nil, fmt.Errorf("unsupported -format %q for import; want \"csv\" or \"json\"", format)
+	case "", "csv":
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("reading CSV header: %w", err)
+		}
+		var rows []map[string]string
+		for {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("reading CSV: %w", err)
+			}
+			row := make(map[string]string)
+			for i, cell := range rec {
+				row[header[i]] = cell
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case "json":
+		var v struct {
+			Rows []map[string]string `json:"rows"`
+		}
+		if err := json.NewDecoder(r).Decode(&v); err != nil {
+			return nil, fmt.Errorf("reading JSON: %w", err)
+		}
+		return v.Rows, nil
+	}
+}
+
+// ImportRecords reads rows in the format of "export records" and stores them,
+// replacing any existing rows with the same ID. It reports how many rows
+// were new and how many replaced existing ones. Nothing is stored unless
+// every row is valid.
+func ImportRecords(ctx context.Context, db *sql.DB, r io.Reader, opts ImportOptions) (added, updated int, err error) {
+	rows, err := readTable(r, opts.Format)
+	if err != nil {
+		return 0, 0, err
+	}
+	known := make(map[string]bool)
+	for _, c := range recordColumns {
+		known[c] = true
+	}
+	babies := make(map[int64]bool)
+	infos, err := loadBabies(ctx, db, opts.Account)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, info := range infos {
+		babies[info.babyID] = true
+	}
+
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	for n, row := range rows {
+		rowErr := func(format string, args ...interface{}) error {
+			return fmt.Errorf("row %d: %s", n+1, fmt.Sprintf(format, args...))
+		}
+		for col := range row {
+			if !known[col] {
+				return 0, 0, rowErr("unknown column %q; is this from \"export records\"?", col)
+			}
+		}
+		// Empty numeric cells are NULL. Empty text cells are "",
+		// as sync stores them, except for UUIDs, which sync leaves NULL.
+		// Sync never leaves the breast columns NULL, so they are 0 if empty.
+		var bad string
+		num := func(col string) sql.NullInt64 {
+			if row[col] == "" {
+				return sql.NullInt64{}
+			}
+			v, err := strconv.ParseInt(row[col], 10, 64)
+			if err != nil && bad == "" {
+				bad = col
+			}
+			return sql.NullInt64{Int64: v, Valid: err == nil}
+		}
+		flt := func(col string) sql.NullFloat64 {
+			if row[col] == "" {
+				return sql.NullFloat64{}
+			}
+			v, err := strconv.ParseFloat(row[col], 64)
+			if err != nil && bad == "" {
+				bad = col
+			}
+			return sql.NullFloat64{Float64: v, Valid: err == nil}
+		}
+		id, babyID, start, end := num("id"), num("baby_id"), num("start"), num("end")
+		uuid := sql.NullString{String: row["uuid"], Valid: row["uuid"] != ""}
+		if bad != "" {
+			return 0, 0, rowErr("bad %s %q", bad, row[bad])
+		}
+		switch {
+		case !id.Valid || id.Int64 == 0:
+			return 0, 0, rowErr("missing id")
+		case !babies[babyID.Int64]:
+			return 0, 0, rowErr("unknown baby_id %q; sync that baby first", row["baby_id"])
+		case !start.Valid || start.Int64 <= 0:
+			return 0, 0, rowErr("missing start")
+		case end.Valid && end.Int64 < start.Int64:
+			return 0, 0, rowErr("end is before start")
+		}
+
+		var table string
+		var args []interface{}
+		switch row["table"] {
+		default:
+			return 0, 0, rowErr("bad table %q; want \"data\" or \"feed\"", row["table"])
+		case "data":
+			table = "BabyData"
+			args = []interface{}{id, babyID, start, end, uuid,
+				row["key"], num("val_int"), flt("val_float"), row["val_str"]}
+		case "feed":
+			table = "BabyFeedData"
+			args = []interface{}{id, babyID, start, end, uuid,
+				num("feed_type"), row["breast_used"], num("breast_left").Int64, num("breast_right").Int64,
+				flt("bottle_ml"), flt("pump_left_ml"), flt("pump_right_ml")}
+		}
+		if bad != "" {
+			return 0, 0, rowErr("bad %s %q", bad, row[bad])
+		}
+
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM `+table+` WHERE ID = ?`, id).Scan(&exists); err != nil {
+			return 0, 0, fmt.Errorf("checking for existing row: %w", err)
+		}
+		if table == "BabyData" {
+			_, err = tx.ExecContext(ctx, `
+				INSERT OR REPLACE INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, UUID, Key, ValInt, ValFloat, ValStr)
+				VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				INSERT OR REPLACE INTO BabyFeedData(ID, BabyID, StartTimestamp, EndTimestamp, UUID, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML, PumpLeftML, PumpRightML)
+				VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, args...)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("row %d: storing in DB: %w", n+1, err)
+		}
+		if exists {
+			updated++
+		} else {
+			added++
+		}
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return added, updated, nil
+}
@@ -0,0 +1,84 @@
+package glow
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestImportRecords(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key, ValInt, ValFloat, ValStr, UUID) VALUES
+			(1, 1, 1704140000, 1704147200, "sleep", NULL, NULL, "", "abc-123"),
+			(2, 1, 1704150000, NULL, "weight", 0, 3.456789012345, "", NULL),
+			(3, 1, 1704160000, NULL, "medicine", 0, 0, "Calpol, 2.5ml ""strawberry""", NULL);
+		INSERT INTO BabyFeedData(ID, BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML, PumpLeftML, PumpRightML) VALUES
+			(1, 1, 1704141000, 1, "B", 600, 300, 0, NULL, NULL),
+			(2, 1, 1704142000, 4, "", 0, 0, 0, 60.5, 55.25);`)
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	exportRecords := func(format string) string {
+		t.Helper()
+		var buf strings.Builder
+		if err := Export(context.Background(), db, "records", &buf, ExportOptions{Format: format}); err != nil {
+			t.Fatalf("export records: %v", err)
+		}
+		return buf.String()
+	}
+
+	for _, format := range []string{"csv", "json"} {
+		orig := exportRecords(format)
+		if _, err := db.Exec(`DELETE FROM BabyData; DELETE FROM BabyFeedData WHERE ID = 2`); err != nil {
+			t.Fatalf("Clearing DB: %v", err)
+		}
+		added, updated, err := ImportRecords(context.Background(), db, strings.NewReader(orig), ImportOptions{Format: format})
+		if err != nil {
+			t.Fatalf("importRecords with -format %s: %v", format, err)
+		}
+		if added != 4 || updated != 1 {
+			t.Errorf("importRecords with -format %s: %d new and %d updated, want 4 and 1", format, added, updated)
+		}
+		if got := exportRecords(format); got != orig {
+			t.Errorf("After -format %s round trip, export records wrote\n%s\nwant\n%s", format, got, orig)
+		}
+	}
+
+	const header = "table,id,baby_id,start,end\n"
+	for _, bad := range []string{
+		header + "data,,1,1704140000,\n",
+		header + "data,x,1,1704140000,\n",
+		header + "data,9,2,1704140000,\n",
+		header + "data,9,1,,\n",
+		header + "data,9,1,1704140000,1704130000\n",
+		header + "nappy,9,1,1704140000,\n",
+		"table,id,baby_id,start,colour\ndata,9,1,1704140000,blue\n",
+		"table,id,baby_id,start,val_float\ndata,9,1,1704140000,heavy\n",
+	} {
+		if _, _, err := ImportRecords(context.Background(), db, strings.NewReader(bad), ImportOptions{}); err == nil {
+			t.Errorf("ImportRecords(%q) succeeded, want error", bad)
+		}
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM BabyData WHERE ID = 9`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("After failed imports, found %d rows with ID 9 (err %v), want none", n, err)
+	}
+
+	// A feed without the breast columns is stored as sync would, so feeds still load.
+	const bottle = "table,id,baby_id,start,end,feed_type,bottle_ml\nfeed,9,1,1704170000,,2,90\n"
+	if _, _, err := ImportRecords(context.Background(), db, strings.NewReader(bottle), ImportOptions{}); err != nil {
+		t.Fatalf("ImportRecords(%q): %v", bottle, err)
+	}
+	info, err := loadBaby(context.Background(), db, Selection{})
+	if err != nil {
+		t.Fatalf("loadBaby: %v", err)
+	}
+	feeds, err := loadFeeds(context.Background(), db, Selection{}, info.babyID)
+	if err != nil {
+		t.Fatalf("loadFeeds after importing a bottle feed: %v", err)
+	}
+	if len(feeds) != 2 || feeds[1].bottleML != 90 || feeds[1].left != 0 || feeds[1].breastUsed != "" {
+		t.Errorf("loadFeeds after importing a bottle feed = %+v, want it last with 90 ml and no breast times", feeds)
+	}
+}
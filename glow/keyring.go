@@ -0,0 +1,117 @@
+package glow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// The OS keyring is reached through its command line tool,
+// which avoids a cgo or D-Bus dependency:
+// security(1) on macOS, and secret-tool(1) from libsecret on Linux.
+// Credentials are stored as the same JSON as the -creds file.
+
+// keyringService is the service name credentials are stored under.
+const keyringService = "glowbaby"
+
+var (
+	errNoKeyring    = errors.New("OS keyring unavailable")
+	errNotInKeyring = errors.New("credentials not found in OS keyring")
+)
+
+// securityItemNotFound is the exit status of security(1) when there's no such item.
+const securityItemNotFound = 44
+
+// keyringAccount is the name an account's credentials are stored under.
+func keyringAccount(account string) string {
+	if account == "" {
+		return "default"
+	}
+	return account
+}
+
+// keyringGet loads an account's credentials from the OS keyring.
+func keyringGet(account string) (credentials, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount(account), "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount(account))
+	default:
+		return credentials{}, errNoKeyring
+	}
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// security exits with errSecItemNotFound when there's no such item,
+		// and secret-tool exits silently. Anything else, such as no D-Bus
+		// or secret service on a headless machine, means the keyring can't be used.
+		msg := strings.TrimSpace(string(exitErr.Stderr))
+		if runtime.GOOS == "darwin" && exitErr.ExitCode() == securityItemNotFound ||
+			runtime.GOOS == "linux" && msg == "" {
+			return credentials{}, errNotInKeyring
+		}
+		return credentials{}, fmt.Errorf("%w: %v: %s", errNoKeyring, err, msg)
+	} else if err != nil {
+		return credentials{}, fmt.Errorf("%w: %v", errNoKeyring, err)
+	}
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return credentials{}, errNotInKeyring
+	}
+	var creds credentials
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return credentials{}, fmt.Errorf("parsing creds from OS keyring: %w", err)
+	}
+	return creds, nil
+}
+
+// keyringSet saves an account's credentials to the OS keyring,
+// replacing any already there.
+func keyringSet(account string, creds credentials) error {
+	raw, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("marshaling creds: %w", err)
+	}
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// security only takes the secret as an argument, which other local users
+		// could see in the process list. So pass the command on standard input
+		// to security -i instead, with the secret in hex to avoid quoting it.
+		cmd = exec.Command("security", "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -X %x\n",
+			securityQuote(keyringService), securityQuote(keyringAccount(account)), raw))
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=Glow Baby credentials", "service", keyringService, "account", keyringAccount(account))
+		cmd.Stdin = bytes.NewReader(raw)
+	default:
+		return errNoKeyring
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("%w: %v", errNoKeyring, err)
+		}
+		return fmt.Errorf("saving creds to OS keyring: %v: %s", err, strings.TrimSpace(redact(string(out))))
+	}
+	if runtime.GOOS == "darwin" {
+		// security -i doesn't always exit with a failure when its command fails,
+		// so check the credentials are there.
+		if got, err := keyringGet(account); err != nil || got != creds {
+			return fmt.Errorf("saving creds to OS keyring: %s", strings.TrimSpace(redact(string(out))))
+		}
+	}
+	return nil
+}
+
+// securityQuote quotes s as an argument in a command line read by security -i.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
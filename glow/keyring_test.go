@@ -0,0 +1,54 @@
+package glow
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestKeyring(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake keyring tool is only for Linux")
+	}
+	// A fake secret-tool that keeps one secret in a file.
+	dir := t.TempDir()
+	script := `#!/bin/sh
+store="$(dirname "$0")/secret"
+if [ -n "$FAKE_NO_DBUS" ]; then
+	echo "Cannot autolaunch D-Bus without X11 \$DISPLAY" >&2
+	exit 1
+fi
+case "$1" in
+store) cat > "$store" ;;
+lookup) [ -f "$store" ] && cat "$store" || exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "secret-tool"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if _, err := keyringGet(""); !errors.Is(err, errNotInKeyring) {
+		t.Errorf("keyringGet from empty keyring = %v, want %v", err, errNotInKeyring)
+	}
+	want := credentials{Email: "me@example.com", Password: "pw"}
+	if err := keyringSet("", want); err != nil {
+		t.Fatalf("keyringSet: %v", err)
+	}
+	got, err := keyringGet("")
+	if err != nil {
+		t.Fatalf("keyringGet: %v", err)
+	}
+	if got != want {
+		t.Errorf("keyringGet = %+v, want %+v", got, want)
+	}
+
+	// Without a secret service, the keyring can't be used, rather than being empty.
+	t.Setenv("FAKE_NO_DBUS", "1")
+	if _, err := keyringGet(""); !errors.Is(err, errNoKeyring) {
+		t.Errorf("keyringGet without a secret service = %v, want %v", err, errNoKeyring)
+	}
+}
@@ -0,0 +1,167 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Backup writes a consistent copy of the database to dst.
+// This uses VACUUM INTO rather than copying the file,
+// so it is safe even if another process is using the database.
+// The copy is given the permissions in mode. It is written under a private
+// temporary name next to dst, and only renamed to dst once that is done,
+// so dst never exists with looser permissions or partial contents.
+func Backup(ctx context.Context, db *sql.DB, dst string, mode os.FileMode) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	// TempFile creates the file with mode 0600, and VACUUM INTO
+	// is happy to write into an empty file, keeping its mode.
+	f, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file for DB copy: %w", err)
+	}
+	tmp := f.Name()
+	f.Close()
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("writing DB copy to %s: %w", dst, err)
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("setting permissions of %s: %w", dst, err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("moving DB copy into place: %w", err)
+	}
+	return nil
+}
+
+// Compact rebuilds the database file to reclaim space left by deleted records,
+// and then lets SQLite refresh its query planner statistics.
+func Compact(ctx context.Context, db *sql.DB) error {
+	// VACUUM can't run inside a transaction,
+	// so make sure it gets a connection of its own.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("getting DB connection: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `VACUUM`); err != nil {
+		return fmt.Errorf("vacuuming DB: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, `PRAGMA optimize`); err != nil {
+		return fmt.Errorf("optimising DB: %w", err)
+	}
+	return nil
+}
+
+// Dedupe removes records that duplicate another record apart from their ID,
+// keeping the one with the lowest ID. It reports the number of records removed
+// (or that would be removed, if dryRun is set).
+func Dedupe(ctx context.Context, db *sql.DB, dryRun bool) (int64, error) {
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	var total int64
+	for _, q := range []struct {
+		table, keyCols string
+	}{
+		{"BabyData", "BabyID, StartTimestamp, Key"},
+		{"BabyFeedData", "BabyID, StartTimestamp"},
+	} {
+		where := `WHERE ID NOT IN (SELECT MIN(ID) FROM ` + q.table + ` GROUP BY ` + q.keyCols + `)`
+		var n int64
+		if dryRun {
+			err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+q.table+` `+where).Scan(&n)
+		} else {
+			var res sql.Result
+			res, err = tx.ExecContext(ctx, `DELETE FROM `+q.table+` `+where)
+			if err == nil {
+				n, err = res.RowsAffected()
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("removing duplicates from %s: %w", q.table, err)
+		}
+		log.Printf("Found %d duplicate records in %s", n, q.table)
+		total += n
+	}
+
+	if dryRun {
+		// Nothing changed, but be explicit.
+		return total, tx.Rollback()
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return total, nil
+}
+
+// forgetTables are the tables holding a baby's data, with Babies last.
+var forgetTables = []string{"BabyData", "BabyFeedData", "Family", "Insights", "Babies"}
+
+// TableCount is the number of rows affected in a table.
+type TableCount struct {
+	Table string
+	N     int64
+}
+
+// Forget deletes everything stored about a baby, in one transaction.
+// It reports the number of rows removed from each table
+// (or that would be removed, if dryRun is set).
+// A later login would add the baby back if the account still has it;
+// until then, sync doesn't ask for its data, and drops insights about it.
+func Forget(ctx context.Context, db *sql.DB, babyID int64, dryRun bool) ([]TableCount, error) {
+	// Start transaction.
+	// Any failures after this point should roll back the transaction.
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tx, err := db.BeginTx(txCtx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting DB transaction: %w", err)
+	}
+
+	var counts []TableCount
+	for _, table := range forgetTables {
+		var n int64
+		if dryRun {
+			err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+` WHERE BabyID = ?`, babyID).Scan(&n)
+		} else {
+			var res sql.Result
+			res, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE BabyID = ?`, babyID)
+			if err == nil {
+				n, err = res.RowsAffected()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("removing baby %d from %s: %w", babyID, table, err)
+		}
+		counts = append(counts, TableCount{table, n})
+	}
+
+	if dryRun {
+		// Nothing changed, but be explicit.
+		return counts, tx.Rollback()
+	}
+
+	// Finalise transaction.
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing DB transaction: %w", err)
+	}
+	return counts, nil
+}
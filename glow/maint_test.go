@@ -0,0 +1,129 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "backup.db")
+	if err := Backup(context.Background(), db, dst, 0640); err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	fi, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("Checking backup: %v", err)
+	}
+	if got := fi.Mode().Perm(); got != 0640 {
+		t.Errorf("backup has mode %v, want %v", got, os.FileMode(0640))
+	}
+	// Nothing but the backup is left behind.
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("after backup, %s has %d files (err %v), want 1", dir, len(files), err)
+	}
+	bak, err := sql.Open("sqlite3", dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bak.Close()
+	var name string
+	if err := bak.QueryRow(`SELECT FirstName FROM Babies WHERE BabyID = 1`).Scan(&name); err != nil || name != "Ada" {
+		t.Errorf("backup has baby 1 named %q (err %v), want Ada", name, err)
+	}
+
+	// An existing file isn't overwritten.
+	if err := Backup(context.Background(), db, dst, 0640); err == nil {
+		t.Errorf("backup to existing %s succeeded, want error", dst)
+	}
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("after failed backup, %s has %d files (err %v), want 1", dir, len(files), err)
+	}
+}
+
+func TestForget(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (2, "Bo", "Test", "2024-01-01");
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+			(1, 1704160800, 1704164400, "sleep"),
+			(1, 1704247200, 1704250800, "sleep"),
+			(2, 1704247200, 1704250800, "sleep");
+		INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType) VALUES (1, 1704160800, 2);
+		INSERT INTO Family(BabyID, UserID, FirstName) VALUES (1, 10, "Pat"), (2, 10, "Pat");
+		INSERT INTO Insights(ID, BabyID, Title) VALUES (1, 1, "Hello");`)
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	want := []TableCount{{"BabyData", 2}, {"BabyFeedData", 1}, {"Family", 1}, {"Insights", 1}, {"Babies", 1}}
+
+	counts, err := Forget(context.Background(), db, 1, true)
+	if err != nil {
+		t.Fatalf("forget with dry run: %v", err)
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("forget with dry run = %v, want %v", counts, want)
+	}
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM BabyData`).Scan(&n); err != nil || n != 3 {
+		t.Errorf("after dry run, BabyData has %d rows (err %v), want 3", n, err)
+	}
+
+	counts, err = Forget(context.Background(), db, 1, false)
+	if err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("forget = %v, want %v", counts, want)
+	}
+	for _, table := range forgetTables {
+		var left, others int
+		if err := db.QueryRow(`SELECT COUNT(*) FILTER (WHERE BabyID = 1), COUNT(*) FILTER (WHERE BabyID = 2) FROM `+table).Scan(&left, &others); err != nil {
+			t.Fatalf("Counting %s: %v", table, err)
+		}
+		if left != 0 {
+			t.Errorf("after forget, %s has %d rows for baby 1, want 0", table, left)
+		}
+		if table != "Insights" && table != "BabyFeedData" && others == 0 {
+			t.Errorf("after forget, %s has no rows for baby 2", table)
+		}
+	}
+}
+
+func TestForgetThenSync(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (2, "Bo", "Test", "2024-01-01")`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	if _, err := Forget(context.Background(), db, 2, false); err != nil {
+		t.Fatalf("forget: %v", err)
+	}
+	base, _ := fakePull(t, `{"data": {"babies": [{"baby_id": 1, "sync_token": "st1"}],
+		"insights": [{"id": 10, "baby_id": 1, "title": "Ada"}, {"id": 11, "baby_id": 2, "title": "Bo"}, {"id": 12, "title": "Everyone"}]
+	}}`)
+	if err := Sync(context.Background(), db, SyncOptions{APIBase: base}); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	var ids []int64
+	rows, err := db.Query(`SELECT ID FROM Insights ORDER BY ID`)
+	if err != nil {
+		t.Fatalf("Loading insights: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("Scanning insights: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if want := []int64{10, 12}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("after sync, insight IDs = %v, want %v (none about the forgotten baby)", ids, want)
+	}
+}
@@ -0,0 +1,92 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// babyToday is what each baby has done so far today, for metrics.
+type babyToday struct {
+	info       babyInfo
+	sleepHours float64
+	feeds      int
+	bottleML   float64
+}
+
+// Metrics writes gauges for what each baby selected by opts.Account has done so far today,
+// in the OpenMetrics text format, so a monitoring system can scrape them.
+func Metrics(ctx context.Context, db *sql.DB, w io.Writer, now time.Time, opts QueryOptions) error {
+	infos, err := loadBabies(ctx, db, opts.Account)
+	if err != nil {
+		return err
+	}
+	now = now.In(plotLocation)
+	y, m, d := now.Date()
+	dayStart := time.Date(y, m, d, 0, 0, 0, 0, plotLocation).Unix()
+
+	var babies []babyToday
+	for _, info := range infos {
+		bt, err := loadToday(ctx, db, info, dayStart, now.Unix())
+		if err != nil {
+			return err
+		}
+		babies = append(babies, bt)
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(bt babyToday) string
+	}{
+		{"glowbaby_sleep_hours_today", "Hours slept so far today, including any sleep still in progress.",
+			func(bt babyToday) string { return fmt.Sprintf("%.3f", bt.sleepHours) }},
+		{"glowbaby_feeds_today", "Feeds started so far today, of any type.",
+			func(bt babyToday) string { return fmt.Sprint(bt.feeds) }},
+		{"glowbaby_bottle_ml_today", "Millilitres given by bottle so far today.",
+			func(bt babyToday) string { return fmt.Sprintf("%g", bt.bottleML) }},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+		fmt.Fprintf(w, "# HELP %s %s\n", g.name, g.help)
+		for _, bt := range babies {
+			fmt.Fprintf(w, "%s{baby_id=\"%d\",baby=\"%s\"} %s\n", g.name, bt.info.babyID, metricsLabel(bt.info.firstName), g.value(bt))
+		}
+	}
+	_, err = fmt.Fprintln(w, "# EOF")
+	return err
+}
+
+// loadToday totals one baby's events between the unix times from and to.
+// Sleeps overlapping the range only count the overlapping part.
+func loadToday(ctx context.Context, db *sql.DB, info babyInfo, from, to int64) (babyToday, error) {
+	bt := babyToday{info: info}
+
+	var secs sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		SELECT SUM(MIN(COALESCE(EndTimestamp, ?2), ?2) - MAX(StartTimestamp, ?1)) FROM BabyData
+		WHERE BabyID = ?3 AND Key = "sleep" AND StartTimestamp < ?2 AND COALESCE(EndTimestamp, ?2) > ?1`,
+		from, to, info.babyID).Scan(&secs)
+	if err != nil {
+		return bt, fmt.Errorf("loading today's sleep: %w", err)
+	}
+	bt.sleepHours = float64(secs.Int64) / 3600
+
+	var ml sql.NullFloat64
+	err = db.QueryRowContext(ctx, `
+		SELECT COUNT(*), SUM(BottleML) FROM BabyFeedData
+		WHERE BabyID = ? AND FeedType != ? AND StartTimestamp BETWEEN ? AND ?`,
+		info.babyID, FeedPump, from, to).Scan(&bt.feeds, &ml)
+	if err != nil {
+		return bt, fmt.Errorf("loading today's feeds: %w", err)
+	}
+	bt.bottleML = ml.Float64
+	return bt, nil
+}
+
+// metricsLabel escapes s for use as an OpenMetrics label value.
+func metricsLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
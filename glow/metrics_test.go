@@ -0,0 +1,66 @@
+package glow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadToday(t *testing.T) {
+	db := newTestDB(t)
+	const from, to = 1704100000, 1704100000 + 12*3600
+	// Multiple statements can't share arguments, so substitute the times directly.
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+			(1, 1, %[1]d - 3600, %[1]d + 3600, "sleep"), -- one hour of it today
+			(2, 1, %[1]d + 7200, %[1]d + 9000, "sleep"),
+			(3, 1, %[2]d - 1800, NULL, "sleep"), -- still asleep
+			(4, 1, %[1]d, %[1]d + 600, "tummy");
+		INSERT INTO BabyFeedData(ID, BabyID, StartTimestamp, FeedType, BreastUsed, BottleML) VALUES
+			(1, 1, %[1]d - 60, 2, "", 100), -- yesterday
+			(2, 1, %[1]d + 60, 2, "", 120),
+			(3, 1, %[1]d + 120, 1, "L", 0),
+			(4, 1, %[1]d + 180, 4, "", 0);`, from, to))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	bt, err := loadToday(context.Background(), db, babyInfo{babyID: 1}, from, to)
+	if err != nil {
+		t.Fatalf("loadToday: %v", err)
+	}
+	if want := 2.0; bt.sleepHours != want {
+		t.Errorf("sleepHours = %v, want %v", bt.sleepHours, want)
+	}
+	if want := 2; bt.feeds != want {
+		t.Errorf("feeds = %d, want %d", bt.feeds, want)
+	}
+	if want := 120.0; bt.bottleML != want {
+		t.Errorf("bottleML = %v, want %v", bt.bottleML, want)
+	}
+}
+
+func TestMetricsFormat(t *testing.T) {
+	db := newTestDB(t)
+	var buf strings.Builder
+	if err := Metrics(context.Background(), db, &buf, time.Now(), QueryOptions{}); err != nil {
+		t.Fatalf("metrics: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE glowbaby_feeds_today gauge\n",
+		`glowbaby_feeds_today{baby_id="1",baby="Ada"} 0` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics output doesn't contain %q:\n%s", want, out)
+		}
+	}
+	if !strings.HasSuffix(out, "# EOF\n") {
+		t.Errorf("metrics output doesn't end with # EOF:\n%s", out)
+	}
+	if got, want := metricsLabel(`a "b" \c`), `a \"b\" \\c`; got != want {
+		t.Errorf("metricsLabel = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,204 @@
+package glow
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image/png"
+	"sort"
+	"strings"
+)
+
+// pdfDoc is a minimal PDF writer, enough for reports: A4 pages holding either
+// an image or monospaced text, each with a title. It uses only the standard
+// PDF fonts, so nothing needs embedding, and writes nothing time-dependent,
+// so the same input always gives the same bytes.
+type pdfDoc struct {
+	objects [][]byte // the body of object i+1
+	pages   []int    // object numbers of the pages, in order
+}
+
+const (
+	pdfPageWidth, pdfPageHeight = 595, 842 // A4, in points
+	pdfMargin                   = 50
+	pdfTitleSize                = 16
+	pdfTextSize                 = 9
+	pdfLeading                  = 11
+	pdfTabWidth                 = 8
+)
+
+// Objects 1 to 4 are always the catalog, the page tree and the two fonts.
+const (
+	pdfCatalogObj = 1
+	pdfPagesObj   = 2
+)
+
+func newPDFDoc() *pdfDoc {
+	d := new(pdfDoc)
+	d.add(fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesObj))
+	d.add("") // the page tree, filled in by bytes
+	d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	d.add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	return d
+}
+
+// add adds an object, returning its number.
+func (d *pdfDoc) add(body string) int {
+	d.objects = append(d.objects, []byte(body))
+	return len(d.objects)
+}
+
+// addStream adds a stream object with the given extra dictionary entries.
+func (d *pdfDoc) addStream(dict string, data []byte) int {
+	var buf bytes.Buffer
+	if dict != "" {
+		dict += " "
+	}
+	fmt.Fprintf(&buf, "<< %s/Length %d >>\nstream\n", dict, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream")
+	d.objects = append(d.objects, buf.Bytes())
+	return len(d.objects)
+}
+
+// addPage adds a page with the given title, content and image resources.
+func (d *pdfDoc) addPage(title string, content string, images map[string]int) {
+	var xobjs []string
+	for name, obj := range images {
+		xobjs = append(xobjs, fmt.Sprintf("/%s %d 0 R", name, obj))
+	}
+	sort.Strings(xobjs) // for reproducible output
+	heading := fmt.Sprintf("BT /F1 %d Tf %d %d Td (%s) Tj ET\n",
+		pdfTitleSize, pdfMargin, pdfPageHeight-pdfMargin, pdfString(title))
+	contents := d.addStream("", []byte(heading+content))
+	d.pages = append(d.pages, d.add(fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> /XObject << %s >> >> /Contents %d 0 R >>",
+		pdfPagesObj, pdfPageWidth, pdfPageHeight, strings.Join(xobjs, " "), contents)))
+}
+
+// addImagePage adds a page showing a PNG image, scaled to fit below the title.
+func (d *pdfDoc) addImagePage(title string, pngData []byte) error {
+	img, err := png.Decode(bytes.NewReader(pngData))
+	if err != nil {
+		return fmt.Errorf("decoding PNG for %q: %w", title, err)
+	}
+	b := img.Bounds()
+	// Flatten onto white, since PDF images here have no alpha channel.
+	rgb := make([]byte, 0, 3*b.Dx()*b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			white := 0xffff - a
+			rgb = append(rgb, byte((r+white)>>8), byte((g+white)>>8), byte((bl+white)>>8))
+		}
+	}
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(rgb)
+	zw.Close()
+	obj := d.addStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+		b.Dx(), b.Dy()), z.Bytes())
+
+	// Fit the image in the space under the title, keeping its aspect ratio.
+	maxW := float64(pdfPageWidth - 2*pdfMargin)
+	maxH := float64(pdfPageHeight - 2*pdfMargin - 2*pdfTitleSize)
+	w, h := maxW, maxW*float64(b.Dy())/float64(b.Dx())
+	if h > maxH {
+		w, h = maxH*float64(b.Dx())/float64(b.Dy()), maxH
+	}
+	top := float64(pdfPageHeight - pdfMargin - 2*pdfTitleSize)
+	d.addPage(title, fmt.Sprintf("q %.2f 0 0 %.2f %d %.2f cm /Im Do Q\n", w, h, pdfMargin, top-h), map[string]int{"Im": obj})
+	return nil
+}
+
+// addTextPages adds as many pages as are needed to show text in a monospaced font.
+// Lines too long for the page are cut short.
+func (d *pdfDoc) addTextPages(title, text string) {
+	perPage := (pdfPageHeight - 2*pdfMargin - 2*pdfTitleSize) / pdfLeading
+	maxCols := (pdfPageWidth - 2*pdfMargin) * 10 / (6 * pdfTextSize) // Courier glyphs are 0.6em wide
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	for page := 0; page*perPage < len(lines); page++ {
+		chunk := lines[page*perPage:]
+		if len(chunk) > perPage {
+			chunk = chunk[:perPage]
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "BT /F2 %d Tf %d TL %d %d Td\n", pdfTextSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin-2*pdfTitleSize)
+		for _, line := range chunk {
+			line = expandTabs(line)
+			if r := []rune(line); len(r) > maxCols {
+				line = string(r[:maxCols])
+			}
+			fmt.Fprintf(&sb, "(%s) Tj T*\n", pdfString(line))
+		}
+		sb.WriteString("ET\n")
+		t := title
+		if page > 0 {
+			t += " (continued)"
+		}
+		d.addPage(t, sb.String(), nil)
+	}
+}
+
+// bytes returns the finished document.
+func (d *pdfDoc) bytes() []byte {
+	kids := make([]string, len(d.pages))
+	for i, p := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", p)
+	}
+	d.objects[pdfPagesObj-1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n") // the binary comment marks the file as binary
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(body)
+		buf.WriteString("\nendobj\n")
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, pdfCatalogObj, xref)
+	return buf.Bytes()
+}
+
+// pdfString escapes s for use in a PDF literal string,
+// encoding it as WinAnsi (close enough to Latin-1) with other characters as "?".
+func pdfString(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			sb.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&sb, "\\%03o", r)
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// expandTabs replaces tabs in s with spaces, up to the next tab stop.
+func expandTabs(s string) string {
+	var sb strings.Builder
+	col := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := pdfTabWidth - col%pdfTabWidth
+			sb.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		sb.WriteRune(r)
+		col++
+	}
+	return sb.String()
+}
@@ -0,0 +1,1587 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// TODO: flags for these?
+	plotImageWidth  = 1024 // pixels, at 72 DPI
+	plotImageHeight = 768  // pixels, at 72 DPI
+	plotTextSize    = 16   // points
+	plotLabelSize   = 10   // points, for labels on the data
+)
+
+// plotLocation is the time zone that plots, charts and stats divide days in,
+// and that dates in options and birthdays are read in. Tests may override it.
+// Exports are written in it unless ExportOptions.OutputTimezone is set.
+// TODO: record baby timezone from Glow and use that instead of time.Local.
+var plotLocation = time.Local
+
+// PlotOptions controls what is plotted, and how.
+// Zero values mean the same as the flags' defaults, except for GrowthTolerance.
+type PlotOptions struct {
+	Selection // which baby and events to plot
+
+	Title       string  // if set, the title for plots, instead of one naming the baby
+	DPI         float64 // resolution, in dots per inch
+	LineWidth   float64 // width in pixels of the arcs of polar plots and the lines of line charts
+	Theme       string  // a key of themes
+	Palette     string  // a key of palettes
+	Transparent bool    // leave the plot background transparent
+	Grid        bool    // draw rings on polar plots, labelled with the age at each
+	Minimal     bool    // leave the centre of polar plots unmarked
+	Verbose     bool    // log how long plots take to render
+	Zero        string  // if set, the date (YYYY-MM-DD) to centre polar plots on, rather than the birthday
+
+	ShortSleep, LongSleep time.Duration // sleeps under or at least these are coloured as short or long
+	MinArc                time.Duration // for the feed plot, the shortest duration to draw feeds as
+	ScaleFeed             bool          // for the feed plot, draw feed durations on a logarithmic scale
+
+	Units    string // units for volumes, "metric" or "imperial"
+	ZeroDays bool   // for bottle-volume, plot days without bottle feeds as zero
+	Smooth   int    // if more than 1, overlay a moving average over this many days on line charts
+
+	GrowthTolerance int // for bmi, pair weight and height readings at most this many days apart
+
+	Colors map[string]color.NRGBA // colours for plot elements (see ColorElements), overriding Palette and Theme
+}
+
+// withDefaults returns opts with its zero values replaced by the flags' defaults.
+func (opts PlotOptions) withDefaults() PlotOptions {
+	if opts.DPI <= 0 {
+		opts.DPI = 72
+	}
+	if opts.LineWidth <= 0 {
+		opts.LineWidth = 1
+	}
+	if opts.Theme == "" {
+		opts.Theme = "light"
+	}
+	if opts.Palette == "" {
+		opts.Palette = "default"
+	}
+	if opts.ShortSleep == 0 {
+		opts.ShortSleep = 90 * time.Minute
+	}
+	if opts.LongSleep == 0 {
+		opts.LongSleep = 5 * time.Hour
+	}
+	if opts.Units == "" {
+		opts.Units = "metric"
+	}
+	return opts
+}
+
+// renderWorkers is how many plots RenderEach renders at once.
+var renderWorkers = runtime.GOMAXPROCS(0)
+
+// RenderEach calls fn for each i from 0 to n-1, up to renderWorkers at once.
+// Each plot is drawn on its own canvas, and the font is only parsed once (see loadFont),
+// so plots can render in parallel. A single plot is rendered without another goroutine.
+// It returns the first error from fn, and cancels the ctx passed to the other calls.
+func RenderEach(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	if n == 1 {
+		return fn(ctx, 0)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	next := make(chan int)
+	for w := 0; w < renderWorkers && w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := fn(ctx, i); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return firstErr
+}
+
+// scale reports the factor to scale pixel dimensions by for the requested DPI.
+func (opts PlotOptions) scale() float64 {
+	return opts.DPI / 72
+}
+
+// Check reports whether opts are usable, once defaults are filled in,
+// with an error naming the flags that set them if not.
+func (opts PlotOptions) Check() error {
+	opts = opts.withDefaults()
+	if _, ok := palettes[opts.Palette]; !ok {
+		return fmt.Errorf("unknown palette %q", opts.Palette)
+	}
+	if _, ok := themes[opts.Theme]; !ok {
+		return fmt.Errorf("unknown theme %q", opts.Theme)
+	}
+	if opts.Transparent && opts.Theme == "dark" {
+		return errors.New("-transparent and -theme dark are mutually exclusive")
+	}
+	if opts.MinArc < 0 {
+		return errors.New("-min-arc must not be negative")
+	}
+	if opts.ShortSleep <= 0 || opts.LongSleep < opts.ShortSleep {
+		return errors.New("-short-sleep must be positive and no more than -long-sleep")
+	}
+	return nil
+}
+
+// PlotTypes are the types of plot that Plot draws, besides "key=" ones (see plotKey).
+var PlotTypes = []string{
+	"sleep", "feed", "combined", "longest-sleep", "daily-sleep", "sleep-overview",
+	"feed-intervals", "feed-tod", "tummy", "medicine", "wake-windows", "bottle-volume", "bmi",
+}
+
+// Plot draws the plot of type typ (one of PlotTypes, or "key=" and a BabyData key)
+// for the baby selected by opts, returning it as a PNG.
+func Plot(ctx context.Context, db *sql.DB, typ string, opts PlotOptions) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+	switch typ {
+	default:
+		if strings.HasPrefix(typ, "key=") {
+			return plotKey(ctx, db, strings.TrimPrefix(typ, "key="), opts)
+		}
+		// Shouldn't happen; see PlotTypes.
+		return nil, fmt.Errorf("unknown plot type %q", typ)
+	case "sleep":
+		return plotSleep(ctx, db, opts)
+	case "feed":
+		return plotFeed(ctx, db, opts)
+	case "combined":
+		return plotCombined(ctx, db, opts)
+	case "longest-sleep":
+		return plotLongestSleep(ctx, db, opts)
+	case "daily-sleep":
+		return plotDailySleep(ctx, db, opts)
+	case "sleep-overview":
+		return plotSleepOverview(ctx, db, opts)
+	case "feed-intervals":
+		return plotFeedIntervals(ctx, db, opts)
+	case "feed-tod":
+		return plotFeedTOD(ctx, db, opts)
+	case "tummy":
+		return plotTummy(ctx, db, opts)
+	case "medicine":
+		return plotMedicine(ctx, db, opts)
+	case "wake-windows":
+		return plotWakeWindows(ctx, db, opts)
+	case "bottle-volume":
+		return plotBottleVolume(ctx, db, opts)
+	case "bmi":
+		return plotBMI(ctx, db, opts)
+	}
+}
+
+// Selection chooses the baby, and which of its events, that plots, stats and exports cover.
+// The CLI sets it from the flags they share (see selectionFromFlags).
+// The zero Selection is all the events of the first baby, in days starting at midnight.
+type Selection struct {
+	Account  string    // if set, only consider babies in this Auth account
+	Baby     string    // ID of the baby, or "" for the first one
+	From, To string    // if set, only consider events from and up to these dates (YYYY-MM-DD), inclusive
+	DayStart ClockTime // the time of day at which days start (see dayOf)
+	Limit    int       // if more than 0, only use the most recent Limit events of each kind (see inOrder)
+}
+
+// timeWindow returns the range of unix times selected by sel.From and sel.To.
+// Both ends are inclusive, and default to unbounded.
+func (sel Selection) timeWindow() (from, to int64, err error) {
+	from, to = math.MinInt64, math.MaxInt64
+	if sel.From != "" {
+		t, err := time.ParseInLocation("2006-01-02", sel.From, plotLocation)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad -from date: %w", err)
+		}
+		from = t.Unix()
+	}
+	if sel.To != "" {
+		t, err := time.ParseInLocation("2006-01-02", sel.To, plotLocation)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad -to date: %w", err)
+		}
+		to = t.AddDate(0, 0, 1).Unix() - 1
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("-from date is after -to date")
+	}
+	return from, to, nil
+}
+
+// inOrder orders a query of events, which must select their StartTimestamp,
+// chronologically. With a Limit, it keeps just the most recent Limit of them.
+// Only plot and stats accept -limit, since other commands,
+// such as export and report, are expected to cover the whole -from/-to window.
+func (sel Selection) inOrder(query string) string {
+	if sel.Limit <= 0 {
+		return query + "\n\t\tORDER BY StartTimestamp"
+	}
+	return fmt.Sprintf("SELECT * FROM (%s\n\t\tORDER BY StartTimestamp DESC LIMIT %d)\n\t\tORDER BY StartTimestamp", query, sel.Limit)
+}
+
+type babyInfo struct {
+	babyID              int64
+	firstName, lastName string
+	birthday            time.Time // midnight, in plotLocation
+}
+
+// in returns info with its birthday at midnight on the same date in loc,
+// so that days counted from it are divided in loc.
+func (info babyInfo) in(loc *time.Location) babyInfo {
+	y, m, d := info.birthday.Date()
+	info.birthday = time.Date(y, m, d, 0, 0, 0, 0, loc)
+	return info
+}
+
+// babyFilter returns an SQL condition on Babies, and its arguments,
+// that selects the babies in the given Auth account, or all babies if it is "".
+func babyFilter(account string) (string, []interface{}) {
+	if account == "" {
+		return `1`, nil
+	}
+	return `Account = ?`, []interface{}{account}
+}
+
+// loadBaby loads the baby selected by sel.Baby, or the first one if it is "".
+func loadBaby(ctx context.Context, db *sql.DB, sel Selection) (babyInfo, error) {
+	cond, args := babyFilter(sel.Account)
+	switch baby := sel.Baby; baby {
+	case "":
+	case "all":
+		return babyInfo{}, errors.New("-baby all only works with plot and export")
+	default:
+		id, err := strconv.ParseInt(baby, 10, 64)
+		if err != nil {
+			return babyInfo{}, fmt.Errorf("bad -baby %q; want a baby ID or \"all\"", baby)
+		}
+		cond += ` AND BabyID = ?`
+		args = append(args, id)
+	}
+	row := db.QueryRowContext(ctx, `SELECT BabyID, FirstName, LastName, Birthday FROM Babies WHERE `+cond+` ORDER BY BabyID LIMIT 1`, args...)
+	var info babyInfo
+	var bday string
+	err := row.Scan(&info.babyID, &info.firstName, &info.lastName, &bday)
+	if err != nil {
+		return babyInfo{}, fmt.Errorf("loading baby info: %w", err)
+	}
+	info.birthday, err = time.ParseInLocation("2006-01-02", bday, plotLocation)
+	if err != nil {
+		return babyInfo{}, fmt.Errorf("parsing baby birthday %q: %w", bday, err)
+	}
+	return info, nil
+}
+
+// loadBabies loads the babies in the given Auth account, or all babies if it is "".
+func loadBabies(ctx context.Context, db *sql.DB, account string) ([]babyInfo, error) {
+	cond, args := babyFilter(account)
+	rows, err := db.QueryContext(ctx, `SELECT BabyID, FirstName, LastName, Birthday FROM Babies WHERE `+cond+` ORDER BY BabyID`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("loading baby info: %w", err)
+	}
+	defer rows.Close()
+	var infos []babyInfo
+	for rows.Next() {
+		var info babyInfo
+		var bday string
+		if err := rows.Scan(&info.babyID, &info.firstName, &info.lastName, &bday); err != nil {
+			return nil, fmt.Errorf("scanning baby info: %w", err)
+		}
+		info.birthday, err = time.ParseInLocation("2006-01-02", bday, plotLocation)
+		if err != nil {
+			return nil, fmt.Errorf("parsing baby birthday %q: %w", bday, err)
+		}
+		infos = append(infos, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading baby info: %w", err)
+	}
+	return infos, nil
+}
+
+// BabyDest is where to write the output for one baby.
+type BabyDest struct {
+	Baby string // baby ID, as for Selection.Baby
+	Dst  string
+}
+
+// BabyDests returns dst for the baby selected by sel, or if sel.Baby is "all",
+// a destination for each baby, with the {babyid} and {name} placeholders in dst
+// filled in. It is an error for dst to have no placeholders with -baby all,
+// since every baby would be written to the same file.
+func BabyDests(ctx context.Context, db *sql.DB, sel Selection, dst string) ([]BabyDest, error) {
+	if sel.Baby != "all" {
+		return []BabyDest{{sel.Baby, dst}}, nil
+	}
+	if !strings.Contains(dst, "{babyid}") && !strings.Contains(dst, "{name}") {
+		return nil, fmt.Errorf("-baby all needs {babyid} or {name} in the destination filename, not %q", dst)
+	}
+	infos, err := loadBabies(ctx, db, sel.Account)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, errors.New("no babies found; log in and sync first")
+	}
+	var dests []BabyDest
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		// Keep names from making paths.
+		name := strings.Map(func(r rune) rune {
+			if r == '/' || r == os.PathSeparator || unicode.IsSpace(r) {
+				return '-'
+			}
+			return r
+		}, info.firstName)
+		d := strings.NewReplacer("{babyid}", strconv.FormatInt(info.babyID, 10), "{name}", name).Replace(dst)
+		if seen[d] {
+			return nil, fmt.Errorf("two babies would both be written to %s; use {babyid} in the destination filename", d)
+		}
+		seen[d] = true
+		dests = append(dests, BabyDest{strconv.FormatInt(info.babyID, 10), d})
+	}
+	return dests, nil
+}
+
+// palette is a set of colours for distinguishing segment durations.
+type palette struct {
+	long, medium, short color.NRGBA
+}
+
+var palettes = map[string]palette{
+	"default": {
+		long:   color.NRGBA{0, 0, 255, 255}, // blue
+		medium: color.NRGBA{0, 255, 0, 255}, // green
+		short:  color.NRGBA{255, 0, 0, 255}, // red
+	},
+	// Based on the Okabe-Ito palette, which avoids red/green confusion.
+	"cb-safe": {
+		long:   color.NRGBA{0, 114, 178, 255},   // blue
+		medium: color.NRGBA{230, 159, 0, 255},   // orange
+		short:  color.NRGBA{204, 121, 167, 255}, // reddish purple
+	},
+}
+
+// theme is a set of colours for the non-data parts of a plot.
+type theme struct {
+	background, text, grid color.Color
+}
+
+var themes = map[string]theme{
+	"light": {
+		background: color.White,
+		text:       color.Black,
+		grid:       color.NRGBA{208, 208, 208, 255},
+	},
+	"dark": {
+		background: color.NRGBA{24, 24, 24, 255},
+		text:       color.NRGBA{224, 224, 224, 255},
+		grid:       color.NRGBA{72, 72, 72, 255},
+	},
+}
+
+// loadSegments loads the start and end times of a baby's events with the given key,
+// in chronological order.
+// Only events starting within the -from/-to window are included (at most -limit of them),
+// and only those with an end time.
+func loadSegments(ctx context.Context, db *sql.DB, sel Selection, babyID int64, key string) ([][2]int64, error) {
+	from, to, err := sel.timeWindow()
+	if err != nil {
+		return nil, err
+	}
+	return querySegments(ctx, db, key, sel.inOrder(`
+		SELECT StartTimestamp, EndTimestamp FROM BabyData
+		WHERE BabyID = ? AND Key = ? AND StartTimestamp BETWEEN ? AND ? AND EndTimestamp IS NOT NULL`), babyID, key, from, to)
+}
+
+// loadClippedSegments is like loadSegments, but includes every event
+// that overlaps the -from/-to window, clipped to the window.
+// Use it when adding up time within the window.
+func loadClippedSegments(ctx context.Context, db *sql.DB, sel Selection, babyID int64, key string) ([][2]int64, error) {
+	from, to, err := sel.timeWindow()
+	if err != nil {
+		return nil, err
+	}
+	segs, err := querySegments(ctx, db, key, sel.inOrder(`
+		SELECT StartTimestamp, EndTimestamp FROM BabyData
+		WHERE BabyID = ? AND Key = ? AND EndTimestamp >= ? AND StartTimestamp <= ?`), babyID, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if to != math.MaxInt64 {
+		to++ // the window ends at the start of the day after -to
+	}
+	for i := range segs {
+		if segs[i][0] < from {
+			segs[i][0] = from
+		}
+		if segs[i][1] > to {
+			segs[i][1] = to
+		}
+	}
+	return segs, nil
+}
+
+func querySegments(ctx context.Context, db *sql.DB, key, query string, args ...interface{}) ([][2]int64, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s ranges: %w", key, err)
+	}
+	var segs [][2]int64
+	for rows.Next() {
+		var start, end int64
+		if err := rows.Scan(&start, &end); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning %s ranges from DB: %w", key, err)
+		}
+		segs = append(segs, [2]int64{start, end})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading %s ranges from DB: %w", key, err)
+	}
+	return segs, nil
+}
+
+type feed struct {
+	start       int64 // unix epoch
+	end         int64 // unix epoch, or 0 if not recorded
+	typ         FeedType
+	left, right int64  // seconds
+	breastUsed  string // e.g. "L", "R", "B"
+	bottleML    float64
+	pumpLeftML  float64
+	pumpRightML float64
+}
+
+// loadFeeds loads a baby's feeds in chronological order.
+// Only feeds starting within the -from/-to window are included.
+// Pumping sessions are recorded alongside feeds, but aren't included.
+func loadFeeds(ctx context.Context, db *sql.DB, sel Selection, babyID int64) ([]feed, error) {
+	return loadFeedData(ctx, db, sel, babyID, `FeedType IS NOT ?`, int64(FeedPump))
+}
+
+// loadPumps is like loadFeeds, but loads only the pumping sessions.
+func loadPumps(ctx context.Context, db *sql.DB, sel Selection, babyID int64) ([]feed, error) {
+	return loadFeedData(ctx, db, sel, babyID, `FeedType = ?`, int64(FeedPump))
+}
+
+// loadFeedData loads a baby's feeds and pumping sessions in chronological order.
+// If cond is set, it is a further SQL condition on them, with its arguments in args;
+// it is applied before -limit, so that the limit counts only what is wanted.
+func loadFeedData(ctx context.Context, db *sql.DB, sel Selection, babyID int64, cond string, args ...interface{}) ([]feed, error) {
+	from, to, err := sel.timeWindow()
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT StartTimestamp, EndTimestamp, FeedType, BreastLeft, BreastRight, BreastUsed, BottleML, PumpLeftML, PumpRightML FROM BabyFeedData
+		WHERE BabyID = ? AND StartTimestamp BETWEEN ? AND ?`
+	if cond != "" {
+		query += ` AND ` + cond
+	}
+	rows, err := db.QueryContext(ctx, sel.inOrder(query), append([]interface{}{babyID, from, to}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("loading feeds: %w", err)
+	}
+	var feeds []feed
+	for rows.Next() {
+		var f feed
+		var end, typ sql.NullInt64
+		var ml, pumpL, pumpR sql.NullFloat64
+		if err := rows.Scan(&f.start, &end, &typ, &f.left, &f.right, &f.breastUsed, &ml, &pumpL, &pumpR); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning feeds from DB: %w", err)
+		}
+		f.end = end.Int64
+		f.typ = DecodeFeedType(typ.Int64)
+		f.bottleML = ml.Float64
+		f.pumpLeftML, f.pumpRightML = pumpL.Float64, pumpR.Float64
+		feeds = append(feeds, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading feeds from DB: %w", err)
+	}
+	return feeds, nil
+}
+
+// endTime returns when a feed ended: its recorded end if it has one,
+// or else after its per-breast times, which are zero for other kinds of feed.
+func (f feed) endTime() int64 {
+	if f.end >= f.start {
+		return f.end
+	}
+	return f.start + f.left + f.right
+}
+
+// drawnFeedDuration returns how many seconds to draw a feed lasting d seconds as:
+// scaled logarithmically if opts.ScaleFeed is set, then at least opts.MinArc.
+func drawnFeedDuration(d int64, opts PlotOptions) int64 {
+	if opts.ScaleFeed && d > 0 {
+		// A minute is drawn as 10, an hour stays about an hour, and longer feeds are
+		// drawn shorter than they were, though never shorter than shorter feeds.
+		d = int64(math.Round(600 * math.Log2(1+float64(d)/60)))
+	}
+	if min := int64(opts.MinArc.Seconds()); d < min {
+		d = min
+	}
+	return d
+}
+
+type dose struct {
+	time int64  // unix epoch
+	desc string // free text from the app, e.g. "Paracetamol 2.5ml"
+}
+
+// loadDoses loads a baby's medicine doses in chronological order.
+// Only doses within the -from/-to window are included.
+func loadDoses(ctx context.Context, db *sql.DB, sel Selection, babyID int64) ([]dose, error) {
+	from, to, err := sel.timeWindow()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, sel.inOrder(`
+		SELECT StartTimestamp, ValStr FROM BabyData
+		WHERE BabyID = ? AND Key = "medicine" AND StartTimestamp BETWEEN ? AND ?`), babyID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("loading medicine doses: %w", err)
+	}
+	var doses []dose
+	for rows.Next() {
+		var d dose
+		var desc sql.NullString
+		if err := rows.Scan(&d.time, &desc); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning medicine doses from DB: %w", err)
+		}
+		d.desc = desc.String
+		doses = append(doses, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("loading medicine doses from DB: %w", err)
+	}
+	return doses, nil
+}
+
+type polarPlot struct {
+	opts      PlotOptions
+	segments  [][2]int64 // start, end unix epoch
+	title     string
+	what      string    // singular noun for the segments in the caption, e.g. "sleep"
+	zero      time.Time // Centre of the circle (e.g. birthday).
+	colSelect func(startD, endD int, startFrac, endFrac float64) color.NRGBA
+	legend    []legendEntry
+	labels    []string // if set, a label for each segment, drawn at its start
+	overlays  []polarOverlay
+}
+
+// polarOverlay is a further set of segments drawn over a polarPlot's own,
+// all in one colour and with a dot marking the start of each.
+// It lets two kinds of event share a plot (e.g. feeds over sleep).
+type polarOverlay struct {
+	segments [][2]int64 // start, end unix epoch
+	what     string     // as for polarPlot.what
+	col      color.NRGBA
+}
+
+type legendEntry struct {
+	col   color.NRGBA
+	label string
+}
+
+func (pp *polarPlot) AddSegment(start, end int64) {
+	pp.segments = append(pp.segments, [2]int64{start, end})
+}
+
+func plotSleep(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for sleep plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	// Load sleep data.
+	pp := polarPlot{opts: opts}
+	pp.segments, err = loadSegments(ctx, db, opts.Selection, info.babyID, "sleep")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d sleep ranges", len(pp.segments))
+
+	if len(pp.segments) == 0 {
+		return nil, fmt.Errorf("no sleep recorded")
+	}
+
+	pp.what = "sleep"
+	pp.title = fmt.Sprintf("Sleep segments for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	if pp.zero, err = polarZero(info.birthday, opts.Zero); err != nil {
+		return nil, err
+	}
+	pal := opts.plotPalette()
+	long, short := opts.LongSleep.Hours(), opts.ShortSleep.Hours()
+	pp.colSelect = func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+		hours := (endFrac-startFrac)*24 + float64(endD-startD)*24
+		switch {
+		case hours >= long:
+			return pal.long
+		case hours >= short:
+			return pal.medium
+		default:
+			return pal.short
+		}
+	}
+	pp.legend = []legendEntry{
+		{pal.long, shortDuration(opts.LongSleep) + " or more"},
+		{pal.medium, shortDuration(opts.ShortSleep) + " to " + shortDuration(opts.LongSleep)},
+		{pal.short, "under " + shortDuration(opts.ShortSleep)},
+	}
+
+	return pp.Render(ctx)
+}
+
+// shortDuration formats d compactly for a legend, e.g. "5h", "1.5h" or "45m".
+func shortDuration(d time.Duration) string {
+	if d >= time.Hour {
+		return strconv.FormatFloat(math.Round(d.Hours()*100)/100, 'f', -1, 64) + "h"
+	}
+	return strconv.FormatFloat(d.Minutes(), 'f', -1, 64) + "m"
+}
+
+func plotTummy(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for tummy time plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	// Load tummy time data.
+	pp := polarPlot{opts: opts}
+	pp.segments, err = loadSegments(ctx, db, opts.Selection, info.babyID, "tummy")
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d tummy time sessions", len(pp.segments))
+
+	if len(pp.segments) == 0 {
+		return nil, fmt.Errorf("no tummy time recorded")
+	}
+
+	pp.what = "tummy time session"
+	pp.title = fmt.Sprintf("Tummy time for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	if pp.zero, err = polarZero(info.birthday, opts.Zero); err != nil {
+		return nil, err
+	}
+	pal := opts.plotPalette()
+	pp.colSelect = func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+		mins := (endFrac-startFrac)*24*60 + float64(endD-startD)*24*60
+		switch {
+		case mins >= 15:
+			return pal.long
+		case mins >= 5:
+			return pal.medium
+		default:
+			return pal.short
+		}
+	}
+	pp.legend = []legendEntry{
+		{pal.long, "15m or more"},
+		{pal.medium, "5m to 15m"},
+		{pal.short, "under 5m"},
+	}
+
+	return pp.Render(ctx)
+}
+
+func plotMedicine(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for medicine plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	doses, err := loadDoses(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d medicine doses", len(doses))
+	if len(doses) == 0 {
+		return nil, fmt.Errorf("no medicine recorded")
+	}
+
+	// Each dose is a point in time, labelled with what was given.
+	pp := polarPlot{opts: opts}
+	for _, d := range doses {
+		pp.AddSegment(d.time, d.time)
+		pp.labels = append(pp.labels, d.desc)
+	}
+	pp.what = "dose"
+	pp.title = fmt.Sprintf("Medicine for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	if pp.zero, err = polarZero(info.birthday, opts.Zero); err != nil {
+		return nil, err
+	}
+	pal := opts.plotPalette()
+	pp.colSelect = func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+		return pal.short
+	}
+
+	return pp.Render(ctx)
+}
+
+// plotKey draws the BabyData events with the given key, for kinds of event
+// without a plot of their own. If any have end times, those are drawn as arcs,
+// and the rest left out; otherwise each event is a dot.
+func plotKey(ctx context.Context, db *sql.DB, key string, opts PlotOptions) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("no key to plot; use e.g. key=temperature")
+	}
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for %s plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"), key)
+
+	from, to, err := opts.timeWindow()
+	if err != nil {
+		return nil, err
+	}
+	segs, err := querySegments(ctx, db, key, opts.inOrder(`
+		SELECT StartTimestamp, COALESCE(EndTimestamp, StartTimestamp) FROM BabyData
+		WHERE BabyID = ? AND Key = ? AND StartTimestamp BETWEEN ? AND ?`), info.babyID, key, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) == 0 {
+		var n int
+		err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM BabyData WHERE BabyID = ? AND Key = ?`, info.babyID, key).Scan(&n)
+		if err != nil {
+			return nil, fmt.Errorf("counting %s events: %w", key, err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("no %q events within the -from/-to window (%d recorded in all)", key, n)
+		}
+		var keys string
+		err = db.QueryRowContext(ctx, `SELECT COALESCE(GROUP_CONCAT(Key, ", "), "none") FROM (SELECT DISTINCT Key FROM BabyData WHERE BabyID = ? ORDER BY Key)`, info.babyID).Scan(&keys)
+		if err != nil {
+			return nil, fmt.Errorf("listing keys: %w", err)
+		}
+		return nil, fmt.Errorf("no %q events recorded; keys recorded are: %s", key, keys)
+	}
+	var timed [][2]int64
+	for _, seg := range segs {
+		if seg[1] > seg[0] {
+			timed = append(timed, seg)
+		}
+	}
+
+	pp := polarPlot{opts: opts}
+	pal := opts.plotPalette()
+	if len(timed) > 0 {
+		log.Printf("Loaded %d %s events with end times (skipped %d without)", len(timed), key, len(segs)-len(timed))
+		pp.segments = timed
+		pp.what = key
+		pp.colSelect = func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+			return pal.long
+		}
+	} else {
+		log.Printf("Loaded %d %s events", len(segs), key)
+		pp.overlays = []polarOverlay{{segments: segs, what: key, col: pal.short}}
+	}
+	pp.title = fmt.Sprintf("%s for %s %s (born %s)", key, info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	if pp.zero, err = polarZero(info.birthday, opts.Zero); err != nil {
+		return nil, err
+	}
+
+	return pp.Render(ctx)
+}
+
+func plotFeed(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for feed plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	// Load feed data.
+	// Feeds with a recorded end time have a duration to plot,
+	// as do breast feeds, from their per-breast times.
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+	pp := polarPlot{opts: opts}
+	for _, f := range feeds {
+		if f.typ != FeedBreast && f.end <= f.start {
+			continue
+		}
+		pp.AddSegment(f.start, f.start+drawnFeedDuration(f.endTime()-f.start, opts))
+	}
+	log.Printf("Loaded %d timed feeds (skipped %d others)", len(pp.segments), len(feeds)-len(pp.segments))
+
+	if len(pp.segments) == 0 {
+		return nil, fmt.Errorf("no feeds recorded")
+	}
+
+	pp.what = "feed"
+	pp.title = fmt.Sprintf("Feeds for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	if opts.ScaleFeed {
+		pp.title += ", durations log-scaled"
+	}
+	if pp.zero, err = polarZero(info.birthday, opts.Zero); err != nil {
+		return nil, err
+	}
+	pp.colSelect = func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+		// All blue, except for midnight-spanning feeds.
+		if startD == endD {
+			return opts.elementColor("feed", color.NRGBA{0, 0, 255, 255}) // blue
+		}
+		return opts.elementColor("feed-midnight", color.NRGBA{255, 0, 0, 255}) // red
+	}
+
+	return pp.Render(ctx)
+}
+
+// plotCombined draws sleep and feeds on the same polar plot,
+// to show how they relate.
+func plotCombined(ctx context.Context, db *sql.DB, opts PlotOptions) ([]byte, error) {
+	// Load baby info.
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for combined plotting", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	pp := polarPlot{opts: opts}
+	pp.segments, err = loadSegments(ctx, db, opts.Selection, info.babyID, "sleep")
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d sleep ranges and %d feeds", len(pp.segments), len(feeds))
+	if len(pp.segments) == 0 && len(feeds) == 0 {
+		return nil, fmt.Errorf("no sleep or feeds recorded")
+	}
+
+	// Feeds without an end time or per-breast times (e.g. most bottle feeds)
+	// have no duration, so they are just a dot.
+	pal := opts.plotPalette()
+	fo := polarOverlay{what: "feed", col: pal.short}
+	for _, f := range feeds {
+		fo.segments = append(fo.segments, [2]int64{f.start, f.endTime()})
+	}
+	pp.overlays = []polarOverlay{fo}
+
+	pp.what = "sleep"
+	pp.title = fmt.Sprintf("Sleep and feeds for %s %s (born %s)", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	if pp.zero, err = polarZero(info.birthday, opts.Zero); err != nil {
+		return nil, err
+	}
+	pp.colSelect = func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+		return pal.long
+	}
+	pp.legend = []legendEntry{
+		{pal.long, "sleep"},
+		{pal.short, "feed"},
+	}
+
+	return pp.Render(ctx)
+}
+
+// canvas is an image being drawn for a plot.
+type canvas struct {
+	opts PlotOptions
+	img  *image.NRGBA
+	th   theme
+	font error // set if the plot font can't be used, so text is drawn with basicfont
+
+	samples int // points drawn along arcs, for -v
+
+	// The coverage of the line being drawn, when wider than a pixel (see line).
+	cover   *image.Alpha
+	covered []int // offsets in cover.Pix of the pixels covered so far
+
+	width, height   int // pixels
+	lineHeight, pad int // pixels
+}
+
+// newCanvas returns a blank canvas, sized and filled according to opts.
+func newCanvas(opts PlotOptions) *canvas {
+	opts = opts.withDefaults()
+	c := &canvas{opts: opts, th: opts.plotTheme()}
+	scale := opts.scale()
+	c.width, c.height = int(plotImageWidth*scale), int(plotImageHeight*scale)
+	c.lineHeight, c.pad = int(plotTextSize*scale), int(5*scale)
+
+	// Initialise an image filled with the theme background.
+	// A new NRGBA image is fully transparent, so leave it alone if that's wanted.
+	c.img = image.NewNRGBA(image.Rect(0, 0, c.width, c.height))
+	if !c.opts.Transparent {
+		draw.Draw(c.img, c.img.Bounds(), &image.Uniform{c.th.background}, image.ZP, draw.Src)
+	}
+	return c
+}
+
+// text writes text with its baseline starting at (x, y).
+// If the plot font can't be used, that is logged once,
+// and all text is drawn in a small bitmap font instead, so that it still appears.
+func (c *canvas) text(x, y int, col color.Color, text string) {
+	c.textSize(x, y, col, plotTextSize, text)
+}
+
+// label draws text in the smaller size used for labelling data.
+func (c *canvas) label(x, y int, col color.Color, text string) {
+	c.textSize(x, y, col, plotLabelSize, text)
+}
+
+func (c *canvas) textSize(x, y int, col color.Color, size float64, text string) {
+	if c.font == nil {
+		err := writeText(c.img, c.opts.DPI, x, y, col, size, text)
+		if err == nil {
+			return
+		}
+		// This was likely a font-loading issue.
+		log.Printf("Writing text: %v; falling back to a basic font", err)
+		c.font = err
+	}
+	// The basic font has only one size, which is about right for labels.
+	d := &font.Drawer{
+		Dst:  c.img,
+		Src:  &image.Uniform{col},
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// header draws the title (or opts.Title, if set), an optional caption line under it,
+// and then a legend with one entry per line.
+func (c *canvas) header(title, caption string, legend []legendEntry) {
+	if c.opts.Title != "" {
+		title = c.opts.Title
+	}
+	c.text(c.pad, c.pad+c.lineHeight, c.th.text, title)
+	line := 2
+	if caption != "" {
+		c.label(c.pad, c.pad+line*c.lineHeight, c.th.text, caption)
+		line++
+	}
+	for i, le := range legend {
+		y := c.pad + (i+line)*c.lineHeight
+		swatch := image.Rect(c.pad, y-c.lineHeight*3/4, c.pad+c.lineHeight*3/4, y)
+		draw.Draw(c.img, swatch, &image.Uniform{le.col}, image.ZP, draw.Src)
+		c.text(c.pad+c.lineHeight, y, c.th.text, le.label)
+	}
+}
+
+func (c *canvas) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, c.img); err != nil {
+		return nil, fmt.Errorf("encoding PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// polarZero returns the time to centre a polar plot on:
+// the zero date (YYYY-MM-DD) if set, or else the birthday.
+func polarZero(birthday time.Time, zero string) (time.Time, error) {
+	if zero == "" {
+		return birthday, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", zero, plotLocation)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad -zero date: %w", err)
+	}
+	return t, nil
+}
+
+// dropBeforeZero removes segments that start before zero, and their labels,
+// since they can't be drawn. They usually indicate bad data or clock skew.
+func (pp *polarPlot) dropBeforeZero() {
+	zero := pp.opts.DayStart.dayStart(pp.zero).Unix()
+	var segs [][2]int64
+	var labels []string
+	for i, seg := range pp.segments {
+		if seg[0] < zero {
+			continue
+		}
+		segs = append(segs, seg)
+		if i < len(pp.labels) {
+			labels = append(labels, pp.labels[i])
+		}
+	}
+	n := len(pp.segments) - len(segs)
+	pp.segments = segs
+	if pp.labels != nil {
+		pp.labels = labels
+	}
+	for i := range pp.overlays {
+		ov := &pp.overlays[i]
+		var segs [][2]int64
+		for _, seg := range ov.segments {
+			if seg[0] >= zero {
+				segs = append(segs, seg)
+			}
+		}
+		n += len(ov.segments) - len(segs)
+		ov.segments = segs
+	}
+	if n > 0 {
+		log.Printf("Dropped %d events from before %s", n, pp.zero.Format("2006-01-02"))
+	}
+}
+
+// Render draws the plot as a PNG. It gives up with ctx.Err() if ctx is done,
+// checking every renderCheckEvery segments while drawing.
+func (pp *polarPlot) Render(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	pp.dropBeforeZero()
+	// The latest end of any segment sets the scale.
+	var last int64
+	empty := true
+	for _, segs := range pp.allSegments() {
+		for _, seg := range segs {
+			if empty || seg[1] > last {
+				last = seg[1]
+			}
+			empty = false
+		}
+	}
+	if empty {
+		return nil, fmt.Errorf("nothing to plot on or after %s", pp.zero.Format("2006-01-02"))
+	}
+
+	c := newCanvas(pp.opts)
+	c.header(pp.title, pp.caption(), pp.legend)
+
+	// Plot data.
+	// Each segment is drawn as an arc, where midnight is at the top,
+	// and days extend from the circle centre outwards.
+	// Segments spanning midnight will
+	maxDay, _ := pp.splitEpoch(last)
+	if maxDay < 1 {
+		maxDay = 1 // avoid dividing by zero if everything is on one day
+	}
+	dayScale := float64(c.height) / 2 * 0.9 / float64(maxDay)
+	var rings []ageRing
+	if c.opts.Grid {
+		rings = ageRings(pp.zero, maxDay)
+		for _, r := range rings {
+			drawCircle(c, dayScale*float64(r.day), c.th.grid)
+		}
+	}
+	for i, seg := range pp.segments {
+		if i%renderCheckEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		startD, startFrac := pp.splitEpoch(seg[0])
+		endD, endFrac := pp.splitEpoch(seg[1])
+		col := pp.colSelect(startD, endD, startFrac, endFrac)
+		pp.drawArc(c, dayScale, seg, col)
+
+		if i < len(pp.labels) && pp.labels[i] != "" {
+			pp.drawLabel(c, i, dayScale*float64(startD), startFrac*2*math.Pi, col)
+		}
+	}
+	for _, ov := range pp.overlays {
+		for i, seg := range ov.segments {
+			if i%renderCheckEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+			}
+			pp.drawArc(c, dayScale, seg, ov.col)
+			startD, startFrac := pp.splitEpoch(seg[0])
+			drawMark(c, dayScale*float64(startD), startFrac*2*math.Pi, ov.col)
+		}
+	}
+	// Label the rings up the 12 o'clock line, over the data so they stay legible.
+	for _, r := range rings {
+		c.label(c.width/2+c.pad, c.height/2-int(dayScale*float64(r.day))-c.pad, c.th.text, r.label)
+	}
+	if !c.opts.Minimal {
+		pp.drawCentre(c)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	out, err := c.encode()
+	if err == nil && c.opts.Verbose {
+		var n int
+		for _, segs := range pp.allSegments() {
+			n += len(segs)
+		}
+		log.Printf("Rendered %s (%s) in %v", plural(n, "segment"), plural(c.samples, "sample"), time.Since(start).Round(time.Millisecond))
+	}
+	return out, err
+}
+
+// renderCheckEvery is how many segments Render draws between checks for cancellation.
+// Drawing a long arc takes a few tens of microseconds.
+const renderCheckEvery = 64
+
+// ageRing is a ring on a polar plot, marking an age.
+type ageRing struct {
+	day   int    // days since the zero
+	label string // e.g. "4w" or "3mo"
+}
+
+// ageRings returns the rings to draw on a polar plot reaching maxDay days from zero.
+// Plots spanning less than about four months get rings every few weeks,
+// and longer ones every few months, with no more than maxRings of them.
+func ageRings(zero time.Time, maxDay int) []ageRing {
+	const maxRings = 8
+	var rings []ageRing
+	if maxDay < 16*7 {
+		step := 1
+		for _, s := range []int{1, 2, 4, 8} {
+			step = s
+			if maxDay/(7*step) <= maxRings {
+				break
+			}
+		}
+		for w := step; w*7 <= maxDay; w += step {
+			rings = append(rings, ageRing{w * 7, fmt.Sprintf("%dw", w)})
+		}
+		return rings
+	}
+	step := 1
+	for _, s := range []int{1, 2, 3, 6, 12} {
+		step = s
+		if ageDays(zero, addMonths(zero, maxRings*step)) >= maxDay {
+			break
+		}
+	}
+	for m := step; ; m += step {
+		d := ageDays(zero, addMonths(zero, m))
+		if d > maxDay {
+			break
+		}
+		label := fmt.Sprintf("%dmo", m)
+		if m%12 == 0 {
+			label = fmt.Sprintf("%dy", m/12)
+		}
+		rings = append(rings, ageRing{d, label})
+	}
+	return rings
+}
+
+// drawCircle draws a circle of radius r around the centre of the canvas.
+func drawCircle(c *canvas, r float64, col color.Color) {
+	cx, cy := float64(c.width)/2, float64(c.height)/2
+	// Enough steps to leave no gaps between pixels.
+	n := int(2*math.Pi*r) + 1
+	for i := 0; i < n; i++ {
+		theta := float64(i) / float64(n) * 2 * math.Pi
+		c.img.Set(int(cx+r*math.Sin(theta)), int(cy-r*math.Cos(theta)), col)
+	}
+}
+
+// drawCentre marks the centre of the plot with a dot, labelled with its date.
+func (pp *polarPlot) drawCentre(c *canvas) {
+	cx, cy := c.width/2, c.height/2
+	r := int(3 * c.opts.scale())
+	for y := -r; y <= r; y++ {
+		for x := -r; x <= r; x++ {
+			if x*x+y*y <= r*r {
+				c.img.Set(cx+x, cy+y, c.th.text)
+			}
+		}
+	}
+
+	text := pp.zero.Format("2006-01-02")
+	if c.opts.Zero == "" {
+		// The centre is the birthday.
+		text = "born " + text
+	}
+	c.label(cx+2*r, cy-2*r, c.th.text, text)
+}
+
+// caption summarises what is plotted, e.g. "142 sleeps, 2024-01-01 to 2024-06-30".
+// The dates are those of -from and -to if set, or else of the first and last segment.
+// It must only be called when there is at least one segment.
+func (pp *polarPlot) caption() string {
+	var parts []string
+	first, last := int64(math.MaxInt64), int64(math.MinInt64)
+	add := func(what string, segs [][2]int64) {
+		if what != "" {
+			parts = append(parts, plural(len(segs), what))
+		}
+		for _, seg := range segs {
+			if seg[0] < first {
+				first = seg[0]
+			}
+			if seg[0] > last {
+				last = seg[0]
+			}
+		}
+	}
+	add(pp.what, pp.segments)
+	for _, ov := range pp.overlays {
+		add(ov.what, ov.segments)
+	}
+
+	from, to := pp.opts.From, pp.opts.To
+	if from == "" {
+		from = time.Unix(first, 0).In(plotLocation).Format("2006-01-02")
+	}
+	if to == "" {
+		to = time.Unix(last, 0).In(plotLocation).Format("2006-01-02")
+	}
+	parts = append(parts, from+" to "+to)
+	if pp.opts.DayStart != 0 {
+		parts = append(parts, "days from "+pp.opts.DayStart.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// plural returns n and the noun, with an "s" on the end unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// allSegments returns the plot's own segments and those of each overlay.
+func (pp *polarPlot) allSegments() [][][2]int64 {
+	all := [][][2]int64{pp.segments}
+	for _, ov := range pp.overlays {
+		all = append(all, ov.segments)
+	}
+	return all
+}
+
+// splitEpoch returns the day (since the zero) and fraction of that day of a unix time.
+// Days start at -day-start, which is at the top of the plot.
+func (pp *polarPlot) splitEpoch(x int64) (day int, frac float64) {
+	date, frac := pp.opts.DayStart.dayOf(time.Unix(x, 0).In(plotLocation))
+	return dayDiff(pp.zero, date), frac
+}
+
+// drawArc draws one segment, dayScale pixels further out per day.
+func (pp *polarPlot) drawArc(c *canvas, dayScale float64, seg [2]int64, col color.NRGBA) {
+	startD, startFrac := pp.splitEpoch(seg[0])
+	endD, endFrac := pp.splitEpoch(seg[1])
+
+	if endFrac < startFrac {
+		// This crosses the start of a day.
+		endFrac += float64(endD - startD)
+	}
+
+	// The arc is a spiral from (r0, theta0) to (r1, theta1).
+	// Take enough steps to keep points a fraction of a pixel apart,
+	// but no more than a fixed number, however long the arc.
+	r0, r1 := dayScale*float64(startD), dayScale*float64(endD)
+	theta0, theta1 := startFrac*2*math.Pi, endFrac*2*math.Pi
+	length := (theta1-theta0)*math.Max(r0, r1) + (r1 - r0)
+	n := int(math.Ceil(length/arcStepPixels)) + 1
+	if n > maxArcSteps {
+		n = maxArcSteps
+	}
+	c.samples += n + 1
+	dr, dTheta := (r1-r0)/float64(n), (theta1-theta0)/float64(n)
+
+	// Rotate incrementally rather than computing Sin/Cos at every step.
+	sin, cos := math.Sincos(theta0)
+	sinD, cosD := math.Sincos(dTheta)
+	cx, cy := float64(c.width)/2, float64(c.height)/2
+	c.line(col, func(dot func(x, y float64)) {
+		d := r0
+		for i := 0; i <= n; i++ {
+			// Start at top, go clockwise.
+			dot(cx+d*sin, cy-d*cos)
+
+			d += dr
+			sin, cos = sin*cosD+cos*sinD, cos*cosD-sin*sinD
+		}
+	})
+}
+
+const (
+	arcStepPixels = 0.25  // greatest distance between points drawn along an arc
+	maxArcSteps   = 10000 // most steps to draw any single arc in
+)
+
+// dot draws a point of a line of data, at (x, y) in pixels (see line).
+func (c *canvas) dot(x, y float64, col color.NRGBA) {
+	c.line(col, func(dot func(x, y float64)) { dot(x, y) })
+}
+
+// line draws a line of data through the points that points passes to dot, in pixels.
+// By default, each point is just the pixel containing it. With a line width of more
+// than 1, it is a disc of that width, whose edge pixels are partly covered.
+// The discs overlap, so each pixel's coverage is the most that any disc gives it,
+// and the line is composited over what is already drawn once it is complete;
+// compositing each disc in turn would darken the partly covered edges where they overlap.
+func (c *canvas) line(col color.NRGBA, points func(dot func(x, y float64))) {
+	if c.opts.LineWidth <= 1 {
+		points(func(x, y float64) { c.img.SetNRGBA(int(x), int(y), col) })
+		return
+	}
+	if c.cover == nil {
+		c.cover = image.NewAlpha(c.img.Bounds())
+	}
+	points(c.addCover)
+	c.fillCover(col)
+}
+
+// addCover adds a disc of the line width at (x, y) to the coverage of the line being drawn.
+func (c *canvas) addCover(x, y float64) {
+	r := c.opts.LineWidth / 2
+	for py := int(math.Floor(y - r)); py <= int(y+r); py++ {
+		for px := int(math.Floor(x - r)); px <= int(x+r); px++ {
+			if !image.Pt(px, py).In(c.cover.Rect) {
+				continue
+			}
+			// How far the pixel's centre is inside the disc, as an approximate coverage.
+			cover := r + 0.5 - math.Hypot(float64(px)+0.5-x, float64(py)+0.5-y)
+			if cover <= 0 {
+				continue
+			}
+			a := uint8(255 * math.Min(cover, 1))
+			i := c.cover.PixOffset(px, py)
+			if c.cover.Pix[i] == 0 {
+				c.covered = append(c.covered, i)
+			}
+			if a > c.cover.Pix[i] {
+				c.cover.Pix[i] = a
+			}
+		}
+	}
+}
+
+// fillCover composites col over the pixels covered by the line being drawn,
+// in proportion to their coverage, and then clears it for the next line.
+func (c *canvas) fillCover(col color.NRGBA) {
+	src := &image.Uniform{col}
+	for _, i := range c.covered {
+		stride := c.cover.Stride
+		p := c.cover.Rect.Min.Add(image.Pt(i%stride, i/stride))
+		mask := &image.Uniform{color.Alpha{c.cover.Pix[i]}}
+		draw.DrawMask(c.img, image.Rect(p.X, p.Y, p.X+1, p.Y+1), src, image.ZP, mask, image.ZP, draw.Over)
+		c.cover.Pix[i] = 0
+	}
+	c.covered = c.covered[:0]
+}
+
+// drawMark draws a small square dot at distance d and angle theta from the centre.
+func drawMark(c *canvas, d, theta float64, col color.NRGBA) {
+	x := float64(c.width)/2 + d*math.Sin(theta)
+	y := float64(c.height)/2 + d*-math.Cos(theta)
+	mark := int(2 * c.opts.scale())
+	draw.Draw(c.img, image.Rect(int(x)-mark, int(y)-mark, int(x)+mark+1, int(y)+mark+1), &image.Uniform{col}, image.ZP, draw.Src)
+}
+
+// maxLabelLen is the most characters of a label to draw.
+const maxLabelLen = 16
+
+// drawLabel marks the start of segment i, which is at distance d and angle theta
+// from the centre, and writes its label next to it.
+func (pp *polarPlot) drawLabel(c *canvas, i int, d, theta float64, col color.NRGBA) {
+	drawMark(c, d, theta, col)
+
+	text := pp.labels[i]
+	if r := []rune(text); len(r) > maxLabelLen {
+		text = string(r[:maxLabelLen-1]) + "…"
+	}
+	// Nearby labels often overlap, so stagger them outwards.
+	off := float64(c.lineHeight) / 2 * float64(1+i%3)
+	lx := float64(c.width)/2 + (d+off)*math.Sin(theta)
+	ly := float64(c.height)/2 + (d+off)*-math.Cos(theta)
+	c.label(int(lx), int(ly), c.th.text, text)
+}
+
+// The font for plot text is loaded on first use, and then shared.
+var (
+	plotFontOnce sync.Once
+	plotFont     *truetype.Font
+	plotFontErr  error
+)
+
+// loadFont returns the font for plot text.
+// It is safe to call concurrently.
+func loadFont() (*truetype.Font, error) {
+	plotFontOnce.Do(func() {
+		// TODO: have a list of fonts to load.
+		fdata, err := ioutil.ReadFile("/System/Library/Fonts/SFNS.ttf")
+		if err != nil {
+			plotFontErr = fmt.Errorf("loading font file: %w", err)
+			return
+		}
+		plotFont, err = freetype.ParseFont(fdata)
+		if err != nil {
+			plotFontErr = fmt.Errorf("parsing font data: %w", err)
+		}
+	})
+	return plotFont, plotFontErr
+}
+
+func writeText(img *image.NRGBA, dpi float64, x, y int, col color.Color, size float64, text string) error {
+	f, err := loadFont()
+	if err != nil {
+		return err
+	}
+	ctx := freetype.NewContext()
+	ctx.SetDst(img)
+	ctx.SetDPI(dpi)
+	ctx.SetClip(img.Bounds())
+	ctx.SetFont(f)
+	ctx.SetFontSize(size)
+	ctx.SetSrc(&image.Uniform{col})
+	_, err = ctx.DrawString(text, freetype.Pt(x, y))
+	return err
+}
+
+// dayDiff reports the number of calendar days between the given times.
+// Zero means start and end are on the same day.
+// If end is before start, which means bad data, it logs a warning and reports zero.
+func dayDiff(start, end time.Time) (days int) {
+	if start.After(end) {
+		log.Printf("Warning: ignoring inverted time range %v to %v", start, end)
+		return 0
+	}
+
+	// Extract the calendar dates in the correct time zone, then do the computation in UTC,
+	// which is simply dividing the unix epoch difference by 86400.
+	sY, sM, sD := start.Date()
+	eY, eM, eD := end.Date()
+	s0 := time.Date(sY, sM, sD, 0, 0, 0, 0, time.UTC)
+	e0 := time.Date(eY, eM, eD, 0, 0, 0, 0, time.UTC)
+
+	return int(e0.Unix()-s0.Unix()) / 86400
+}
+
+// splitByDay splits the time range [start, end) at the start of each day (see dayOf),
+// calling fn with the number of days since zero and the duration within that day.
+// The range shouldn't start before zero's day; if it does, that part counts as day zero.
+func (ds ClockTime) splitByDay(zero, start, end time.Time, fn func(day int, dur time.Duration)) {
+	for start.Before(end) {
+		date, _ := ds.dayOf(start)
+		next := ds.dayStart(date.AddDate(0, 0, 1))
+		if next.After(end) {
+			next = end
+		}
+		day := ageDays(zero, date)
+		if day < 0 {
+			day = 0
+		}
+		fn(day, next.Sub(start))
+		start = next
+	}
+}
+
+// dayOf returns the day that t falls in, as midnight at the start of its date,
+// and how far through that day t is, as a fraction. Days start at ds,
+// so with -day-start 07:00, 3am belongs to the day before.
+//
+// The day start is read off the wall clock, like midnight. On the days that
+// daylight saving starts or ends, a day is an hour shorter or longer. If the
+// clocks skip over the day start, the day starts when they change; if they go
+// back over it, the day starts the first time, though times in the repeated
+// hour that read earlier than the day start still count for the day before.
+func (ds ClockTime) dayOf(t time.Time) (date time.Time, frac float64) {
+	y, m, d := t.Date()
+	h, mi, s := t.Clock()
+	secs := 60*60*h + 60*mi + s - 60*int(ds)
+	if secs < 0 {
+		d--
+		secs += 24 * 60 * 60
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location()), float64(secs) / (24 * 60 * 60)
+}
+
+// dayStart returns when the day on date starts, which is ds on that date.
+func (ds ClockTime) dayStart(date time.Time) time.Time {
+	y, m, d := date.Date()
+	want := int(ds)
+	t := time.Date(y, m, d, want/60, want%60, 0, 0, date.Location())
+	if h, mi, _ := t.Clock(); 60*h+mi != want {
+		// The clocks skipped that time, and time.Date may have moved it either way.
+		// Find when they changed by searching from a little before.
+		date = time.Date(y, m, d, 0, 0, 0, 0, date.Location())
+		t = t.Add(-3 * time.Hour).Truncate(time.Minute)
+		for {
+			if td, _ := ds.dayOf(t); td.Equal(date) {
+				break
+			}
+			t = t.Add(time.Minute)
+		}
+		return t
+	}
+	// If the clocks went back over that time, it happened twice; the day starts the first time.
+	_, before := t.Add(-3 * time.Hour).Zone()
+	_, after := t.Zone()
+	if e := t.Add(time.Duration(after-before) * time.Second); before > after && e.Format("15:04") == t.Format("15:04") {
+		t = e
+	}
+	return t
+}
+
+// dayNumber returns the number of days (see dayOf) from the day starting on zero's date to t's day.
+func (ds ClockTime) dayNumber(zero, t time.Time) int {
+	date, _ := ds.dayOf(t)
+	return ageDays(zero, date)
+}
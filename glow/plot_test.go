@@ -0,0 +1,856 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"math"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestPlotTypes checks that every plot type in PlotTypes, and a key= one, produces a PNG.
+func TestPlotTypes(t *testing.T) {
+	db := newTestDB(t)
+	// A week of a little of everything, from the day after birth.
+	var stmts []string
+	for d := 1; d <= 7; d++ {
+		day := time.Date(2024, time.January, 1+d, 0, 0, 0, 0, time.Local).Unix()
+		stmts = append(stmts, fmt.Sprintf(`
+			INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key, ValStr) VALUES
+				(1, %[1]d + 3600, %[1]d + 4*3600, "sleep", ""),
+				(1, %[1]d + 10*3600, %[1]d + 11*3600, "sleep", ""),
+				(1, %[1]d + 9*3600, %[1]d + 9*3600 + 600, "tummy", ""),
+				(1, %[1]d + 12*3600, NULL, "medicine", "Paracetamol");
+			INSERT INTO BabyData(BabyID, StartTimestamp, Key, ValFloat) VALUES
+				(1, %[1]d + 13*3600, "weight", 3.5 + 0.03*%[2]d),
+				(1, %[1]d + 13*3600, "height", 50 + 0.1*%[2]d);
+			INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML) VALUES
+				(1, %[1]d + 5*3600, 1, "B", 600, 600, 0),
+				(1, %[1]d + 8*3600, 2, "", 0, 0, 90),
+				(1, %[1]d + 14*3600, 1, "L", 900, 0, 0);`, day, d))
+	}
+	if _, err := db.Exec(strings.Join(stmts, "")); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	// Both a key with end times and one without.
+	types := append(PlotTypes[:len(PlotTypes):len(PlotTypes)], "key=sleep", "key=medicine")
+	for _, typ := range types {
+		data, err := Plot(context.Background(), db, typ, PlotOptions{})
+		if err != nil {
+			t.Errorf("plot %s: %v", typ, err)
+			continue
+		}
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("plot %s didn't produce a PNG: %v", typ, err)
+		}
+	}
+
+	// Without anything to plot, each type fails rather than exiting,
+	// since it may be one of several plots being rendered at once.
+	empty := newTestDB(t)
+	for _, typ := range types {
+		if _, err := Plot(context.Background(), empty, typ, PlotOptions{}); err == nil {
+			t.Errorf("plot %s with nothing recorded succeeded, want error", typ)
+		}
+	}
+}
+
+func TestBabyDests(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (2, "Bea Mae", "Test", "2024-01-01")`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	collect := func(baby, dst string) ([]string, error) {
+		dests, err := BabyDests(context.Background(), db, Selection{Baby: baby}, dst)
+		if err != nil {
+			return nil, err
+		}
+		var got []string
+		for _, d := range dests {
+			info, err := loadBaby(context.Background(), db, Selection{Baby: d.Baby})
+			if err != nil {
+				return nil, err
+			}
+			got = append(got, fmt.Sprintf("%d:%s", info.babyID, d.Dst))
+		}
+		return got, nil
+	}
+
+	got, err := collect("2", "sleep.png")
+	if want := []string{"2:sleep.png"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("With -baby 2, BabyDests gave %q, %v; want %q", got, err, want)
+	}
+
+	got, err = collect("all", "out/sleep-{name}-{babyid}.png")
+	if want := []string{"1:out/sleep-Ada-1.png", "2:out/sleep-Bea-Mae-2.png"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("With -baby all, BabyDests gave %q, %v; want %q", got, err, want)
+	}
+	if _, err := collect("all", "sleep.png"); err == nil {
+		t.Errorf("With -baby all and no placeholders, BabyDests succeeded, want error")
+	}
+	if _, err := loadBaby(context.Background(), db, Selection{Baby: "all"}); err == nil {
+		t.Errorf("With -baby all, loadBaby succeeded, want error")
+	}
+}
+
+func TestSplitByDay(t *testing.T) {
+	// Sydney has DST transitions on 2024-04-07 (25 hour day)
+	// and 2024-10-06 (23 hour day).
+	loc, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	at := func(mon time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, mon, day, hour, min, 0, 0, loc)
+	}
+	zero := at(time.April, 1, 0, 0)
+
+	type split struct {
+		day int
+		dur time.Duration
+	}
+	tests := []struct {
+		desc       string
+		start, end time.Time
+		want       []split
+	}{
+		{"within a day", at(time.April, 2, 13, 0), at(time.April, 2, 15, 30), []split{{1, 150 * time.Minute}}},
+		{"across midnight", at(time.April, 2, 22, 0), at(time.April, 3, 6, 0), []split{{1, 2 * time.Hour}, {2, 6 * time.Hour}}},
+		{"ending at midnight", at(time.April, 2, 22, 0), at(time.April, 3, 0, 0), []split{{1, 2 * time.Hour}}},
+		{"empty", at(time.April, 2, 22, 0), at(time.April, 2, 22, 0), nil},
+		{"DST end", at(time.April, 6, 22, 0), at(time.April, 8, 1, 0), []split{{5, 2 * time.Hour}, {6, 25 * time.Hour}, {7, 1 * time.Hour}}},
+		{"DST start", at(time.October, 5, 23, 0), at(time.October, 7, 0, 0), []split{{187, 1 * time.Hour}, {188, 23 * time.Hour}}},
+	}
+	for _, test := range tests {
+		var got []split
+		ClockTime(0).splitByDay(zero, test.start, test.end, func(day int, dur time.Duration) {
+			got = append(got, split{day, dur})
+		})
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: splitByDay(%v, %v) = %v, want %v", test.desc, test.start, test.end, got, test.want)
+		}
+	}
+}
+
+func TestDayDiff(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	at := func(mon time.Month, day, hour int) time.Time {
+		return time.Date(2024, mon, day, hour, 0, 0, 0, loc)
+	}
+	tests := []struct {
+		desc       string
+		start, end time.Time
+		want       int
+	}{
+		{"same day", at(time.April, 2, 1), at(time.April, 2, 23), 0},
+		{"next day", at(time.April, 2, 23), at(time.April, 3, 1), 1},
+		{"across DST end", at(time.April, 6, 12), at(time.April, 8, 12), 2},
+		{"across DST start", at(time.October, 5, 12), at(time.October, 7, 12), 2},
+		{"inverted", at(time.April, 3, 1), at(time.April, 2, 23), 0},
+		{"inverted by days", at(time.May, 1, 0), at(time.April, 1, 0), 0},
+	}
+	for _, test := range tests {
+		if got := dayDiff(test.start, test.end); got != test.want {
+			t.Errorf("%s: dayDiff(%v, %v) = %d, want %d", test.desc, test.start, test.end, got, test.want)
+		}
+	}
+}
+
+func TestDayOf(t *testing.T) {
+	var ds ClockTime
+	if err := ds.Set("07:00"); err != nil {
+		t.Fatalf("Setting a ClockTime: %v", err)
+	}
+	for _, bad := range []string{"7am", "25:00", "07:60", ""} {
+		var ct ClockTime
+		if err := ct.Set(bad); err == nil {
+			t.Errorf("Setting a ClockTime to %q succeeded, want error", bad)
+		}
+	}
+
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	at := func(mon time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, mon, day, hour, min, 0, 0, loc)
+	}
+	tests := []struct {
+		t    time.Time
+		date string
+		frac float64
+	}{
+		{at(time.January, 2, 7, 0), "2024-01-02", 0},
+		{at(time.January, 2, 19, 0), "2024-01-02", 0.5},
+		{at(time.January, 3, 1, 0), "2024-01-02", 0.75},
+		{at(time.January, 3, 6, 59), "2024-01-02", 1 - 1.0/(24*60)},
+		{at(time.January, 1, 0, 0), "2023-12-31", 17.0 / 24},
+	}
+	for _, test := range tests {
+		date, frac := ds.dayOf(test.t)
+		if date.Format("2006-01-02") != test.date || math.Abs(frac-test.frac) > 1e-9 {
+			t.Errorf("dayOf(%v) = %s, %v; want %s, %v", test.t, date.Format("2006-01-02"), frac, test.date, test.frac)
+		}
+	}
+
+	// Sleep from 8pm to 6am is one night, and the day after starts at 7am.
+	var got []string
+	ds.splitByDay(at(time.January, 1, 0, 0), at(time.January, 1, 20, 0), at(time.January, 2, 9, 0), func(day int, dur time.Duration) {
+		got = append(got, fmt.Sprintf("%d:%v", day, dur))
+	})
+	if want := []string{"0:11h0m0s", "1:2h0m0s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitByDay with -day-start 07:00 gave %v, want %v", got, want)
+	}
+
+	// In New York, 2:30am didn't happen on 2024-03-10, and 1:30am happened twice on 2024-11-03.
+	for _, test := range []struct {
+		dayStart string
+		date     time.Time
+		want     string
+	}{
+		{"02:30", at(time.March, 9, 0, 0), "2024-03-09 02:30:00 -0500 EST"},
+		{"02:30", at(time.March, 10, 0, 0), "2024-03-10 03:00:00 -0400 EDT"},
+		{"02:30", at(time.November, 3, 0, 0), "2024-11-03 02:30:00 -0500 EST"},
+		{"01:30", at(time.November, 3, 0, 0), "2024-11-03 01:30:00 -0400 EDT"},
+	} {
+		ds.Set(test.dayStart)
+		if got := ds.dayStart(test.date).String(); got != test.want {
+			t.Errorf("With -day-start %s, dayStart(%s) = %s, want %s", test.dayStart, test.date.Format("2006-01-02"), got, test.want)
+		}
+	}
+	ds.Set("02:30")
+	got = nil
+	ds.splitByDay(at(time.March, 9, 0, 0), at(time.March, 9, 20, 0), at(time.March, 10, 9, 0), func(day int, dur time.Duration) {
+		got = append(got, fmt.Sprintf("%d:%v", day, dur))
+	})
+	if want := []string{"0:6h0m0s", "1:6h0m0s"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitByDay across the start of daylight saving gave %v, want %v", got, want)
+	}
+}
+
+func TestDropBeforeZero(t *testing.T) {
+	zero := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.Local)
+	z := zero.Unix()
+	pp := polarPlot{
+		zero:     zero,
+		segments: [][2]int64{{z - 3600, z - 60}, {z - 60, z + 60}, {z, z + 60}, {z + 3600, z + 7200}},
+		labels:   []string{"a", "b", "c", "d"},
+	}
+	pp.dropBeforeZero()
+	wantSegs := [][2]int64{{z, z + 60}, {z + 3600, z + 7200}}
+	if !reflect.DeepEqual(pp.segments, wantSegs) {
+		t.Errorf("after dropBeforeZero, segments = %v, want %v", pp.segments, wantSegs)
+	}
+	if want := []string{"c", "d"}; !reflect.DeepEqual(pp.labels, want) {
+		t.Errorf("after dropBeforeZero, labels = %q, want %q", pp.labels, want)
+	}
+
+	// Overlays are trimmed the same way.
+	pp = polarPlot{
+		zero:     zero,
+		overlays: []polarOverlay{{segments: [][2]int64{{z - 60, z - 60}, {z + 60, z + 60}}}},
+	}
+	pp.dropBeforeZero()
+	if want := [][2]int64{{z + 60, z + 60}}; !reflect.DeepEqual(pp.overlays[0].segments, want) {
+		t.Errorf("after dropBeforeZero, overlay segments = %v, want %v", pp.overlays[0].segments, want)
+	}
+
+	// Everything before zero leaves nothing to render, which should be an error rather than a panic.
+	pp = polarPlot{zero: zero, segments: [][2]int64{{z - 60, z - 30}}}
+	if _, err := pp.Render(context.Background()); err == nil {
+		t.Errorf("Render with only pre-zero segments succeeded, want error")
+	}
+}
+
+func TestCaption(t *testing.T) {
+	day := func(d int) int64 { return time.Date(2024, time.January, d, 12, 0, 0, 0, time.Local).Unix() }
+	pp := polarPlot{
+		what:     "sleep",
+		segments: [][2]int64{{day(2), day(2) + 60}, {day(5), day(5) + 60}},
+		overlays: []polarOverlay{{what: "feed", segments: [][2]int64{{day(1), day(1)}}}},
+	}
+	if got, want := pp.caption(), "2 sleeps, 1 feed, 2024-01-01 to 2024-01-05"; got != want {
+		t.Errorf("caption = %q, want %q", got, want)
+	}
+	pp.opts.From, pp.opts.To = "2023-12-25", "2024-01-31"
+	if got, want := pp.caption(), "2 sleeps, 1 feed, 2023-12-25 to 2024-01-31"; got != want {
+		t.Errorf("caption with -from/-to = %q, want %q", got, want)
+	}
+	pp.opts.DayStart = 7 * 60
+	if got, want := pp.caption(), "2 sleeps, 1 feed, 2023-12-25 to 2024-01-31, days from 07:00"; got != want {
+		t.Errorf("caption with -day-start = %q, want %q", got, want)
+	}
+}
+
+func TestAgeRings(t *testing.T) {
+	zero := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		maxDay int
+		want   []ageRing
+	}{
+		{20, []ageRing{{7, "1w"}, {14, "2w"}}},
+		{100, []ageRing{{14, "2w"}, {28, "4w"}, {42, "6w"}, {56, "8w"}, {70, "10w"}, {84, "12w"}, {98, "14w"}}},
+		{130, []ageRing{{31, "1mo"}, {60, "2mo"}, {91, "3mo"}, {121, "4mo"}}},
+		{800, []ageRing{{182, "6mo"}, {366, "1y"}, {547, "18mo"}, {731, "2y"}}},
+	}
+	for _, test := range tests {
+		if got := ageRings(zero, test.maxDay); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ageRings(%d days) = %v, want %v", test.maxDay, got, test.want)
+		}
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{5 * time.Hour, "5h"},
+		{90 * time.Minute, "1.5h"},
+		{100 * time.Minute, "1.67h"},
+		{45 * time.Minute, "45m"},
+		{90 * time.Second, "1.5m"},
+	}
+	for _, test := range tests {
+		if got := shortDuration(test.d); got != test.want {
+			t.Errorf("shortDuration(%v) = %q, want %q", test.d, got, test.want)
+		}
+	}
+}
+
+func TestPolarZero(t *testing.T) {
+	bday := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local)
+
+	if got, err := polarZero(bday, ""); err != nil || !got.Equal(bday) {
+		t.Errorf("polarZero without a zero date = %v, %v; want the birthday", got, err)
+	}
+	want := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.Local)
+	if got, err := polarZero(bday, "2024-03-15"); err != nil || !got.Equal(want) {
+		t.Errorf("polarZero(_, %q) = %v, %v; want %v", "2024-03-15", got, err, want)
+	}
+	if _, err := polarZero(bday, "15/03/2024"); err == nil {
+		t.Errorf("polarZero with a bad zero date succeeded, want error")
+	}
+}
+
+// benchPolarPlot returns a polar plot of two years of synthetic sleep,
+// with several sleeps of varying length each day.
+func benchPolarPlot() *polarPlot {
+	zero := time.Date(2022, time.January, 1, 0, 0, 0, 0, time.Local)
+	pp := &polarPlot{
+		what: "sleep",
+		zero: zero,
+		colSelect: func(startD, endD int, startFrac, endFrac float64) color.NRGBA {
+			return color.NRGBA{0, 0, 255, 255}
+		},
+	}
+	for d := 0; d < 730; d++ {
+		day := zero.AddDate(0, 0, d)
+		for _, s := range [][2]time.Duration{{1 * time.Hour, 3 * time.Hour}, {9 * time.Hour, 30 * time.Minute}, {13 * time.Hour, 2 * time.Hour}, {19 * time.Hour, 10 * time.Hour}} {
+			start := day.Add(s[0])
+			pp.AddSegment(start.Unix(), start.Add(s[1]).Unix())
+		}
+	}
+	return pp
+}
+
+func BenchmarkRender(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		pp := benchPolarPlot()
+		if _, err := pp.Render(context.Background()); err != nil {
+			b.Fatalf("Render: %v", err)
+		}
+	}
+}
+
+// BenchmarkRenderEach renders a batch of plots one at a time and then in parallel,
+// to show the speedup from RenderEach. Run it with -cpu to vary the parallelism.
+func BenchmarkRenderEach(b *testing.B) {
+	const n = 8
+	for _, bm := range []struct {
+		name    string
+		workers int
+	}{
+		{"serial", 1},
+		{"parallel", runtime.GOMAXPROCS(0)},
+	} {
+		workers := bm.workers
+		b.Run(bm.name, func(b *testing.B) {
+			defer func(w int) { renderWorkers = w }(renderWorkers)
+			renderWorkers = workers
+			pps := make([]*polarPlot, n)
+			for i := range pps {
+				pps[i] = benchPolarPlot()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := RenderEach(context.Background(), n, func(ctx context.Context, i int) error {
+					_, err := pps[i].Render(ctx)
+					return err
+				})
+				if err != nil {
+					b.Fatalf("RenderEach: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEach(t *testing.T) {
+	defer func(w int) { renderWorkers = w }(renderWorkers)
+	renderWorkers = 3
+
+	var mu sync.Mutex
+	var running, most int
+	done := make([]bool, 10)
+	err := RenderEach(context.Background(), len(done), func(ctx context.Context, i int) error {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		done[i] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("RenderEach: %v", err)
+	}
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("RenderEach didn't call fn(%d)", i)
+		}
+	}
+	if most > renderWorkers {
+		t.Errorf("RenderEach ran %d calls at once, want at most %d", most, renderWorkers)
+	}
+
+	// The first error is returned, and the rest see a cancelled context.
+	bad := errors.New("bad plot")
+	var cancelled int
+	err = RenderEach(context.Background(), 10, func(ctx context.Context, i int) error {
+		if i == 0 {
+			return bad
+		}
+		<-ctx.Done()
+		mu.Lock()
+		cancelled++
+		mu.Unlock()
+		return ctx.Err()
+	})
+	if err != bad {
+		t.Errorf("RenderEach with a failing plot = %v, want %v", err, bad)
+	}
+	if cancelled != 9 {
+		t.Errorf("After the first error, %d other calls saw the context cancelled, want 9", cancelled)
+	}
+}
+
+// cancelAfter is a context that reports itself cancelled after n checks.
+type cancelAfter struct {
+	context.Context
+	n, checks int
+}
+
+func (c *cancelAfter) Err() error {
+	c.checks++
+	if c.checks > c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestRenderCancel(t *testing.T) {
+	pp := benchPolarPlot()
+	ctx := &cancelAfter{Context: context.Background(), n: 5}
+	if _, err := pp.Render(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Render with a context cancelled part way through: got error %v, want %v", err, context.Canceled)
+	}
+	if want := ctx.n + 1; ctx.checks != want {
+		t.Errorf("Render checked the context %d times, want it to stop at the first check after cancellation (%d)", ctx.checks, want)
+	}
+
+	ctx = &cancelAfter{Context: context.Background(), n: 1 << 30}
+	if _, err := pp.Render(ctx); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if min := len(pp.segments) / renderCheckEvery; ctx.checks < min {
+		t.Errorf("Render checked the context %d times for %d segments, want at least %d", ctx.checks, len(pp.segments), min)
+	}
+}
+
+func TestPlotSleepOverview(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := plotSleepOverview(context.Background(), db, PlotOptions{}.withDefaults()); err == nil {
+		t.Errorf("plotSleepOverview with no sleep succeeded, want error")
+	}
+
+	var stmts []string
+	stmts = append(stmts, `INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (2, "Bo", "Test", "2024-01-01");`)
+	for d := 1; d <= 7; d++ {
+		day := time.Date(2024, time.January, 1+d, 0, 0, 0, 0, time.Local).Unix()
+		stmts = append(stmts, fmt.Sprintf(`
+			INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+				(1, %[1]d + 3600, %[1]d + (4+%[2]d%%3)*3600, "sleep"),
+				(2, %[1]d + 3600, %[1]d + (8-%[2]d%%2)*3600, "sleep");`, day, d))
+	}
+	if _, err := db.Exec(strings.Join(stmts, "")); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	data, err := plotSleepOverview(context.Background(), db, PlotOptions{}.withDefaults())
+	if err != nil {
+		t.Fatalf("plotSleepOverview: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decoding plot: %v", err)
+	}
+	// Each baby should get a line in its own colour.
+	pal := PlotOptions{}.withDefaults().plotPalette()
+	found := make(map[color.NRGBA]bool)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			found[color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)] = true
+		}
+	}
+	for _, col := range []color.NRGBA{pal.long, pal.short} {
+		if !found[col] {
+			t.Errorf("sleep overview has no pixels of colour %v", col)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+			(1, 1704160800, 1704164400, "sleep"),
+			(1, 1704247200, 1704250800, "sleep"),
+			(1, 1704333600, 1704337200, "sleep"),
+			(1, 1704420000, 1704423600, "sleep");
+		INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight) VALUES
+			(1, 1704160800, 2, "", 0, 0),
+			(1, 1704247200, 2, "", 0, 0),
+			(1, 1704333600, 4, "", 0, 0),
+			(1, 1704420000, 4, "", 0, 0);`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	for _, tc := range []struct {
+		limit int
+		want  [][2]int64
+	}{
+		{0, [][2]int64{{1704160800, 1704164400}, {1704247200, 1704250800}, {1704333600, 1704337200}, {1704420000, 1704423600}}},
+		{2, [][2]int64{{1704333600, 1704337200}, {1704420000, 1704423600}}},
+		{10, [][2]int64{{1704160800, 1704164400}, {1704247200, 1704250800}, {1704333600, 1704337200}, {1704420000, 1704423600}}},
+	} {
+		got, err := loadSegments(context.Background(), db, Selection{Limit: tc.limit}, 1, "sleep")
+		if err != nil {
+			t.Fatalf("loadSegments with -limit %d: %v", tc.limit, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("loadSegments with -limit %d = %v, want %v", tc.limit, got, tc.want)
+		}
+	}
+
+	// The newest events are pumping sessions, which mustn't use up the limit for feeds.
+	sel := Selection{Limit: 1}
+	feeds, err := loadFeeds(context.Background(), db, sel, 1)
+	if err != nil {
+		t.Fatalf("loadFeeds with -limit 1: %v", err)
+	}
+	if len(feeds) != 1 || feeds[0].start != 1704247200 {
+		t.Errorf("loadFeeds with -limit 1 = %+v, want the feed starting at 1704247200", feeds)
+	}
+	pumps, err := loadPumps(context.Background(), db, sel, 1)
+	if err != nil {
+		t.Fatalf("loadPumps with -limit 1: %v", err)
+	}
+	if len(pumps) != 1 || pumps[0].start != 1704420000 {
+		t.Errorf("loadPumps with -limit 1 = %+v, want the pumping session starting at 1704420000", pumps)
+	}
+}
+
+func TestDrawnFeedDuration(t *testing.T) {
+	tests := []struct {
+		min   time.Duration
+		scale bool
+		in    int64
+		want  int64
+	}{
+		{0, false, 0, 0},
+		{0, false, 1800, 1800},
+		{5 * time.Minute, false, 60, 300},
+		{5 * time.Minute, false, 1800, 1800},
+		{0, true, 0, 0},
+		{0, true, 60, 600},
+		{0, true, 3600, 3558},
+		{0, true, 7200, 4151},
+		{20 * time.Minute, true, 60, 1200},
+	}
+	for _, test := range tests {
+		opts := PlotOptions{MinArc: test.min, ScaleFeed: test.scale}
+		if got := drawnFeedDuration(test.in, opts); got != test.want {
+			t.Errorf("drawnFeedDuration(%d) with MinArc %v ScaleFeed %t = %d, want %d", test.in, test.min, test.scale, got, test.want)
+		}
+	}
+
+	// Scaling keeps the order of durations.
+	opts := PlotOptions{ScaleFeed: true}
+	for d := int64(1); d < 4*3600; d += 7 {
+		if drawnFeedDuration(d+7, opts) < drawnFeedDuration(d, opts) {
+			t.Fatalf("drawnFeedDuration(%d) = %d is less than drawnFeedDuration(%d) = %d", d+7, drawnFeedDuration(d+7, opts), d, drawnFeedDuration(d, opts))
+		}
+	}
+}
+
+func TestRenderVerbose(t *testing.T) {
+	useTestFont(t) // so a missing system font isn't logged
+	defer log.SetOutput(log.Writer())
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+
+	pp := benchPolarPlot()
+	if _, err := pp.Render(context.Background()); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Render without Verbose logged %q, want nothing", buf.String())
+	}
+
+	pp.opts.Verbose = true
+	if _, err := pp.Render(context.Background()); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	m := regexp.MustCompile(`Rendered (\d+) segments \((\d+) samples\) in `).FindStringSubmatch(buf.String())
+	if m == nil {
+		t.Fatalf("Render with -v logged %q, want rendering stats", buf.String())
+	}
+	if want := strconv.Itoa(len(pp.segments)); m[1] != want {
+		t.Errorf("Render with -v reported %s segments, want %s", m[1], want)
+	}
+	// Every segment takes at least two samples.
+	if n, _ := strconv.Atoi(m[2]); n < 2*len(pp.segments) {
+		t.Errorf("Render with -v reported %d samples for %d segments, want at least %d", n, len(pp.segments), 2*len(pp.segments))
+	}
+}
+
+// useTestFont makes plot text use the Go font, which is the same everywhere,
+// instead of whatever the system has, until the end of the test.
+func useTestFont(t *testing.T) {
+	f, err := truetype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatalf("Parsing Go font: %v", err)
+	}
+	font, fontErr := plotFont, plotFontErr
+	t.Cleanup(func() {
+		plotFont, plotFontErr = font, fontErr
+		if font == nil && fontErr == nil {
+			plotFontOnce = sync.Once{} // not loaded yet, so let loadFont do it
+		}
+	})
+	plotFontOnce.Do(func() {}) // so loadFont won't replace it
+	plotFont, plotFontErr = f, nil
+}
+
+// TestPlotGolden checks a sleep plot against testdata/sleep.png.
+// Run with -update to rewrite it after an intended change to rendering.
+func TestPlotGolden(t *testing.T) {
+	useTestFont(t)
+	defer func(loc *time.Location) { plotLocation = loc }(plotLocation)
+	plotLocation = time.FixedZone("AEST", 10*60*60)
+
+	db := newTestDB(t)
+	var stmts []string
+	for d := 1; d <= 28; d++ {
+		day := time.Date(2024, time.January, 1+d, 0, 0, 0, 0, plotLocation).Unix()
+		stmts = append(stmts, fmt.Sprintf(`
+			INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key, ValStr) VALUES
+				(1, %[1]d - 2*3600 + %[2]d*60, %[1]d + 5*3600, "sleep", ""),
+				(1, %[1]d + 9*3600, %[1]d + 10*3600 + %[2]d*120, "sleep", ""),
+				(1, %[1]d + 14*3600, %[1]d + 14*3600 + 1200, "sleep", "");`, day, d))
+	}
+	if _, err := db.Exec(strings.Join(stmts, "")); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	data, err := Plot(context.Background(), db, "sleep", PlotOptions{})
+	if err != nil {
+		t.Fatalf("plot sleep: %v", err)
+	}
+	again, err := Plot(context.Background(), db, "sleep", PlotOptions{})
+	if err != nil {
+		t.Fatalf("plot sleep: %v", err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Errorf("Plotting the same data twice gave different PNGs")
+	}
+
+	golden := filepath.Join("testdata", "sleep.png")
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, data, 0644); err != nil {
+			t.Fatalf("Writing golden file: %v", err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Reading golden file: %v", err)
+	}
+	if bytes.Equal(data, want) {
+		return
+	}
+	// Floating point differences between platforms may move a few pixels,
+	// so tolerate small differences.
+	gotImg, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decoding plot: %v", err)
+	}
+	wantImg, err := png.Decode(bytes.NewReader(want))
+	if err != nil {
+		t.Fatalf("Decoding golden file: %v", err)
+	}
+	if diff, total := imageDiff(gotImg, wantImg); diff > total/1000 {
+		t.Errorf("Plot differs from %s in %d of %d pixels; if that's intended, rerun with -update", golden, diff, total)
+	}
+}
+
+// imageDiff reports how many pixels of a and b differ noticeably, and how many there are.
+// Images of different sizes differ everywhere.
+func imageDiff(a, b image.Image) (diff, total int) {
+	bounds := a.Bounds()
+	total = bounds.Dx() * bounds.Dy()
+	if bounds != b.Bounds() {
+		return total, total
+	}
+	const tolerance = 0x800 // of 0xffff, per channel
+	near := func(x, y uint32) bool {
+		return x <= y+tolerance && y <= x+tolerance
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if !near(r1, r2) || !near(g1, g2) || !near(b1, b2) || !near(a1, a2) {
+				diff++
+			}
+		}
+	}
+	return diff, total
+}
+
+func TestTextFallback(t *testing.T) {
+	plotFontOnce.Do(func() {}) // so loadFont won't replace the error
+	defer func(f *truetype.Font, err error) { plotFont, plotFontErr = f, err }(plotFont, plotFontErr)
+	plotFont, plotFontErr = nil, errors.New("no font here")
+
+	c := newCanvas(PlotOptions{})
+	c.header("Title", "caption", nil)
+	if c.font == nil {
+		t.Fatalf("Drawing without a font didn't record the error")
+	}
+	// Some of the header area should now be drawn in the text colour.
+	want := color.NRGBAModel.Convert(c.th.text)
+	var n int
+	for y := 0; y < c.pad+3*c.lineHeight; y++ {
+		for x := 0; x < c.width/2; x++ {
+			if c.img.At(x, y) == want {
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		t.Errorf("Drawing without a font left the header blank")
+	}
+}
+
+func TestDot(t *testing.T) {
+	col := color.NRGBA{0, 0, 255, 255}
+	count := func(width float64) (full, partial int) {
+		c := newCanvas(PlotOptions{LineWidth: width})
+		c.dot(100.5, 100.5, col)
+		for y := 90; y < 110; y++ {
+			for x := 90; x < 110; x++ {
+				switch p := c.img.NRGBAAt(x, y); {
+				case p == col:
+					full++
+				case p.B > p.R: // blended towards blue over the white background
+					partial++
+				}
+			}
+		}
+		return full, partial
+	}
+	if full, partial := count(1); full != 1 || partial != 0 {
+		t.Errorf("With -linewidth 1, dot drew %d full and %d partial pixels, want just 1 full", full, partial)
+	}
+	// A disc 4 pixels across has an area of about 12.6 pixels.
+	if full, partial := count(4); full < 9 || full > 16 || partial == 0 {
+		t.Errorf("With -linewidth 4, dot drew %d full and %d partial pixels, want 9-16 full and some partial", full, partial)
+	}
+}
+
+func TestWideLineEdges(t *testing.T) {
+	col := color.NRGBA{0, 0, 255, 255}
+	c := newCanvas(PlotOptions{LineWidth: 4})
+	drawDataLine(c, 50, 100, 150, 100, col)
+	// Along the middle, the row 2 pixels from the line's centre is half covered.
+	// Overlapping discs mustn't build that up into a solid edge.
+	if p := c.img.NRGBAAt(100, 102); p.R < 100 || p.R > 160 {
+		t.Errorf("Edge pixel of a 4 pixel wide line is %v, want about half blended with white", p)
+	}
+	if p := c.img.NRGBAAt(100, 100); p != col {
+		t.Errorf("Centre pixel of a 4 pixel wide line is %v, want %v", p, col)
+	}
+}
+
+func TestPlotKeyErrors(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key, ValStr) VALUES
+			(1, 1704100000, 1704103600, "sleep", ""),
+			(1, 1704110000, NULL, "temperature", "")`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	if _, err := Plot(context.Background(), db, "key=", PlotOptions{}); err == nil {
+		t.Errorf("plot key= succeeded, want error")
+	}
+	_, err := Plot(context.Background(), db, "key=nappy", PlotOptions{})
+	if want := "keys recorded are: sleep, temperature"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("plot key=nappy gave error %v, want one saying %q", err, want)
+	}
+
+	// A key that is recorded, just not in the window, shouldn't be reported as missing.
+	opts := PlotOptions{Selection: Selection{From: "2024-02-01"}}
+	_, err = Plot(context.Background(), db, "key=temperature", opts)
+	if want := "window (1 recorded in all)"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("plot key=temperature with -from %s gave error %v, want one saying %q", opts.From, err, want)
+	}
+}
@@ -0,0 +1,55 @@
+package glow
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progress reports how far through a long-running task we are.
+// On a terminal it redraws a single status line as it goes;
+// otherwise it logs a line every so often.
+type progress struct {
+	what        string
+	done, total int
+
+	tty  bool
+	last time.Time // when progress was last shown
+}
+
+const (
+	progressRedraw = 100 * time.Millisecond // between status line redraws on a terminal
+	progressLog    = 5 * time.Second        // between log lines otherwise
+)
+
+func newProgress(what string, total int) *progress {
+	return &progress{
+		what:  what,
+		total: total,
+		tty:   term.IsTerminal(int(os.Stderr.Fd())),
+		last:  time.Now(),
+	}
+}
+
+// inc records that one more item is done.
+func (p *progress) inc() {
+	p.done++
+	now := time.Now()
+	if p.tty && now.Sub(p.last) >= progressRedraw {
+		fmt.Fprintf(os.Stderr, "\r%s: %d/%d (%d%%)", p.what, p.done, p.total, 100*p.done/p.total)
+		p.last = now
+	} else if !p.tty && now.Sub(p.last) >= progressLog {
+		log.Printf("%s: %d/%d (%d%%)", p.what, p.done, p.total, 100*p.done/p.total)
+		p.last = now
+	}
+}
+
+// finish clears any status line, so normal logging can continue.
+func (p *progress) finish() {
+	if p.tty && p.done > 0 {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+}
@@ -0,0 +1,146 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+)
+
+// Sleep regressions are found with a deliberately simple heuristic.
+// Daily total sleep is averaged over each week of life, which smooths out
+// single bad nights, and a week is flagged if its average is more than
+// regressionDrop below the average of the regressionBaselineWeeks weeks
+// before it. Flagged weeks are left out of later baselines, so a long
+// regression is still compared with the sleep before it started.
+// Consecutive flagged weeks are reported as one regression.
+const (
+	regressionDrop          = 0.15 // fraction below the baseline
+	regressionBaselineWeeks = 4
+	regressionMinBaseline   = 2 // weeks needed before there is a baseline
+	regressionMinDays       = 4 // days with sleep a week needs to count at all
+)
+
+// regressionsResult is the output of Regressions.
+type regressionsResult struct {
+	Regressions []regression `json:"regressions"`
+}
+
+// regression is a run of consecutive weeks of life with sleep well below the baseline.
+type regression struct {
+	FromWeek      int     `json:"from_week"`
+	ToWeek        int     `json:"to_week"`        // inclusive
+	From          string  `json:"from"`           // YYYY-MM-DD
+	To            string  `json:"to"`             // YYYY-MM-DD, inclusive
+	SleepHours    float64 `json:"sleep_hours"`    // average daily sleep during the regression
+	BaselineHours float64 `json:"baseline_hours"` // average daily sleep in the weeks before
+}
+
+// drop is the fraction by which sleep fell below the baseline.
+func (r regression) drop() float64 { return 1 - r.SleepHours/r.BaselineHours }
+
+// findRegressions finds sleep regressions in the hours slept each day,
+// keyed by days since birth, as described above.
+// Only the weeks fields and hours are set.
+func findRegressions(daily map[int]float64) []regression {
+	type weekSum struct {
+		hours float64
+		days  int
+	}
+	sums := make(map[int]*weekSum)
+	for day, h := range daily {
+		if day < 0 {
+			continue
+		}
+		ws := sums[day/7]
+		if ws == nil {
+			ws = new(weekSum)
+			sums[day/7] = ws
+		}
+		ws.hours += h
+		ws.days++
+	}
+	var weeks []int
+	for w, ws := range sums {
+		if ws.days >= regressionMinDays {
+			weeks = append(weeks, w)
+		}
+	}
+	sort.Ints(weeks)
+
+	var regs []regression
+	var baseline []float64 // weekly averages of unflagged weeks, most recent last
+	var flaggedWeeks int   // in the last of regs
+	for _, w := range weeks {
+		avg := sums[w].hours / float64(sums[w].days)
+		if len(baseline) < regressionMinBaseline {
+			baseline = append(baseline, avg)
+			continue
+		}
+		recent := baseline
+		if len(recent) > regressionBaselineWeeks {
+			recent = recent[len(recent)-regressionBaselineWeeks:]
+		}
+		var base float64
+		for _, b := range recent {
+			base += b
+		}
+		base /= float64(len(recent))
+		if avg >= base*(1-regressionDrop) {
+			baseline = append(baseline, avg)
+			continue
+		}
+		if n := len(regs); n > 0 && regs[n-1].ToWeek == w-1 {
+			r := &regs[n-1]
+			r.SleepHours = (r.SleepHours*float64(flaggedWeeks) + avg) / float64(flaggedWeeks+1)
+			r.ToWeek = w
+			flaggedWeeks++
+			continue
+		}
+		regs = append(regs, regression{FromWeek: w, ToWeek: w, SleepHours: avg, BaselineHours: base})
+		flaggedWeeks = 1
+	}
+	return regs
+}
+
+// Regressions reports likely sleep regressions for the baby selected by opts.
+func Regressions(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for finding sleep regressions", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	daily, err := loadDailySleep(ctx, db, opts.Selection, info)
+	if err != nil {
+		return err
+	}
+	res := regressionsResult{Regressions: []regression{}} // so JSON says [] rather than null
+	for _, r := range findRegressions(daily) {
+		r.From = info.birthday.AddDate(0, 0, 7*r.FromWeek).Format("2006-01-02")
+		r.To = info.birthday.AddDate(0, 0, 7*r.ToWeek+6).Format("2006-01-02")
+		res.Regressions = append(res.Regressions, r)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, res)
+	}
+	how := fmt.Sprintf("weekly average daily sleep more than %.0f%% below the previous %d weeks", 100*regressionDrop, regressionBaselineWeeks)
+	if len(res.Regressions) == 0 {
+		fmt.Fprintf(w, "No sleep regressions found for %s %s (%s).\n", info.firstName, info.lastName, how)
+		return nil
+	}
+	fmt.Fprintf(w, "Possible sleep regressions for %s %s (%s):\n", info.firstName, info.lastName, how)
+	for _, r := range res.Regressions {
+		weeks := fmt.Sprintf("week %d", r.FromWeek)
+		if r.ToWeek != r.FromWeek {
+			weeks = fmt.Sprintf("weeks %d-%d", r.FromWeek, r.ToWeek)
+		}
+		fmt.Fprintf(w, "\t%s (%s to %s): %.1fh a day, down %.0f%% from %.1fh\n",
+			weeks, r.From, r.To, r.SleepHours, 100*r.drop(), r.BaselineHours)
+	}
+	return nil
+}
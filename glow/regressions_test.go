@@ -0,0 +1,31 @@
+package glow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindRegressions(t *testing.T) {
+	// Weekly sleep levels, in hours a day.
+	levels := []float64{16, 15, 15, 15, 12, 12.5, 15, 15, 14.5, 14}
+	daily := make(map[int]float64)
+	for w, h := range levels {
+		for d := 0; d < 7; d++ {
+			daily[7*w+d] = h
+		}
+	}
+	daily[7*9+6] = 8         // one terrible night isn't enough on its own
+	daily[7*len(levels)] = 5 // a week with a single day doesn't count
+	got := findRegressions(daily)
+	want := []regression{
+		// Baseline is the average of weeks 0-3; week 5 is compared with it too.
+		{FromWeek: 4, ToWeek: 5, SleepHours: 12.25, BaselineHours: 15.25},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findRegressions = %+v, want %+v", got, want)
+	}
+
+	if got := findRegressions(map[int]float64{0: 10, 1: 10}); len(got) != 0 {
+		t.Errorf("findRegressions with too little data = %+v, want none", got)
+	}
+}
@@ -0,0 +1,169 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReportOptions controls a report. The CLI sets them from flags (see reportOptionsFromFlags).
+type ReportOptions struct {
+	Format string       // the format of the report; "pdf", the default, is the only one
+	Stats  QueryOptions // which baby and events to report on, and how to compute the stats
+	Plot   PlotOptions  // how to draw the plots; its Selection is replaced by that of Stats
+}
+
+// Report renders a PDF of the stats and plots for the baby selected by opts.Stats,
+// within its -from/-to window, as of now. Plots of things with no data are left out.
+func Report(ctx context.Context, db *sql.DB, now time.Time, opts ReportOptions) ([]byte, error) {
+	if opts.Format != "" && opts.Format != "pdf" {
+		return nil, fmt.Errorf("unsupported -format %q for report; want \"pdf\"", opts.Format)
+	}
+	sel := opts.Stats.Selection
+	info, err := loadBaby(ctx, db, sel)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Selected %s %s (born %s) for the report", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	// The stats are typeset as they'd be printed.
+	stats := opts.Stats
+	stats.JSON = false
+
+	highlight, err := reportHighlight(ctx, db, sel, info, now)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := newPDFDoc()
+	name := info.firstName + " " + info.lastName
+	for i, s := range []struct{ typ, title string }{
+		{"sleep", "Sleep"},
+		{"feed", "Feeds"},
+		{"tummy", "Tummy time"},
+		{"growth", "Growth"},
+		{"growth-velocity", "Growth velocity"},
+	} {
+		var buf bytes.Buffer
+		if err := Stats(ctx, db, s.typ, &buf, stats); err != nil {
+			return nil, fmt.Errorf("computing %s stats: %w", s.typ, err)
+		}
+		text := buf.String()
+		if i == 0 && highlight != "" {
+			text = "Highlight: " + highlight + "\n\n" + text
+		}
+		doc.addTextPages(s.title+" for "+name, text)
+	}
+
+	// Most plots fail if there's nothing to plot, so check first.
+	sleeps, err := loadSegments(ctx, db, sel, info.babyID, "sleep")
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := loadFeeds(ctx, db, sel, info.babyID)
+	if err != nil {
+		return nil, err
+	}
+	growth, err := babyGrowth(ctx, db, sel, info, stats.GrowthTolerance)
+	if err != nil {
+		return nil, err
+	}
+	var breastFeeds, haveBMI bool
+	for _, f := range feeds {
+		if f.typ == FeedBreast {
+			breastFeeds = true // the feed plot only shows these
+		}
+	}
+	for _, gr := range growth {
+		if _, ok := gr.bmi(); ok {
+			haveBMI = true
+		}
+	}
+	type reportPlot struct{ typ, title string }
+	var plots []reportPlot
+	for _, p := range []struct {
+		reportPlot
+		ok bool
+	}{
+		{reportPlot{"sleep", "Sleep"}, len(sleeps) > 0},
+		{reportPlot{"daily-sleep", "Daily sleep"}, len(sleeps) > 0},
+		{reportPlot{"feed", "Feeds"}, breastFeeds},
+		{reportPlot{"feed-tod", "Feeds by time of day"}, len(feeds) > 0},
+		{reportPlot{"bmi", "BMI"}, haveBMI},
+	} {
+		if p.ok {
+			plots = append(plots, p.reportPlot)
+		}
+	}
+	// The plots are independent, so render them in parallel, then add them in order.
+	plotOpts := opts.Plot
+	plotOpts.Selection = sel
+	plotOpts.Baby = strconv.FormatInt(info.babyID, 10)
+	pngs := make([][]byte, len(plots))
+	err = RenderEach(ctx, len(plots), func(ctx context.Context, i int) error {
+		png, err := Plot(ctx, db, plots[i].typ, plotOpts)
+		if err != nil {
+			return fmt.Errorf("plotting %s: %w", plots[i].typ, err)
+		}
+		pngs[i] = png
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range plots {
+		if err := doc.addImagePage(p.title, pngs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return doc.bytes(), nil
+}
+
+// reportHighlight picks one line to highlight at the top of the report.
+// It is the newest insight from Glow made within sel's -from/-to window, up to now,
+// for the baby or its account as a whole, or failing that, the longest sleep
+// starting in the week that ends at the earlier of now and the end of the window.
+// It returns "" if there is neither.
+func reportHighlight(ctx context.Context, db *sql.DB, sel Selection, info babyInfo, now time.Time) (string, error) {
+	from, to, err := sel.timeWindow()
+	if err != nil {
+		return "", err
+	}
+	if to > now.Unix() {
+		to = now.Unix()
+	}
+	var title string
+	err = db.QueryRowContext(ctx, `
+		SELECT Title FROM Insights
+		WHERE (BabyID = ? OR (BabyID IS NULL AND Account = (SELECT Account FROM Babies WHERE BabyID = ?)))
+			AND CreateTimestamp BETWEEN ? AND ? AND Title != ""
+		ORDER BY CreateTimestamp DESC, ID DESC LIMIT 1`, info.babyID, info.babyID, from, to).Scan(&title)
+	if err == nil {
+		return title, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("loading insights: %w", err)
+	}
+
+	sleeps, err := loadSegments(ctx, db, sel, info.babyID, "sleep")
+	if err != nil {
+		return "", err
+	}
+	weekStart := time.Unix(to, 0).AddDate(0, 0, -7).Unix()
+	var longest int64
+	for _, seg := range sleeps {
+		if seg[0] >= weekStart && seg[0] <= to && seg[1]-seg[0] > longest {
+			longest = seg[1] - seg[0]
+		}
+	}
+	if longest == 0 {
+		return "", nil
+	}
+	d := (time.Duration(longest) * time.Second).Round(time.Minute)
+	return "Longest sleep this week: " + strings.TrimSuffix(d.String(), "0s"), nil
+}
@@ -0,0 +1,168 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestReport checks a report against testdata/report.pdf.
+// Run with -update to rewrite it after an intended change to the report.
+func TestReport(t *testing.T) {
+	useTestFont(t)
+	defer func(loc *time.Location) { plotLocation = loc }(plotLocation)
+	plotLocation = time.FixedZone("AEST", 10*60*60)
+	now := time.Date(2024, time.January, 3, 12, 0, 0, 0, plotLocation)
+
+	db := newTestDB(t)
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, plotLocation).Unix()
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key, ValFloat) VALUES
+			(1, %[1]d + 3600, %[1]d + 4*3600, "sleep", NULL),
+			(1, %[1]d + 9*3600, NULL, "weight", 3.5),
+			(1, %[1]d + 9*3600, NULL, "height", 50);
+		INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML) VALUES
+			(1, %[1]d + 5*3600, 2, "", 0, 0, 90);`, day))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	opts := ReportOptions{Format: "pdf"}
+	pdf, err := Report(context.Background(), db, now, opts)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	again, err := Report(context.Background(), db, now, opts)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if !bytes.Equal(pdf, again) {
+		t.Errorf("report isn't deterministic")
+	}
+
+	golden := filepath.Join("testdata", "report.pdf")
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, pdf, 0644); err != nil {
+			t.Fatalf("Writing golden file: %v", err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Reading golden file: %v", err)
+	}
+	if !bytes.Equal(pdf, want) {
+		i := 0
+		for i < len(pdf) && i < len(want) && pdf[i] == want[i] {
+			i++
+		}
+		t.Errorf("report differs from %s from byte %d of %d (want %d bytes); if that's intended, rerun with -update", golden, i, len(pdf), len(want))
+	}
+
+	// Five stats pages, and all the plots but the polar feed one, which only shows breast feeds.
+	if m := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(pdf); m == nil || string(m[1]) != "9" {
+		t.Errorf("report page count is %q, want 9", m)
+	}
+	// Every object must be where the cross-reference table says.
+	i := bytes.LastIndex(pdf, []byte("startxref\n"))
+	xref, err := strconv.Atoi(string(bytes.Fields(pdf[i+len("startxref\n"):])[0]))
+	if err != nil || !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref doesn't point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatalf("xref table is empty")
+	}
+	for n, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", n+1); !bytes.HasPrefix(pdf[off:], []byte(want)) {
+			t.Errorf("xref entry for object %d points at %q", n+1, pdf[off:off+10])
+		}
+	}
+
+	opts.Format = "csv"
+	if _, err := Report(context.Background(), db, now, opts); err == nil {
+		t.Errorf("report with -format %s succeeded, want error", opts.Format)
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	if got, want := pdfString(`a (b) \ 37.5ºC ☃`), `a \(b\) \\ 37.5\272C ?`; got != want {
+		t.Errorf("pdfString = %q, want %q", got, want)
+	}
+	if got, want := expandTabs("ab\tc\t\td"), "ab      c               d"; got != want {
+		t.Errorf("expandTabs = %q, want %q", got, want)
+	}
+}
+
+func TestReportHighlight(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	var sel Selection
+	info, err := loadBaby(ctx, db, sel)
+	if err != nil {
+		t.Fatalf("loadBaby: %v", err)
+	}
+	now := time.Date(2024, time.January, 15, 12, 0, 0, 0, time.Local)
+	check := func(want string) {
+		t.Helper()
+		got, err := reportHighlight(ctx, db, sel, info, now)
+		if err != nil {
+			t.Fatalf("reportHighlight: %v", err)
+		}
+		if got != want {
+			t.Errorf("reportHighlight = %q, want %q", got, want)
+		}
+	}
+	check("")
+
+	// Without insights, the longest sleep in the week up to now is used.
+	day := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.Local).Unix()
+	_, err = db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+			(1, %[1]d, %[1]d + 8*3600, "sleep"),
+			(1, %[1]d + 10*86400, %[1]d + 10*86400 + 6*3600 + 12*60, "sleep"),
+			(1, %[1]d + 12*86400, %[1]d + 12*86400 + 2*3600, "sleep");`, day))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	check("Longest sleep this week: 6h12m")
+
+	// Or the week up to -to, if that is earlier.
+	sel.To = "2024-01-08"
+	check("Longest sleep this week: 8h0m")
+	sel.To = ""
+
+	// A week with no sleep has no highlight, rather than the last sleep before it.
+	now = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local)
+	check("")
+	now = time.Date(2024, time.January, 15, 12, 0, 0, 0, time.Local)
+
+	// The newest insight within the window wins, if it is for the baby or its account.
+	if _, err := db.Exec(`INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (2, "Bob", "Test", "2024-01-01")`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	syncWith := func(account string, insights ...Insight) {
+		t.Helper()
+		var resp PullResponse
+		resp.Data.Insights = &insights
+		if err := syncInsights(ctx, db, account, resp); err != nil {
+			t.Fatalf("syncInsights: %v", err)
+		}
+	}
+	syncWith("",
+		Insight{ID: 1, BabyID: 1, Title: "Old news", CreateTime: day},
+		Insight{ID: 2, Title: "Sleeping well", CreateTime: day + 86400},
+		Insight{ID: 3, BabyID: 2, Title: "Another baby", CreateTime: day + 2*86400},
+		Insight{ID: 5, BabyID: 1, Title: "Not yet", CreateTime: day + 30*86400})
+	syncWith("other", Insight{ID: 4, Title: "Another account", CreateTime: day + 3*86400})
+	check("Sleeping well")
+
+	sel.From = "2024-01-05"
+	check("Longest sleep this week: 6h12m")
+}
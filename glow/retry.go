@@ -0,0 +1,153 @@
+package glow
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	maxAttempts   = 4                // total tries for an API request
+	maxRetryAfter = 10 * time.Minute // longest Retry-After we'll wait for
+)
+
+// retryBase is the delay before the first retry; it doubles each time.
+// Tests may override it.
+var retryBase = time.Second
+
+// The HTTP clients for API requests are made on first use,
+// one per proxy, and then shared, so that their connections are reused.
+var (
+	apiClientsMu sync.Mutex
+	apiClients   = make(map[string]*http.Client) // keyed by proxy
+)
+
+// apiClient returns the HTTP client for API requests that go through proxy (see newAPIClient).
+// It is safe to call concurrently.
+func apiClient(proxy string) (*http.Client, error) {
+	apiClientsMu.Lock()
+	defer apiClientsMu.Unlock()
+	if c, ok := apiClients[proxy]; ok {
+		return c, nil
+	}
+	c, err := newAPIClient(proxy)
+	if err != nil {
+		return nil, err
+	}
+	apiClients[proxy] = c
+	return c, nil
+}
+
+// newAPIClient returns an HTTP client that goes through proxy if that is set,
+// or else, like http.DefaultTransport, through that given by $HTTPS_PROXY
+// or $HTTP_PROXY (unless $NO_PROXY excludes the host), if any.
+func newAPIClient(proxy string) (*http.Client, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return nil, fmt.Errorf("bad -proxy %q; want a URL like http://proxy:3128 or socks5://localhost:1080", proxy)
+		}
+		if pw, ok := u.User.Password(); ok {
+			addSecret(pw)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	return &http.Client{Transport: t}, nil
+}
+
+// doWithRetry sends req through proxy, retrying with exponential backoff on network errors
+// and on responses that suggest trying again later. If the server says how long
+// to wait with a Retry-After header, that is honoured instead.
+// The request must have a GetBody, as those from http.NewRequest with a bytes.Reader do.
+//
+// Once out of attempts, it returns the last response or error.
+func doWithRetry(ctx context.Context, proxy string, req *http.Request) (*http.Response, error) {
+	client, err := apiClient(proxy)
+	if err != nil {
+		return nil, err
+	}
+	delay := retryBase
+	for attempt := 1; ; attempt++ {
+		r := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("internal error: rewinding request body: %w", err)
+			}
+			r.Body = body
+		}
+		resp, err := client.Do(r)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		if attempt == maxAttempts || (err == nil && !retryable(resp.StatusCode)) {
+			return resp, err
+		}
+
+		wait := delay
+		delay *= 2
+		what := fmt.Sprint(err)
+		if err == nil {
+			what = fmt.Sprintf("status %q", resp.Status)
+			if ra, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if ra > maxRetryAfter {
+					// Give up now rather than hanging; the caller reports the status.
+					log.Printf("Server asked us to wait %v before retrying; not waiting that long", ra)
+					return resp, nil
+				}
+				wait = ra
+			}
+			// Drain the body so the connection can be reused.
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+		log.Printf("HTTP request to %s failed (%s); retrying in %v (attempt %d of %d)", req.URL.Path, what, wait, attempt+1, maxAttempts)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// retryable reports whether a response with the given status code is worth retrying.
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header value,
+// which is either a number of seconds or an HTTP date.
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
@@ -0,0 +1,148 @@
+package glow
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"Fri, 01 Mar 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Fri, 01 Mar 2024 11:00:00 GMT", 0, true}, // already passed
+	}
+	for _, test := range tests {
+		got, ok := retryAfter(test.in, now)
+		if got != test.want || ok != test.ok {
+			t.Errorf("retryAfter(%q) = %v, %t; want %v, %t", test.in, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestDoWithRetry(t *testing.T) {
+	defer func(d time.Duration) { retryBase = d }(retryBase)
+	retryBase = time.Millisecond
+
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch len(bodies) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "oops", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("POST", srv.URL, bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doWithRetry(context.Background(), "", req)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("final status = %q, want 200 OK", resp.Status)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("server got %d requests, want 3", len(bodies))
+	}
+	for i, b := range bodies {
+		if b != "hello" {
+			t.Errorf("request %d had body %q, want %q", i+1, b, "hello")
+		}
+	}
+}
+
+func TestDoWithRetryGivesUp(t *testing.T) {
+	defer func(d time.Duration) { retryBase = d }(retryBase)
+	retryBase = time.Millisecond
+
+	n := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		http.Error(w, "nope", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest("POST", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doWithRetry(context.Background(), "", req)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || n != maxAttempts {
+		t.Errorf("got status %q after %d requests, want 502 after %d", resp.Status, n, maxAttempts)
+	}
+
+	// A context cancelled while waiting should stop it promptly.
+	retryBase = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := doWithRetry(ctx, "", req); err != context.DeadlineExceeded {
+		t.Errorf("doWithRetry with expiring context returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestDoWithRetryProxy(t *testing.T) {
+	var got string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxied request has the full URL, not just the path.
+		got = r.URL.String()
+		w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	req, err := http.NewRequest("POST", "http://glow.invalid/api/v2/pull", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := doWithRetry(context.Background(), proxy.URL, req)
+	if err != nil {
+		t.Fatalf("doWithRetry via proxy: %v", err)
+	}
+	resp.Body.Close()
+	if want := "http://glow.invalid/api/v2/pull"; got != want {
+		t.Errorf("proxy got request for %q, want %q", got, want)
+	}
+
+	// The client is reused rather than made for each request, but only for the same proxy.
+	c1, _ := apiClient(proxy.URL)
+	c2, _ := apiClient(proxy.URL)
+	if c1 != c2 {
+		t.Errorf("apiClient returned a new client each time")
+	}
+	if c3, _ := apiClient(""); c3 == c1 {
+		t.Errorf("apiClient returned the same client without a proxy")
+	}
+
+	for _, bad := range []string{"proxy:3128", "ftp://proxy", "http://"} {
+		if _, err := newAPIClient(bad); err == nil {
+			t.Errorf("newAPIClient(%q) succeeded, want error", bad)
+		}
+	}
+}
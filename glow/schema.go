@@ -0,0 +1,90 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUninitialised is returned by Schema for a DB with no tables.
+var ErrUninitialised = errors.New("DB isn't initialised")
+
+// schemaResult is the output of Schema.
+type schemaResult struct {
+	Version    int               `json:"version"`
+	Supported  int               `json:"supported_version"` // the latest this glowbaby knows
+	Migrations []migrationStatus `json:"migrations"`
+	Statements []string          `json:"statements"` // CREATE statements, in the order they were made
+}
+
+type migrationStatus struct {
+	Version int    `json:"version"` // the schema version it upgrades to
+	Applied bool   `json:"applied"`
+	Summary string `json:"summary"` // its first line of SQL
+}
+
+// Schema prints the DB's schema version, which migrations it has had,
+// and the statements that create its tables and indexes, for bug reports.
+// It doesn't change the DB, so it is run before any migrations.
+// It fails, after printing, if the DB is from a newer glowbaby.
+func Schema(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	res := schemaResult{Supported: len(migrations), Migrations: []migrationStatus{}, Statements: []string{}}
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&res.Version); err != nil {
+		return fmt.Errorf("checking DB schema version: %w", err)
+	}
+	for i, m := range migrations {
+		summary := strings.TrimSpace(m)
+		if j := strings.Index(summary, "\n"); j >= 0 {
+			summary = summary[:j]
+		}
+		res.Migrations = append(res.Migrations, migrationStatus{Version: i + 1, Applied: i < res.Version, Summary: summary})
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE "sqlite_%"
+		ORDER BY rowid`)
+	if err != nil {
+		return fmt.Errorf("loading DB schema: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return fmt.Errorf("scanning DB schema: %w", err)
+		}
+		res.Statements = append(res.Statements, stmt)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading DB schema: %w", err)
+	}
+	if len(res.Statements) == 0 {
+		return ErrUninitialised
+	}
+
+	if opts.JSON {
+		if err := writeJSON(w, res); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(w, "Schema version %d (this glowbaby supports up to %d)\n", res.Version, res.Supported)
+		fmt.Fprintln(w, "Migrations (version, status, first line):")
+		for _, m := range res.Migrations {
+			status := "pending"
+			if m.Applied {
+				status = "applied"
+			}
+			fmt.Fprintf(w, "\t%d\t%s\t%s\n", m.Version, status, m.Summary)
+		}
+		fmt.Fprintln(w, "Schema:")
+		for _, stmt := range res.Statements {
+			fmt.Fprintf(w, "%s;\n", stmt)
+		}
+	}
+	if res.Version > res.Supported {
+		return fmt.Errorf("DB schema version %d is newer than this glowbaby supports (%d); upgrade glowbaby", res.Version, res.Supported)
+	}
+	return nil
+}
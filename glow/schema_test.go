@@ -0,0 +1,56 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	db := newTestDB(t)
+	n := len(migrations)
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, n-1)); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := Schema(context.Background(), db, &buf, QueryOptions{}); err != nil {
+		t.Fatalf("schema: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		fmt.Sprintf("Schema version %d (this glowbaby supports up to %d)\n", n-1, n),
+		"\t1\tapplied\tCREATE TABLE Insights (\n",
+		fmt.Sprintf("\t%d\tpending\t", n),
+		"CREATE TABLE Auth (",
+		"CREATE INDEX ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("schema output doesn't contain %q:\n%s", want, out)
+		}
+	}
+
+	// A DB from a newer glowbaby is still printed, but is an error.
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, n+1)); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := Schema(context.Background(), db, &buf, QueryOptions{}); err == nil {
+		t.Errorf("schema of a DB from the future succeeded, want error")
+	}
+	if !strings.Contains(buf.String(), "CREATE TABLE Auth (") {
+		t.Errorf("schema of a DB from the future didn't print it:\n%s", buf.String())
+	}
+
+	empty, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "empty.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	if err := Schema(context.Background(), empty, &buf, QueryOptions{}); !errors.Is(err, ErrUninitialised) {
+		t.Errorf("schema of an uninitialised DB returned %v, want %v", err, ErrUninitialised)
+	}
+}
@@ -0,0 +1,908 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// writeJSON writes a command's result to w as indented JSON.
+// Commands that support -json each define a result struct for it,
+// whose struct tags document the schema; the top level is always an object.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// QueryOptions controls stats, and the other commands that print what is in the DB,
+// such as gaps and status. The CLI sets them from flags (see queryOptionsFromFlags).
+// Zero values mean the same as the flags' defaults, except for GrowthTolerance.
+type QueryOptions struct {
+	Selection // which baby and events to cover; commands covering every baby only use its Account
+
+	JSON            bool   // write JSON (see writeJSON) rather than text
+	By              string // for stats, break results down by calendar "day" or by "week" of life
+	Night           string // for sleep stats, the window of the day whose sleep is night sleep, as HH:MM-HH:MM
+	GrowthTolerance int    // for growth stats, pair weight and height readings at most this many days apart
+}
+
+// withDefaults returns opts with its zero values replaced by the flags' defaults.
+func (opts QueryOptions) withDefaults() QueryOptions {
+	if opts.By == "" {
+		opts.By = "day"
+	}
+	if opts.Night == "" {
+		opts.Night = "19:00-07:00"
+	}
+	return opts
+}
+
+// StatsTypes are the types of stats that Stats computes.
+var StatsTypes = []string{"feed", "sleep", "tummy", "medicine", "pump", "growth", "growth-velocity"}
+
+// Stats writes the stats of the given type (one of StatsTypes) to w.
+func Stats(ctx context.Context, db *sql.DB, typ string, w io.Writer, opts QueryOptions) error {
+	opts = opts.withDefaults()
+	switch typ {
+	default:
+		return fmt.Errorf("unknown stats type %q", typ)
+	case "feed":
+		return statsFeed(ctx, db, w, opts)
+	case "tummy":
+		return statsTummy(ctx, db, w, opts)
+	case "medicine":
+		return statsMedicine(ctx, db, w, opts)
+	case "sleep":
+		return statsSleep(ctx, db, w, opts)
+	case "pump":
+		return statsPump(ctx, db, w, opts)
+	case "growth":
+		return statsGrowth(ctx, db, w, opts)
+	case "growth-velocity":
+		return statsGrowthVelocity(ctx, db, w, opts)
+	}
+}
+
+// parseBy parses by, as set by the -by flag, reporting whether stats should be
+// broken down by week of life rather than by day.
+func parseBy(by string) (weekly bool, err error) {
+	switch by {
+	case "day":
+		return false, nil
+	case "week":
+		return true, nil
+	}
+	return false, fmt.Errorf("bad -by %q; want \"day\" or \"week\"", by)
+}
+
+// weekOfLife returns the week of life that t falls in, where week 0 is the
+// seven days from the birthday, and the date that week starts.
+// Times before the birthday are in negative weeks.
+func weekOfLife(birthday, t time.Time) (week int, start time.Time) {
+	week = ageWeeks(birthday, t)
+	return week, birthday.AddDate(0, 0, 7*week)
+}
+
+// statsBucket returns the date (YYYY-MM-DD) of the day t falls in (see dayOf),
+// or with weekly set, the date starting that day's week of life and that week's number.
+func (ds ClockTime) statsBucket(birthday, t time.Time, weekly bool) (date string, week *int) {
+	day, _ := ds.dayOf(t)
+	if !weekly {
+		return day.Format("2006-01-02"), nil
+	}
+	w, start := weekOfLife(birthday, day)
+	return start.Format("2006-01-02"), &w
+}
+
+// feedStats summarises a baby's feeds.
+type feedStats struct {
+	Feeds  int            `json:"feeds"`
+	ByType map[string]int `json:"by_type"` // feed count by FeedType
+
+	// Breast balance, over breast feeds only.
+	LeftSeconds  int64    `json:"left_seconds"`
+	RightSeconds int64    `json:"right_seconds"`
+	LeftShare    float64  `json:"left_share"`       // fraction of breast time on the left
+	Ratio        *float64 `json:"left_right_ratio"` // left time over right time; nil if no right time
+	LeftFeeds    int      `json:"left_feeds"`
+	RightFeeds   int      `json:"right_feeds"`
+	BothFeeds    int      `json:"both_feeds"`
+	Preference   string   `json:"preference,omitempty"` // "left" or "right", if strong
+}
+
+// A breast is considered preferred if it gets more than this share of breast time.
+const strongPreference = 0.6
+
+func statsFeed(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for feed stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return err
+	}
+
+	var st feedStats
+	st.Feeds = len(feeds)
+	st.ByType = make(map[string]int)
+	for _, f := range feeds {
+		st.ByType[f.typ.String()]++
+		if f.typ != FeedBreast {
+			continue
+		}
+		st.LeftSeconds += f.left
+		st.RightSeconds += f.right
+
+		// Trust the recorded side if there is one,
+		// otherwise work it out from which sides have any time.
+		side := f.breastUsed
+		if side == "" {
+			switch {
+			case f.left > 0 && f.right > 0:
+				side = "B"
+			case f.left > 0:
+				side = "L"
+			case f.right > 0:
+				side = "R"
+			}
+		}
+		switch side {
+		case "L":
+			st.LeftFeeds++
+		case "R":
+			st.RightFeeds++
+		case "B":
+			st.BothFeeds++
+		}
+	}
+	if total := st.LeftSeconds + st.RightSeconds; total > 0 {
+		st.LeftShare = float64(st.LeftSeconds) / float64(total)
+		if st.RightSeconds > 0 {
+			ratio := float64(st.LeftSeconds) / float64(st.RightSeconds)
+			st.Ratio = &ratio
+		}
+		switch {
+		case st.LeftShare > strongPreference:
+			st.Preference = "left"
+		case 1-st.LeftShare > strongPreference:
+			st.Preference = "right"
+		}
+	}
+
+	if opts.JSON {
+		return writeJSON(w, st)
+	}
+	fmt.Fprintf(w, "Feeds for %s %s: %d\n", info.firstName, info.lastName, st.Feeds)
+	var types []string
+	for _, ft := range []FeedType{FeedBreast, FeedBottle, FeedSolids, FeedUnknown} {
+		if n := st.ByType[ft.String()]; n > 0 {
+			types = append(types, fmt.Sprintf("%d %s", n, ft))
+		}
+	}
+	if len(types) > 0 {
+		fmt.Fprintf(w, "Feed types: %s\n", strings.Join(types, ", "))
+	}
+	left, right := time.Duration(st.LeftSeconds)*time.Second, time.Duration(st.RightSeconds)*time.Second
+	ratio := "n/a"
+	if st.Ratio != nil {
+		ratio = fmt.Sprintf("%.2f", *st.Ratio)
+	}
+	fmt.Fprintf(w, "Breast time: %v left, %v right (%.0f%% left, L:R ratio %s)\n", left, right, 100*st.LeftShare, ratio)
+	fmt.Fprintf(w, "Sides used: %d left, %d right, %d both\n", st.LeftFeeds, st.RightFeeds, st.BothFeeds)
+	if st.Preference != "" {
+		fmt.Fprintf(w, "Strong preference for the %s breast.\n", st.Preference)
+	}
+	return nil
+}
+
+// tummyStats summarises a baby's tummy time.
+type tummyStats struct {
+	Sessions       int        `json:"sessions"`
+	TotalSeconds   int64      `json:"total_seconds"`
+	AverageSeconds float64    `json:"average_session_seconds"`
+	Days           []tummyDay `json:"days"`
+}
+
+// tummyDay is the tummy time on one day, or with -by week, in one week of life.
+type tummyDay struct {
+	Date     string `json:"date"`           // YYYY-MM-DD; the week's first day with -by week
+	Week     *int   `json:"week,omitempty"` // week of life, with -by week
+	Days     int    `json:"days,omitempty"` // days in the week with any sessions, with -by week
+	Seconds  int64  `json:"seconds"`
+	Sessions int    `json:"sessions"`
+
+	lastDate string // YYYY-MM-DD of the last session added
+}
+
+func statsTummy(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for tummy time stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	weekly, err := parseBy(opts.By)
+	if err != nil {
+		return err
+	}
+
+	segs, err := loadSegments(ctx, db, opts.Selection, info.babyID, "tummy")
+	if err != nil {
+		return err
+	}
+
+	// Attribute each session to the day (or week) it starts on.
+	// Segments are in chronological order, so days are too.
+	var st tummyStats
+	st.Days = []tummyDay{} // so JSON says [] rather than null
+	activeDays := 0
+	for _, seg := range segs {
+		t := time.Unix(seg[0], 0).In(plotLocation)
+		date, week := opts.DayStart.statsBucket(info.birthday, t, weekly)
+		if n := len(st.Days); n == 0 || st.Days[n-1].Date != date {
+			st.Days = append(st.Days, tummyDay{Date: date, Week: week})
+		}
+		day := &st.Days[len(st.Days)-1]
+		if d := t.Format("2006-01-02"); d != day.lastDate {
+			day.lastDate = d
+			activeDays++
+			if weekly {
+				day.Days++
+			}
+		}
+		day.Seconds += seg[1] - seg[0]
+		day.Sessions++
+		st.Sessions++
+		st.TotalSeconds += seg[1] - seg[0]
+	}
+	if st.Sessions > 0 {
+		st.AverageSeconds = float64(st.TotalSeconds) / float64(st.Sessions)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, st)
+	}
+	if st.Sessions == 0 {
+		fmt.Fprintf(w, "No tummy time recorded for %s %s.\n", info.firstName, info.lastName)
+		return nil
+	}
+	secs := func(s float64) time.Duration { return (time.Duration(s) * time.Second).Round(time.Second) }
+	fmt.Fprintf(w, "Tummy time for %s %s: %d sessions, %v in total\n", info.firstName, info.lastName, st.Sessions, secs(float64(st.TotalSeconds)))
+	fmt.Fprintf(w, "Average session: %v\n", secs(st.AverageSeconds))
+	fmt.Fprintf(w, "Average per day (on days with any): %v\n", secs(float64(st.TotalSeconds)/float64(activeDays)))
+	if weekly {
+		fmt.Fprintln(w, "Per week of life (week, starting, average per day with any, sessions per day):")
+		for _, wk := range st.Days {
+			days := float64(wk.Days)
+			fmt.Fprintf(w, "\t%d\t%s\t%v\t%.1f\n", *wk.Week, wk.Date, secs(float64(wk.Seconds)/days), float64(wk.Sessions)/days)
+		}
+		return nil
+	}
+	fmt.Fprintln(w, "Per day (date, total, sessions):")
+	for _, day := range st.Days {
+		fmt.Fprintf(w, "\t%s\t%v\t%d\n", day.Date, secs(float64(day.Seconds)), day.Sessions)
+	}
+	return nil
+}
+
+// medicineStats lists a baby's medicine doses.
+type medicineStats struct {
+	Doses []doseRecord `json:"doses"`
+}
+
+// doseRecord is a medicine dose, as reported by stats.
+type doseRecord struct {
+	Time        time.Time `json:"time"`
+	Description string    `json:"description"`
+}
+
+func statsMedicine(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for medicine stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	doses, err := loadDoses(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return err
+	}
+
+	if opts.JSON {
+		st := medicineStats{Doses: []doseRecord{}} // so JSON says [] rather than null
+		for _, d := range doses {
+			st.Doses = append(st.Doses, doseRecord{time.Unix(d.time, 0).In(plotLocation), d.desc})
+		}
+		return writeJSON(w, st)
+	}
+	if len(doses) == 0 {
+		fmt.Fprintf(w, "No medicine recorded for %s %s.\n", info.firstName, info.lastName)
+		return nil
+	}
+	fmt.Fprintf(w, "Medicine for %s %s: %d doses\n", info.firstName, info.lastName, len(doses))
+	for i, d := range doses {
+		line := fmt.Sprintf("\t%s\t%s", time.Unix(d.time, 0).In(plotLocation).Format("2006-01-02 15:04"), d.desc)
+		if i > 0 {
+			since := time.Duration(d.time-doses[i-1].time) * time.Second
+			line += fmt.Sprintf("\t(%v after previous)", since)
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// pumpDay summarises a day's pumping sessions, or with -by week, a week of life's.
+type pumpDay struct {
+	Date     string  `json:"date,omitempty"` // YYYY-MM-DD; empty for the overall total; the week's first day with -by week
+	Week     *int    `json:"week,omitempty"` // week of life, with -by week
+	Days     int     `json:"days,omitempty"` // days in the week with any sessions, with -by week
+	Sessions int     `json:"sessions"`
+	LeftML   float64 `json:"left_ml"`
+	RightML  float64 `json:"right_ml"`
+	Seconds  int64   `json:"seconds"`
+
+	lastDate string // YYYY-MM-DD of the last session added
+}
+
+func (pd *pumpDay) add(f feed) {
+	pd.Sessions++
+	pd.LeftML += f.pumpLeftML
+	pd.RightML += f.pumpRightML
+	pd.Seconds += f.left + f.right
+}
+
+func statsPump(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for pump stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+	weekly, err := parseBy(opts.By)
+	if err != nil {
+		return err
+	}
+
+	pumps, err := loadPumps(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return err
+	}
+	var st struct {
+		Total pumpDay   `json:"total"`
+		Days  []pumpDay `json:"days"`
+	}
+	st.Days = []pumpDay{} // so JSON says [] rather than null
+	for _, p := range pumps {
+		t := time.Unix(p.start, 0).In(plotLocation)
+		date, week := opts.DayStart.statsBucket(info.birthday, t, weekly)
+		if n := len(st.Days); n == 0 || st.Days[n-1].Date != date {
+			st.Days = append(st.Days, pumpDay{Date: date, Week: week})
+		}
+		day := &st.Days[len(st.Days)-1]
+		if d := t.Format("2006-01-02"); weekly && d != day.lastDate {
+			day.lastDate = d
+			day.Days++
+		}
+		day.add(p)
+		st.Total.add(p)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, st)
+	}
+	if len(pumps) == 0 {
+		fmt.Fprintf(w, "No pumping sessions recorded for %s %s.\n", info.firstName, info.lastName)
+		return nil
+	}
+	t := st.Total
+	fmt.Fprintf(w, "Pumping for %s %s: %d sessions, %.0f ml (%.0f ml left, %.0f ml right) in %v\n",
+		info.firstName, info.lastName, t.Sessions, t.LeftML+t.RightML, t.LeftML, t.RightML, time.Duration(t.Seconds)*time.Second)
+	if weekly {
+		fmt.Fprintln(w, "Per week of life (week, starting, then per day with any: sessions, total ml, left ml, right ml):")
+		for _, wk := range st.Days {
+			days := float64(wk.Days)
+			fmt.Fprintf(w, "\t%d\t%s\t%.1f\t%.0f\t%.0f\t%.0f\n", *wk.Week, wk.Date, float64(wk.Sessions)/days,
+				(wk.LeftML+wk.RightML)/days, wk.LeftML/days, wk.RightML/days)
+		}
+		return nil
+	}
+	fmt.Fprintln(w, "Per day (date, sessions, total ml, left ml, right ml):")
+	for _, d := range st.Days {
+		fmt.Fprintf(w, "\t%s\t%d\t%.0f\t%.0f\t%.0f\n", d.Date, d.Sessions, d.LeftML+d.RightML, d.LeftML, d.RightML)
+	}
+	return nil
+}
+
+// wakeWindow is the time awake between two consecutive sleeps.
+type wakeWindow struct {
+	start int64 // unix epoch, when the baby woke
+	dur   time.Duration
+}
+
+// wakeWindows returns the gaps between consecutive sleep segments,
+// which must be in chronological order. Only gaps that start and end
+// on the same day (see dayOf) are included, since overnight gaps usually
+// mean sleep wasn't tracked rather than the baby being awake.
+func (ds ClockTime) wakeWindows(segs [][2]int64) []wakeWindow {
+	var wws []wakeWindow
+	for i := 1; i < len(segs); i++ {
+		woke, slept := segs[i-1][1], segs[i][0]
+		if slept <= woke {
+			continue // overlapping segments
+		}
+		d1, _ := ds.dayOf(time.Unix(woke, 0).In(plotLocation))
+		d2, _ := ds.dayOf(time.Unix(slept, 0).In(plotLocation))
+		if !d1.Equal(d2) {
+			continue
+		}
+		wws = append(wws, wakeWindow{woke, time.Duration(slept-woke) * time.Second})
+	}
+	return wws
+}
+
+// sleepStats summarises a baby's sleep.
+type sleepStats struct {
+	Night       sleepTotal `json:"night"`
+	Day         sleepTotal `json:"day"`
+	WakeWindows wakeStats  `json:"wake_windows"`
+
+	// Efficiency is the fraction of the nights' spans spent asleep (see nightStats).
+	Efficiency float64      `json:"efficiency"`
+	Nights     []nightStats `json:"nights"`
+}
+
+// nightStats summarises one night's sleep.
+//
+// Glow doesn't record when a baby was put down, only when they slept,
+// so the time in bed is approximated by the span from falling asleep in the first
+// of the night's sleeps to waking from the last. Any time spent settling before
+// the first sleep is missed, so this overstates efficiency; what it does measure is
+// how broken up the night was.
+type nightStats struct {
+	Date          string  `json:"date"` // YYYY-MM-DD of the evening the night starts
+	Wakeups       int     `json:"wakeups"`
+	AsleepSeconds int64   `json:"asleep_seconds"`
+	SpanSeconds   int64   `json:"span_seconds"`
+	Efficiency    float64 `json:"efficiency"` // asleep / span
+}
+
+// nightEfficiency groups the night sleeps among segs (those mostly within the night window,
+// as for sleepStats.Night) into nights, in order, and summarises each.
+// segs must be in chronological order.
+func nightEfficiency(segs [][2]int64, nightStart, nightEnd int) []nightStats {
+	nights := []nightStats{} // so JSON says [] rather than null
+	var last int64           // end of the latest sleep in the last night
+	for _, seg := range segs {
+		start, end := time.Unix(seg[0], 0).In(plotLocation), time.Unix(seg[1], 0).In(plotLocation)
+		if night, day := splitNight(start, end, nightStart, nightEnd); night <= day {
+			continue
+		}
+		// Sleeps up to the end of the night window belong to the night of the evening before.
+		date := start.Add(-time.Duration(nightEnd) * time.Minute).Format("2006-01-02")
+		if len(nights) == 0 || nights[len(nights)-1].Date != date {
+			nights = append(nights, nightStats{Date: date})
+			last = seg[0]
+		} else {
+			nights[len(nights)-1].Wakeups++
+		}
+		ns := &nights[len(nights)-1]
+		ns.AsleepSeconds += seg[1] - seg[0]
+		if seg[1] > last {
+			ns.SpanSeconds += seg[1] - last
+			last = seg[1]
+		}
+		if ns.SpanSeconds > 0 {
+			ns.Efficiency = float64(ns.AsleepSeconds) / float64(ns.SpanSeconds)
+		}
+	}
+	return nights
+}
+
+// sleepTotal is the sleep in one part of the day.
+// A sleep is counted where most of it falls, but its time is split exactly.
+type sleepTotal struct {
+	Count   int   `json:"count"`
+	Seconds int64 `json:"seconds"`
+}
+
+// parseNightWindow parses night, as set by the -night flag, returning the start and end
+// of the night as minutes since midnight.
+func parseNightWindow(night string) (start, end int, err error) {
+	parts := strings.Split(night, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("bad -night window %q; want HH:MM-HH:MM", night)
+	}
+	var mins [2]int
+	for i, p := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(p))
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad -night window %q: %w", night, err)
+		}
+		mins[i] = t.Hour()*60 + t.Minute()
+	}
+	if mins[0] == mins[1] {
+		return 0, 0, fmt.Errorf("bad -night window %q; it is empty", night)
+	}
+	return mins[0], mins[1], nil
+}
+
+// splitNight splits the time range [start, end) into the parts during the night,
+// which runs from nightStart until nightEnd (in minutes since midnight, possibly
+// wrapping past midnight), and during the day.
+func splitNight(start, end time.Time, nightStart, nightEnd int) (night, day time.Duration) {
+	isNight := func(t time.Time) bool {
+		m := t.Hour()*60 + t.Minute()
+		if nightStart < nightEnd {
+			return nightStart <= m && m < nightEnd
+		}
+		return m >= nightStart || m < nightEnd
+	}
+	for start.Before(end) {
+		// Find the next boundary, which is today or tomorrow.
+		y, mo, d := start.Date()
+		next := end
+		for _, dd := range []int{0, 1} {
+			for _, b := range []int{nightStart, nightEnd} {
+				t := time.Date(y, mo, d+dd, b/60, b%60, 0, 0, start.Location())
+				if t.After(start) && t.Before(next) {
+					next = t
+				}
+			}
+		}
+		if isNight(start) {
+			night += next.Sub(start)
+		} else {
+			day += next.Sub(start)
+		}
+		start = next
+	}
+	return night, day
+}
+
+// wakeStats summarises some wake windows.
+type wakeStats struct {
+	Count          int         `json:"count"`
+	AverageSeconds int64       `json:"average_seconds"`
+	MinSeconds     int64       `json:"min_seconds"`
+	MaxSeconds     int64       `json:"max_seconds"`
+	Days           []wakeStats `json:"days,omitempty"`
+	Date           string      `json:"date,omitempty"` // YYYY-MM-DD, for a single day; the week's first day with -by week
+	Week           *int        `json:"week,omitempty"` // week of life, with -by week
+
+	totalSeconds int64
+}
+
+func (ws *wakeStats) add(d time.Duration) {
+	secs := int64(d / time.Second)
+	if ws.Count == 0 || secs < ws.MinSeconds {
+		ws.MinSeconds = secs
+	}
+	if secs > ws.MaxSeconds {
+		ws.MaxSeconds = secs
+	}
+	ws.Count++
+	ws.totalSeconds += secs
+	ws.AverageSeconds = ws.totalSeconds / int64(ws.Count)
+}
+
+func statsSleep(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	// TODO: Handle multiple babies.
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	log.Printf("Selected %s %s (born %s) for sleep stats", info.firstName, info.lastName, info.birthday.Format("2006-01-02"))
+
+	segs, err := loadSegments(ctx, db, opts.Selection, info.babyID, "sleep")
+	if err != nil {
+		return err
+	}
+
+	nightStart, nightEnd, err := parseNightWindow(opts.Night)
+	if err != nil {
+		return err
+	}
+	weekly, err := parseBy(opts.By)
+	if err != nil {
+		return err
+	}
+
+	var st sleepStats
+	for _, seg := range segs {
+		start, end := time.Unix(seg[0], 0).In(plotLocation), time.Unix(seg[1], 0).In(plotLocation)
+		night, day := splitNight(start, end, nightStart, nightEnd)
+		st.Night.Seconds += int64(night / time.Second)
+		st.Day.Seconds += int64(day / time.Second)
+		if night > day {
+			st.Night.Count++
+		} else {
+			st.Day.Count++
+		}
+	}
+	st.Nights = nightEfficiency(segs, nightStart, nightEnd)
+	var asleep, span int64
+	for _, ns := range st.Nights {
+		asleep += ns.AsleepSeconds
+		span += ns.SpanSeconds
+	}
+	if span > 0 {
+		st.Efficiency = float64(asleep) / float64(span)
+	}
+	for _, ww := range opts.DayStart.wakeWindows(segs) {
+		st.WakeWindows.add(ww.dur)
+		date, week := opts.DayStart.statsBucket(info.birthday, time.Unix(ww.start, 0).In(plotLocation), weekly)
+		days := st.WakeWindows.Days
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			st.WakeWindows.Days = append(days, wakeStats{Date: date, Week: week})
+		}
+		st.WakeWindows.Days[len(st.WakeWindows.Days)-1].add(ww.dur)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, st)
+	}
+	fmt.Fprintf(w, "Sleep for %s %s: %d sleeps\n", info.firstName, info.lastName, len(segs))
+	secs := func(s int64) time.Duration { return time.Duration(s) * time.Second }
+	fmt.Fprintf(w, "Night (%s): %v in %d sleeps\n", opts.Night, secs(st.Night.Seconds), st.Night.Count)
+	fmt.Fprintf(w, "Day: %v in %d naps\n", secs(st.Day.Seconds), st.Day.Count)
+	if len(st.Nights) > 0 {
+		// Glow has no time put down, so this is only an approximation; see nightStats.
+		fmt.Fprintf(w, "Night sleep efficiency: %.1f%% of the time from first falling asleep to last waking\n", 100*st.Efficiency)
+		fmt.Fprintln(w, "Per night (evening, wakeups, asleep, span, efficiency):")
+		for _, ns := range st.Nights {
+			fmt.Fprintf(w, "\t%s\t%d\t%v\t%v\t%.1f%%\n", ns.Date, ns.Wakeups, secs(ns.AsleepSeconds), secs(ns.SpanSeconds), 100*ns.Efficiency)
+		}
+	}
+	ws := st.WakeWindows
+	if ws.Count == 0 {
+		fmt.Fprintln(w, "No wake windows (gaps between sleeps on the same day).")
+		return nil
+	}
+	fmt.Fprintf(w, "Wake windows: %d, average %v (min %v, max %v)\n", ws.Count, secs(ws.AverageSeconds), secs(ws.MinSeconds), secs(ws.MaxSeconds))
+	if weekly {
+		fmt.Fprintln(w, "Per week of life (week, starting, count, average, min, max):")
+		for _, d := range ws.Days {
+			fmt.Fprintf(w, "\t%d\t%s\t%d\t%v\t%v\t%v\n", *d.Week, d.Date, d.Count, secs(d.AverageSeconds), secs(d.MinSeconds), secs(d.MaxSeconds))
+		}
+		return nil
+	}
+	fmt.Fprintln(w, "Per day (date, count, average, min, max):")
+	for _, d := range ws.Days {
+		fmt.Fprintf(w, "\t%s\t%d\t%v\t%v\t%v\n", d.Date, d.Count, secs(d.AverageSeconds), secs(d.MinSeconds), secs(d.MaxSeconds))
+	}
+	return nil
+}
+
+// recentFeedIntervals is how many of the most recent gaps between feeds
+// NextFeed bases its prediction on.
+const recentFeedIntervals = 8
+
+// predictNextFeed estimates when the next feed is due, given feed start times
+// in chronological order. The model is deliberately simple: the last feed's start
+// plus the median of the most recent intervals between feed starts.
+// The median is used so that a single missed or extra feed doesn't skew it.
+// It reports false if there are fewer than two feeds.
+func predictNextFeed(starts []int64) (next int64, interval time.Duration, ok bool) {
+	if len(starts) < 2 {
+		return 0, 0, false
+	}
+	first := len(starts) - 1 - recentFeedIntervals
+	if first < 0 {
+		first = 0
+	}
+	var gaps []int64
+	for i := first + 1; i < len(starts); i++ {
+		gaps = append(gaps, starts[i]-starts[i-1])
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+	med := gaps[len(gaps)/2]
+	if len(gaps)%2 == 0 {
+		med = (gaps[len(gaps)/2-1] + med) / 2
+	}
+	return starts[len(starts)-1] + med, time.Duration(med) * time.Second, true
+}
+
+// nextFeedResult is the output of next-feed.
+type nextFeedResult struct {
+	LastFeed        time.Time `json:"last_feed"`
+	NextFeed        time.Time `json:"next_feed"`
+	IntervalSeconds int64     `json:"median_interval_seconds"`
+}
+
+// NextFeed prints when the selected baby's next feed is likely due.
+func NextFeed(ctx context.Context, db *sql.DB, w io.Writer, now time.Time, opts QueryOptions) error {
+	info, err := loadBaby(ctx, db, opts.Selection)
+	if err != nil {
+		return err
+	}
+	feeds, err := loadFeeds(ctx, db, opts.Selection, info.babyID)
+	if err != nil {
+		return err
+	}
+	starts := make([]int64, len(feeds))
+	for i, f := range feeds {
+		starts[i] = f.start
+	}
+	next, interval, ok := predictNextFeed(starts)
+	if !ok {
+		return fmt.Errorf("need at least two feeds recorded for %s %s to predict the next", info.firstName, info.lastName)
+	}
+
+	const layout = "Mon 2006-01-02 15:04"
+	last := time.Unix(starts[len(starts)-1], 0).In(plotLocation)
+	due := time.Unix(next, 0).In(plotLocation)
+	if opts.JSON {
+		return writeJSON(w, nextFeedResult{last, due, int64(interval / time.Second)})
+	}
+	fmt.Fprintf(w, "Last feed for %s %s: %s\n", info.firstName, info.lastName, last.Format(layout))
+	fmt.Fprintf(w, "Next feed due around %s (median of recent intervals is %v)\n", due.Format(layout), interval.Round(time.Minute))
+	if ago := now.Sub(due); ago > 24*time.Hour {
+		fmt.Fprintln(w, "That was over a day ago; is the data up to date? Try running sync.")
+	} else if ago > 0 {
+		fmt.Fprintf(w, "That was %v ago.\n", ago.Round(time.Minute))
+	}
+	return nil
+}
+
+// gapsResult is the output of Gaps.
+type gapsResult struct {
+	Babies []babyGaps `json:"babies"`
+}
+
+type babyGaps struct {
+	BabyID    int64    `json:"baby_id"`
+	Name      string   `json:"name"`
+	Days      int      `json:"days"`       // since birth, including today
+	EmptyDays []string `json:"empty_days"` // YYYY-MM-DD
+	Coverage  float64  `json:"coverage"`   // fraction of days with any events
+}
+
+// Gaps reports the days between each baby's birthday and now
+// that have no recorded sleep or feed events.
+// That usually means a day that wasn't logged, or an incomplete sync.
+func Gaps(ctx context.Context, db *sql.DB, w io.Writer, now time.Time, opts QueryOptions) error {
+	infos, err := loadBabies(ctx, db, opts.Account)
+	if err != nil {
+		return err
+	}
+	res := gapsResult{Babies: []babyGaps{}} // so JSON says [] rather than null
+	for _, info := range infos {
+		bg := babyGaps{
+			BabyID:    info.babyID,
+			Name:      info.firstName + " " + info.lastName,
+			EmptyDays: []string{},
+		}
+		if now.Before(info.birthday) {
+			// Entered before birth; there's no range to cover yet.
+			res.Babies = append(res.Babies, bg)
+			if !opts.JSON {
+				fmt.Fprintf(w, "%s: not born yet (0 days)\n", bg.Name)
+			}
+			continue
+		}
+		rows, err := db.QueryContext(ctx, `
+			SELECT StartTimestamp FROM BabyData WHERE BabyID = ? AND Key = "sleep"
+			UNION ALL
+			SELECT StartTimestamp FROM BabyFeedData WHERE BabyID = ?`, info.babyID, info.babyID)
+		if err != nil {
+			return fmt.Errorf("loading event times: %w", err)
+		}
+		seen := make(map[int]bool) // days since birth
+		for rows.Next() {
+			var ts int64
+			if err := rows.Scan(&ts); err != nil {
+				rows.Close()
+				return fmt.Errorf("scanning event times from DB: %w", err)
+			}
+			t := time.Unix(ts, 0).In(plotLocation)
+			if t.Before(opts.DayStart.dayStart(info.birthday)) || t.After(now) {
+				continue
+			}
+			seen[opts.DayStart.dayNumber(info.birthday, t)] = true
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("loading event times from DB: %w", err)
+		}
+
+		bg.Days = opts.DayStart.dayNumber(info.birthday, now) + 1
+		for d := 0; d < bg.Days; d++ {
+			if !seen[d] {
+				bg.EmptyDays = append(bg.EmptyDays, info.birthday.AddDate(0, 0, d).Format("2006-01-02"))
+			}
+		}
+		bg.Coverage = float64(bg.Days-len(bg.EmptyDays)) / float64(bg.Days)
+		res.Babies = append(res.Babies, bg)
+		if opts.JSON {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %d of %d days have no events (%.1f%% coverage)\n",
+			bg.Name, len(bg.EmptyDays), bg.Days, 100*bg.Coverage)
+		for _, date := range bg.EmptyDays {
+			fmt.Fprintf(w, "\t%s\n", date)
+		}
+	}
+	if opts.JSON {
+		return writeJSON(w, res)
+	}
+	return nil
+}
+
+// insightsResult is the output of Insights.
+type insightsResult struct {
+	Insights []insightRecord `json:"insights"`
+}
+
+type insightRecord struct {
+	Time  *time.Time `json:"time,omitempty"` // nil if unknown
+	Baby  string     `json:"baby,omitempty"` // first name
+	Title string     `json:"title"`
+	Body  string     `json:"body,omitempty"`
+}
+
+// Insights lists the insights stored by the last sync, newest first.
+// If opts.Account is set, only that account's insights are listed.
+func Insights(ctx context.Context, db *sql.DB, w io.Writer, opts QueryOptions) error {
+	cond, args := `1`, []interface{}(nil)
+	if opts.Account != "" {
+		cond, args = `Insights.Account = ?`, []interface{}{opts.Account}
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT CreateTimestamp, Title, Body, FirstName FROM Insights
+		LEFT JOIN Babies USING (BabyID)
+		WHERE `+cond+`
+		ORDER BY CreateTimestamp DESC`, args...)
+	if err != nil {
+		return fmt.Errorf("loading insights: %w", err)
+	}
+	defer rows.Close()
+	res := insightsResult{Insights: []insightRecord{}} // so JSON says [] rather than null
+	for rows.Next() {
+		var ts sql.NullInt64
+		var title, body, name sql.NullString
+		if err := rows.Scan(&ts, &title, &body, &name); err != nil {
+			return fmt.Errorf("scanning insights from DB: %w", err)
+		}
+		rec := insightRecord{Baby: name.String, Title: title.String, Body: body.String}
+		if ts.Valid && ts.Int64 > 0 {
+			t := time.Unix(ts.Int64, 0).In(plotLocation)
+			rec.Time = &t
+		}
+		res.Insights = append(res.Insights, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("loading insights from DB: %w", err)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, res)
+	}
+	for _, rec := range res.Insights {
+		when := "unknown date"
+		if rec.Time != nil {
+			when = rec.Time.Format("2006-01-02 15:04")
+		}
+		if rec.Baby != "" {
+			when += " (" + rec.Baby + ")"
+		}
+		fmt.Fprintf(w, "%s: %s\n", when, rec.Title)
+		if rec.Body != "" {
+			fmt.Fprintf(w, "\t%s\n", rec.Body)
+		}
+	}
+	if len(res.Insights) == 0 {
+		fmt.Fprintln(w, "No insights; try running sync.")
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package glow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPredictNextFeed(t *testing.T) {
+	const h = 3600
+	tests := []struct {
+		desc     string
+		starts   []int64
+		next     int64
+		interval time.Duration
+		ok       bool
+	}{
+		{"no feeds", nil, 0, 0, false},
+		{"one feed", []int64{0}, 0, 0, false},
+		{"two feeds", []int64{0, 3 * h}, 6 * h, 3 * time.Hour, true},
+		{"even count takes the middle pair", []int64{0, 2 * h, 5 * h}, 5*h + 5*h/2, 150 * time.Minute, true},
+		{"outlier ignored", []int64{0, 3 * h, 6 * h, 15 * h, 18 * h}, 21 * h, 3 * time.Hour, true},
+		{
+			"only recent intervals",
+			// Ten 1h intervals, then eight 4h ones.
+			[]int64{0, 1 * h, 2 * h, 3 * h, 4 * h, 5 * h, 6 * h, 7 * h, 8 * h, 9 * h, 10 * h,
+				14 * h, 18 * h, 22 * h, 26 * h, 30 * h, 34 * h, 38 * h, 42 * h},
+			46 * h, 4 * time.Hour, true,
+		},
+	}
+	for _, test := range tests {
+		next, interval, ok := predictNextFeed(test.starts)
+		if next != test.next || interval != test.interval || ok != test.ok {
+			t.Errorf("%s: predictNextFeed = %d, %v, %t; want %d, %v, %t",
+				test.desc, next, interval, ok, test.next, test.interval, test.ok)
+		}
+	}
+}
+
+func TestWakeWindows(t *testing.T) {
+	defer func(loc *time.Location) { plotLocation = loc }(plotLocation)
+	plotLocation = time.FixedZone("AEST", 10*60*60)
+	at := func(day, hour, min int) int64 {
+		return time.Date(2024, time.March, day, hour, min, 0, 0, plotLocation).Unix()
+	}
+	segs := [][2]int64{
+		{at(1, 1, 0), at(1, 6, 0)},   // night
+		{at(1, 8, 0), at(1, 9, 30)},  // 2h awake first
+		{at(1, 9, 15), at(1, 10, 0)}, // overlaps; no window
+		{at(1, 12, 0), at(1, 13, 0)}, // 2h awake
+		{at(1, 20, 0), at(2, 5, 0)},  // 7h awake; overnight sleep
+		{at(2, 6, 30), at(2, 7, 0)},  // 1.5h awake
+		{at(3, 1, 0), at(3, 2, 0)},   // gap spans midnight; no window
+	}
+	want := []wakeWindow{
+		{at(1, 6, 0), 2 * time.Hour},
+		{at(1, 10, 0), 2 * time.Hour},
+		{at(1, 13, 0), 7 * time.Hour},
+		{at(2, 5, 0), 90 * time.Minute},
+	}
+	got := ClockTime(0).wakeWindows(segs)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wakeWindows = %v, want %v", got, want)
+	}
+}
+
+func TestSplitNight(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skipf("no timezone data: %v", err)
+	}
+	at := func(mon time.Month, day, hour, min int) time.Time {
+		return time.Date(2024, mon, day, hour, min, 0, 0, loc)
+	}
+	const seven, nineteen = 7 * 60, 19 * 60
+	tests := []struct {
+		desc       string
+		start, end time.Time
+		ns, ne     int
+		night, day time.Duration
+	}{
+		{"nap", at(time.March, 1, 13, 0), at(time.March, 1, 14, 30), nineteen, seven, 0, 90 * time.Minute},
+		{"night", at(time.March, 1, 20, 0), at(time.March, 2, 6, 0), nineteen, seven, 10 * time.Hour, 0},
+		{"evening nap into night", at(time.March, 1, 18, 30), at(time.March, 1, 19, 15), nineteen, seven, 15 * time.Minute, 30 * time.Minute},
+		{"sleep in", at(time.March, 2, 5, 0), at(time.March, 2, 8, 0), nineteen, seven, 2 * time.Hour, time.Hour},
+		{"all day and night", at(time.March, 1, 7, 0), at(time.March, 2, 7, 0), nineteen, seven, 12 * time.Hour, 12 * time.Hour},
+		{"night not wrapping midnight", at(time.March, 1, 23, 0), at(time.March, 2, 7, 0), 0, 6 * 60, 6 * time.Hour, 2 * time.Hour},
+		{"DST end makes a longer night", at(time.April, 6, 19, 0), at(time.April, 7, 7, 0), nineteen, seven, 13 * time.Hour, 0},
+	}
+	for _, test := range tests {
+		night, day := splitNight(test.start, test.end, test.ns, test.ne)
+		if night != test.night || day != test.day {
+			t.Errorf("%s: splitNight = %v night, %v day; want %v, %v", test.desc, night, day, test.night, test.day)
+		}
+	}
+}
+
+func TestNightEfficiency(t *testing.T) {
+	at := func(day, hour, min int) int64 {
+		return time.Date(2024, time.January, day, hour, min, 0, 0, time.Local).Unix()
+	}
+	segs := [][2]int64{
+		{at(1, 19, 30), at(1, 23, 0)},
+		{at(2, 0, 0), at(2, 3, 0)},
+		{at(2, 3, 30), at(2, 6, 30)},
+		{at(2, 13, 0), at(2, 14, 0)}, // a nap
+		{at(2, 20, 0), at(3, 6, 0)},
+	}
+	got := nightEfficiency(segs, 19*60, 7*60)
+	want := []nightStats{
+		{Date: "2024-01-01", Wakeups: 2, AsleepSeconds: 9.5 * 3600, SpanSeconds: 11 * 3600, Efficiency: 9.5 / 11},
+		{Date: "2024-01-02", Wakeups: 0, AsleepSeconds: 10 * 3600, SpanSeconds: 10 * 3600, Efficiency: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nightEfficiency =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseNightWindow(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		ok         bool
+	}{
+		{"19:00-07:00", 19 * 60, 7 * 60, true},
+		{"20:30 - 06:15", 20*60 + 30, 6*60 + 15, true},
+		{"00:00-06:00", 0, 6 * 60, true},
+		{"7-8", 0, 0, false},
+		{"19:00", 0, 0, false},
+		{"19:00-19:00", 0, 0, false},
+	}
+	for _, test := range tests {
+		start, end, err := parseNightWindow(test.in)
+		if ok := err == nil; ok != test.ok || start != test.start || end != test.end {
+			t.Errorf("parseNightWindow with -night %q = %d, %d, %v; want %d, %d, ok=%t", test.in, start, end, err, test.start, test.end, test.ok)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		INSERT INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key) VALUES (1, 1, 1704100000, 1704103600, "sleep");
+		INSERT INTO BabyFeedData(ID, BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight) VALUES
+			(1, 1, 1704090000, 1, "L", 600, 300),
+			(2, 1, 1704100000, 1, "R", 300, 600);
+		INSERT INTO Insights(ID, BabyID, Title) VALUES (1, 1, "Hello");`)
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	ctx := context.Background()
+	opts := QueryOptions{JSON: true}
+	cmds := map[string]func(*strings.Builder) error{
+		"gaps":        func(w *strings.Builder) error { return Gaps(ctx, db, w, time.Now(), opts) },
+		"insights":    func(w *strings.Builder) error { return Insights(ctx, db, w, opts) },
+		"next-feed":   func(w *strings.Builder) error { return NextFeed(ctx, db, w, time.Now(), opts) },
+		"regressions": func(w *strings.Builder) error { return Regressions(ctx, db, w, opts) },
+		"sync-log":    func(w *strings.Builder) error { return SyncLog(ctx, db, w, opts) },
+		"schema":      func(w *strings.Builder) error { return Schema(ctx, db, w, opts) },
+	}
+	for _, typ := range StatsTypes {
+		typ := typ
+		cmds["stats "+typ] = func(w *strings.Builder) error { return Stats(ctx, db, typ, w, opts) }
+	}
+	for name, cmd := range cmds {
+		var buf strings.Builder
+		if err := cmd(&buf); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		// Every command's JSON should be a single object.
+		var v map[string]interface{}
+		if err := json.Unmarshal([]byte(buf.String()), &v); err != nil {
+			t.Errorf("%s output isn't a JSON object: %v\n%s", name, err, buf.String())
+		}
+	}
+}
+
+func TestGapsAsOf(t *testing.T) {
+	db := newTestDB(t)
+	at := func(day, hour int) int64 {
+		return time.Date(2024, time.January, day, hour, 0, 0, 0, time.Local).Unix()
+	}
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES (1, %d, %d, "sleep");
+		INSERT INTO BabyFeedData(BabyID, StartTimestamp, FeedType, BreastUsed) VALUES
+			(1, %d, 2, ""),
+			(1, %d, 2, "");`, at(1, 10), at(1, 11), at(3, 10), at(6, 10)))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	// As of midday on the 4th, the feed on the 6th hasn't happened yet.
+	var buf strings.Builder
+	if err := Gaps(context.Background(), db, &buf, time.Date(2024, time.January, 4, 12, 0, 0, 0, time.Local), QueryOptions{}); err != nil {
+		t.Fatalf("gaps: %v", err)
+	}
+	want := "Ada Test: 2 of 4 days have no events (50.0% coverage)\n\t2024-01-02\n\t2024-01-04\n"
+	if got := buf.String(); got != want {
+		t.Errorf("gaps wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWeekOfLife(t *testing.T) {
+	birthday := time.Date(2024, time.January, 3, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		t     time.Time
+		week  int
+		start string
+	}{
+		{time.Date(2024, time.January, 3, 8, 0, 0, 0, time.Local), 0, "2024-01-03"},
+		{time.Date(2024, time.January, 9, 23, 59, 0, 0, time.Local), 0, "2024-01-03"},
+		{time.Date(2024, time.January, 10, 0, 0, 0, 0, time.Local), 1, "2024-01-10"},
+		{time.Date(2024, time.April, 30, 12, 0, 0, 0, time.Local), 16, "2024-04-24"},
+		{time.Date(2024, time.January, 2, 12, 0, 0, 0, time.Local), -1, "2023-12-27"},
+		{time.Date(2023, time.December, 27, 12, 0, 0, 0, time.Local), -1, "2023-12-27"},
+	}
+	for _, test := range tests {
+		week, start := weekOfLife(birthday, test.t)
+		if week != test.week || start.Format("2006-01-02") != test.start {
+			t.Errorf("weekOfLife(%v) = %d, %s; want %d, %s", test.t, week, start.Format("2006-01-02"), test.week, test.start)
+		}
+	}
+}
+
+func TestStatsTummyByWeek(t *testing.T) {
+	defer func(loc *time.Location) { plotLocation = loc }(plotLocation)
+	plotLocation = time.FixedZone("AEST", 10*60*60)
+	opts := QueryOptions{By: "week"}
+
+	db := newTestDB(t)
+	// The test baby was born on 2024-01-01, a Monday.
+	at := func(day, hour int) int64 {
+		return time.Date(2024, time.January, day, hour, 0, 0, 0, plotLocation).Unix()
+	}
+	_, err := db.Exec(fmt.Sprintf(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key) VALUES
+			(1, %d, %d + 600, "tummy"),
+			(1, %d, %d + 300, "tummy"),
+			(1, %d, %d + 300, "tummy"),
+			(1, %d, %d + 1200, "tummy");`,
+		at(2, 9), at(2, 9), at(2, 15), at(2, 15), at(5, 9), at(5, 9), at(9, 9), at(9, 9)))
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	var buf strings.Builder
+	if err := statsTummy(context.Background(), db, &buf, opts); err != nil {
+		t.Fatalf("statsTummy: %v", err)
+	}
+	for _, want := range []string{
+		"Average per day (on days with any): 13m20s\n",
+		"\t0\t2024-01-01\t10m0s\t1.5\n", // 20 minutes in 3 sessions over 2 days
+		"\t1\t2024-01-08\t20m0s\t1.0\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("weekly tummy stats don't contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	opts.By = "month"
+	if err := statsTummy(context.Background(), db, &buf, opts); err == nil {
+		t.Errorf("statsTummy with -by %s succeeded, want error", opts.By)
+	}
+}
@@ -0,0 +1,81 @@
+package glow
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"time"
+)
+
+// statusResult is the output of Status.
+type statusResult struct {
+	Babies []babyStatus `json:"babies"`
+}
+
+type babyStatus struct {
+	BabyID        int64      `json:"baby_id"`
+	Name          string     `json:"name"`
+	SleepingSince *time.Time `json:"sleeping_since,omitempty"` // nil unless asleep
+	StaleSleeps   int        `json:"stale_sleeps,omitempty"`   // older sleeps with no end
+}
+
+// Status reports whether each baby selected by opts.Account is asleep, as of the last sync:
+// that is, whether their latest sleep has no end time yet.
+// Older sleeps with no end were probably never stopped in the app,
+// so they are just counted.
+func Status(ctx context.Context, db *sql.DB, w io.Writer, now time.Time, opts QueryOptions) error {
+	infos, err := loadBabies(ctx, db, opts.Account)
+	if err != nil {
+		return err
+	}
+	res := statusResult{Babies: []babyStatus{}} // so JSON says [] rather than null
+	for _, info := range infos {
+		bs := babyStatus{BabyID: info.babyID, Name: info.firstName + " " + info.lastName}
+		var open int
+		err := db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM BabyData
+			WHERE BabyID = ? AND Key = "sleep" AND EndTimestamp IS NULL`, info.babyID).Scan(&open)
+		if err != nil {
+			return fmt.Errorf("counting open sleeps: %w", err)
+		}
+		var start int64
+		var ended bool
+		err = db.QueryRowContext(ctx, `
+			SELECT StartTimestamp, EndTimestamp IS NOT NULL FROM BabyData
+			WHERE BabyID = ? AND Key = "sleep"
+			ORDER BY StartTimestamp DESC LIMIT 1`, info.babyID).Scan(&start, &ended)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("loading latest sleep: %w", err)
+		}
+		bs.StaleSleeps = open
+		if err == nil && !ended {
+			t := time.Unix(start, 0).In(plotLocation)
+			bs.SleepingSince = &t
+			bs.StaleSleeps--
+		}
+		res.Babies = append(res.Babies, bs)
+	}
+
+	if opts.JSON {
+		return writeJSON(w, res)
+	}
+	for _, bs := range res.Babies {
+		state := "awake"
+		if t := bs.SleepingSince; t != nil {
+			layout := "15:04"
+			if dayDiff(*t, now) != 0 {
+				layout = "2006-01-02 15:04"
+			}
+			state = "currently sleeping since " + t.Format(layout)
+		}
+		fmt.Fprintf(w, "%s: %s\n", bs.Name, state)
+		if bs.StaleSleeps > 0 {
+			fmt.Fprintf(w, "\t%s never ended; check for sleeps left running in the app\n", plural(bs.StaleSleeps, "older sleep"))
+		}
+	}
+	if len(res.Babies) == 0 {
+		fmt.Fprintln(w, "No babies; log in and sync first.")
+	}
+	return nil
+}
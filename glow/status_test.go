@@ -0,0 +1,40 @@
+package glow
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := db.Exec(`INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (2, "Bob", "Test", "2024-01-01")`); err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+	// Ada is asleep, with an older sleep left running; Bob's last sleep ended.
+	_, err := db.Exec(`
+		INSERT INTO BabyData(BabyID, StartTimestamp, EndTimestamp, Key, ValStr) VALUES
+			(1, 1704100000, NULL, "sleep", ""),
+			(1, 1704200000, 1704203600, "sleep", ""),
+			(1, 1704300000, NULL, "sleep", ""),
+			(1, 1704400000, NULL, "medicine", "Paracetamol"),
+			(2, 1704100000, NULL, "sleep", ""),
+			(2, 1704200000, 1704203600, "sleep", "")`)
+	if err != nil {
+		t.Fatalf("Populating DB: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := Status(context.Background(), db, &buf, time.Now(), QueryOptions{}); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	since := time.Unix(1704300000, 0).Format("2006-01-02 15:04")
+	want := "Ada Test: currently sleeping since " + since + "\n" +
+		"\t1 older sleep never ended; check for sleeps left running in the app\n" +
+		"Bob Test: awake\n" +
+		"\t1 older sleep never ended; check for sleeps left running in the app\n"
+	if got := buf.String(); got != want {
+		t.Errorf("status wrote\n%s\nwant\n%s", got, want)
+	}
+}
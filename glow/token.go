@@ -0,0 +1,129 @@
+package glow
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// With -encrypt-token, the auth token is stored encrypted with AES-GCM,
+// under a key derived from a passphrase with PBKDF2-HMAC-SHA256.
+// The stored form is encryptedTokenPrefix followed by the base64 of
+// the salt, nonce and ciphertext. Tokens without the prefix are plaintext,
+// so DBs from before this, or without the flag, keep working.
+
+const (
+	encryptedTokenPrefix = "enc:v1:"
+	tokenKDFIterations   = 600000
+	tokenSaltSize        = 16
+)
+
+// passphraseEnv is the environment variable that may hold the token passphrase.
+const passphraseEnv = "GLOWBABY_PASSPHRASE"
+
+// tokenPassphrase returns the passphrase for encrypting the auth token,
+// from the environment or else by prompting for it.
+func tokenPassphrase() (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		addSecret(p)
+		return p, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("the auth token is encrypted; set %s to its passphrase", passphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, "Auth token passphrase: ")
+	p, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr) // the user's newline wasn't echoed
+	if err != nil {
+		return "", fmt.Errorf("reading passphrase: %w", err)
+	}
+	if len(p) == 0 {
+		return "", errors.New("empty passphrase")
+	}
+	addSecret(string(p))
+	return string(p), nil
+}
+
+// encryptToken returns the stored form of token, encrypted with passphrase.
+func encryptToken(token, passphrase string) (string, error) {
+	buf := make([]byte, tokenSaltSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	gcm, err := tokenCipher(passphrase, buf)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
+	}
+	buf = append(buf, nonce...)
+	buf = gcm.Seal(buf, nonce, []byte(token), nil)
+	return encryptedTokenPrefix + base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// decryptToken reverses encryptToken.
+func decryptToken(stored, passphrase string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedTokenPrefix))
+	if err != nil || len(raw) < tokenSaltSize {
+		return "", errors.New("stored auth token is corrupt")
+	}
+	gcm, err := tokenCipher(passphrase, raw[:tokenSaltSize])
+	if err != nil {
+		return "", err
+	}
+	raw = raw[tokenSaltSize:]
+	if len(raw) < gcm.NonceSize() {
+		return "", errors.New("stored auth token is corrupt")
+	}
+	token, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("can't decrypt the auth token; is the passphrase right?")
+	}
+	return string(token), nil
+}
+
+func tokenCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2SHA256([]byte(passphrase), salt, tokenKDFIterations, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key of keyLen bytes from password and salt,
+// as in RFC 8018 section 5.2 with HMAC-SHA256 as the PRF.
+// (The standard library only gained this in Go 1.24.)
+func pbkdf2SHA256(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
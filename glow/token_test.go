@@ -0,0 +1,41 @@
+package glow
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iter, keyLen   int
+		want           string
+	}{
+		// From RFC 7914 section 11.
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, test := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(test.password), []byte(test.salt), test.iter, test.keyLen))
+		if got != test.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d, %d) = %s, want %s", test.password, test.salt, test.iter, test.keyLen, got, test.want)
+		}
+	}
+}
+
+func TestEncryptToken(t *testing.T) {
+	enc, err := encryptToken("tok", "right")
+	if err != nil {
+		t.Fatalf("encryptToken: %v", err)
+	}
+	if !strings.HasPrefix(enc, encryptedTokenPrefix) || strings.Contains(enc, "tok") {
+		t.Errorf("encryptToken = %q, want an opaque value starting with %q", enc, encryptedTokenPrefix)
+	}
+	if got, err := decryptToken(enc, "right"); err != nil || got != "tok" {
+		t.Errorf("decryptToken with the right passphrase = %q, %v; want %q", got, err, "tok")
+	}
+	if _, err := decryptToken(enc, "wrong"); err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("decryptToken with the wrong passphrase = %v, want an error about the passphrase", err)
+	}
+}
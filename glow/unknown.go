@@ -0,0 +1,164 @@
+package glow
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// knownPullKeys are keys of the pull response that are known but deliberately
+// not decoded (see the "Other keys" notes in api.go), by path as for unknownKey.
+// -report-unknown doesn't report them.
+var knownPullKeys = map[string]bool{
+	"rc":                           true,
+	"data.user":                    true,
+	"data.babies[].Baby":           true,
+	"data.babies[].BabyMilestone":  true,
+	"data.babies[].MilestonePhoto": true,
+	"data.babies[].Photo":          true,
+}
+
+// unknownKey is a key in a JSON response that decoding it ignores.
+type unknownKey struct {
+	path  string // e.g. "data.babies[].BabyData.update[].note"
+	shape string // of the first value seen, e.g. "string" or "object {a, b}"
+	count int    // times it was seen
+}
+
+// reportUnknown logs the keys of a raw pull response that PullResponse doesn't decode,
+// apart from those in knownPullKeys, to spot new data worth keeping.
+func reportUnknown(rawPullResp []byte) {
+	keys, err := unknownKeys(rawPullResp, reflect.TypeOf(PullResponse{}), knownPullKeys)
+	if err != nil {
+		log.Printf("Warning: checking pull response for unknown keys: %v", err)
+		return
+	}
+	if len(keys) == 0 {
+		log.Printf("Pull response has no unknown keys")
+		return
+	}
+	log.Printf("Pull response has %s that glowbaby doesn't decode:", plural(len(keys), "unknown key"))
+	for _, k := range keys {
+		log.Printf("  %s (%s): %s", k.path, plural(k.count, "time"), k.shape)
+	}
+}
+
+// unknownKeys returns the keys of the JSON data that decoding it into a value of type t
+// would ignore, apart from those whose paths are in known, sorted by path.
+// Paths join object keys with "." and mark arrays with "[]".
+func unknownKeys(data []byte, t reflect.Type, known map[string]bool) ([]unknownKey, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+	found := make(map[string]*unknownKey)
+	findUnknown(v, t, "", known, found)
+	var keys []unknownKey
+	for _, k := range found {
+		keys = append(keys, *k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].path < keys[j].path })
+	return keys, nil
+}
+
+func findUnknown(v interface{}, t reflect.Type, path string, known map[string]bool, found map[string]*unknownKey) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if t.Kind() == reflect.Map {
+			for _, elem := range v {
+				findUnknown(elem, t.Elem(), path+".*", known, found)
+			}
+			return
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		fields := jsonFields(t)
+		for key, elem := range v {
+			p := key
+			if path != "" {
+				p = path + "." + key
+			}
+			// Like encoding/json, match field names regardless of case.
+			if ft, ok := fields[strings.ToLower(key)]; ok {
+				findUnknown(elem, ft, p, known, found)
+				continue
+			}
+			if known[p] {
+				continue
+			}
+			k := found[p]
+			if k == nil {
+				k = &unknownKey{path: p, shape: jsonShape(elem)}
+				found[p] = k
+			}
+			k.count++
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for _, elem := range v {
+			findUnknown(elem, t.Elem(), path+"[]", known, found)
+		}
+	}
+}
+
+// jsonFields returns the types of the fields of struct type t
+// that encoding/json decodes, keyed by lower-cased JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f.Type
+	}
+	return fields
+}
+
+// jsonShape describes a decoded JSON value without its contents,
+// which may be personal, e.g. "number" or "array of object {id, name}".
+func jsonShape(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		if len(v) == 0 {
+			return "empty array"
+		}
+		return "array of " + jsonShape(v[0])
+	case map[string]interface{}:
+		const maxKeys = 8
+		var keys []string
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if len(keys) > maxKeys {
+			keys = append(keys[:maxKeys], "…")
+		}
+		return "object {" + strings.Join(keys, ", ") + "}"
+	}
+	return fmt.Sprintf("%T", v)
+}
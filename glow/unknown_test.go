@@ -0,0 +1,36 @@
+package glow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownKeys(t *testing.T) {
+	const resp = `{"rc": 0, "data": {
+		"babies": [
+			{"baby_id": 1, "Baby": {"first_name": "Ada"}, "Nappies": [{"id": 1}],
+				"BabyData": {"update": [{"id": 5, "key": "sleep", "note": "x"}, {"id": 6, "note": "y"}]}},
+			{"baby_id": 2, "Nappies": [],
+				"BabyFeedData": {"update": [{"id": 7, "FEED_TYPE": 1, "bottle_oz": 3}]}}
+		],
+		"insights": null,
+		"streak": {"days": 3, "best": 10}
+	}}`
+	got, err := unknownKeys([]byte(resp), reflect.TypeOf(PullResponse{}), knownPullKeys)
+	if err != nil {
+		t.Fatalf("unknownKeys: %v", err)
+	}
+	want := []unknownKey{
+		{"data.babies[].BabyData.update[].note", "string", 2},
+		{"data.babies[].BabyFeedData.update[].bottle_oz", "number", 1},
+		{"data.babies[].Nappies", "array of object {id}", 2},
+		{"data.streak", "object {best, days}", 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownKeys =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if _, err := unknownKeys([]byte(`{"data": `), reflect.TypeOf(PullResponse{}), nil); err == nil {
+		t.Errorf("unknownKeys of truncated JSON succeeded, want error")
+	}
+}
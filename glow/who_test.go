@@ -0,0 +1,49 @@
+package glow
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWHOPercentile(t *testing.T) {
+	boyWeight, boyLength, err := whoStandards("boy")
+	if err != nil {
+		t.Fatalf("whoStandards: %v", err)
+	}
+	girlWeight, _, err := whoStandards("girl")
+	if err != nil {
+		t.Fatalf("whoStandards: %v", err)
+	}
+	if _, _, err := whoStandards("puppy"); err == nil {
+		t.Errorf("whoStandards(puppy) succeeded, want error")
+	}
+
+	for _, test := range []struct {
+		desc string
+		std  []whoLMS
+		age  int
+		x    float64
+		want float64 // within 0.5
+	}{
+		{"median boy at birth", boyWeight, 0, 3.3464, 50},
+		{"median girl at birth", girlWeight, 0, 3.2322, 50},
+		{"small boy at birth", boyWeight, 0, 2.5, 2.9},
+		{"light boy at a year", boyWeight, 365, 7.8, 2.7},
+		{"median length at a year, interpolated", boyLength, 365, 75.7488 + 0.0025*(76.9186-75.7488), 50},
+		{"long boy at six months", boyLength, 183, 72, 97.5},
+	} {
+		got, ok := whoPercentile(test.std, test.age, test.x)
+		if !ok || math.Abs(got-test.want) > 0.5 {
+			t.Errorf("%s: whoPercentile = %.1f, %t; want %.1f, true", test.desc, got, ok, test.want)
+		}
+	}
+
+	for _, age := range []int{-1, 800} {
+		if p, ok := whoPercentile(boyWeight, age, 10); ok {
+			t.Errorf("whoPercentile at age %d days = %.1f, want not ok", age, p)
+		}
+	}
+	if p, ok := whoPercentile(nil, 10, 4); ok {
+		t.Errorf("whoPercentile without a standard = %.1f, want not ok", p)
+	}
+}
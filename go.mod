@@ -5,6 +5,8 @@ go 1.17
 require (
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/mattn/go-sqlite3 v1.14.10
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
+	golang.org/x/term v0.1.0
 )
 
-require golang.org/x/image v0.0.0-20211028202545-6944b10bf410 // indirect
+require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
@@ -1,37 +1,180 @@
+// Command glowbaby is the command line for the glow package.
+// It sets the options for each command from flags, the environment and a config file.
 package main
 
 import (
 	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"image/color"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dsymonds/glowbaby/glow"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	dbFlag    = flag.String("db", "baby.db", "`filename` of SQLite3 database file")
-	credsFlag = flag.String("creds", filepath.Join(os.Getenv("HOME"), ".glowbabyrc"), "`filename` containing Glow Baby credentials")
+	configFlag        = flag.String("config", defaultConfigPath(), "`filename` of optional JSON config file")
+	dbFlag            = flag.String("db", "baby.db", "`filename` of SQLite3 database file")
+	apiBaseFlag       = flag.String("api-base", "https://"+glow.Domain, "base `URL` of the Glow Baby API, to use a proxy or mirror")
+	proxyFlag         = flag.String("proxy", "", "`URL` of an HTTP or SOCKS5 proxy for API requests (e.g. socks5://localhost:1080); defaults to that given by $HTTPS_PROXY, if any")
+	credsFlag         = flag.String("creds", filepath.Join(os.Getenv("HOME"), ".glowbabyrc"), "`filename` containing Glow Baby credentials, or \"-\" to read them from standard input")
+	keyringFlag       = flag.Bool("keyring", false, "whether to keep credentials in the OS keyring rather than the -creds file, where available")
+	encryptTokenFlag  = flag.Bool("encrypt-token", false, "for login, encrypt the stored auth token with a passphrase (from $GLOWBABY_PASSPHRASE, or prompted for)")
+	insecureCredsFlag = flag.Bool("insecure-creds", false, "whether to allow a creds file that other users can read")
+	accountFlag       = flag.String("account", "", "`name` of the Glow Baby account to log in to, sync or plot, if there are several")
+	babyFlag          = flag.String("baby", "", "`ID` of the baby to plot; defaults to the first one. For plot and export, \"all\" does each baby in turn, with {babyid} or {name} in the destination filename replaced")
+	jsonFlag          = flag.Bool("json", false, "whether to emit the output of stats, gaps, insights, status, family, next-feed, regressions, sync-log and schema as JSON")
+	saveRawFlag       = flag.String("save-raw", "", "for sync, also save the raw server response to this `file`, with secrets removed")
+	fullFlag          = flag.Bool("full", false, "for sync, ignore the stored sync state and re-download everything")
+	onlyFlag          = flag.String("only", "", "for sync, a comma-separated `list` of the only kinds of event to store (e.g. \"sleep,feed\"); others are skipped until a -full sync")
+	implausibleFlag   = flag.String("implausible", "skip", "for sync, whether to \"skip\" or \"keep\" events with implausible start times")
+	tokenAgeFlag      = flag.Duration("token-age", 90*24*time.Hour, "for sync, warn if the last login was longer ago than this `duration`")
+	reportUnknownFlag = flag.Bool("report-unknown", false, "for sync, log any keys in the server's response that aren't decoded, to spot new data worth keeping")
+	fastSyncFlag      = flag.String("fast-sync", "", "for sync, the SQLite synchronous `mode` (\"normal\" or \"off\") to write with, for speed at the cost of durability; with \"off\", losing power mid-sync may corrupt the DB")
+	aggregateFlag     = flag.String("aggregate", "", "for export events, if \"day\", write one row of totals per day instead of one per event")
+	formatFlag        = flag.String("format", "csv", "the file `format`: for export, \"csv\", \"json\", or \"md\" for a Markdown table; for import, \"csv\" or \"json\"; for report, \"pdf\"")
+	emailFlag         = flag.Bool("email", false, "for report, email a daily digest to -email-to instead of writing a file, attaching the PDF report if -format is pdf")
+	emailToFlag       = flag.String("email-to", "", "comma-separated email `addresses` to send reports to")
+	emailFromFlag     = flag.String("email-from", "", "email `address` to send reports from")
+	smtpServerFlag    = flag.String("smtp-server", "", "`host:port` of the SMTP server for sending email")
+	smtpUserFlag      = flag.String("smtp-user", "", "`username` for the SMTP server, if it needs one")
+	smtpPasswordFlag  = flag.String("smtp-password", "", "`password` for the SMTP server; best set in the config file or $GLOWBABY_SMTP_PASSWORD")
+	byFlag            = flag.String("by", "day", "for stats, whether to break results down by calendar \"day\" or by \"week\" of life")
+	dayStartFlag      = clockFlag("day-start", 0, "the `time` of day, as HH:MM, at which days start for plots and per-day stats, so that overnight sleep can stay in one day")
+	nightFlag         = flag.String("night", "19:00-07:00", "the `window` of the day whose sleep counts as night sleep rather than naps, as HH:MM-HH:MM")
+	verboseFlag       = flag.Bool("v", false, "whether to log extra detail for debugging, such as how long plots take to render")
+	dryRunFlag        = flag.Bool("dry-run", false, "for maintenance commands, only report what would change")
+	yesFlag           = flag.Bool("yes", false, "for forget, delete without asking for confirmation")
+	modeFlag          = flag.String("mode", "0644", "permissions, in octal, for files written by plot, export, report and backup")
+	growthTolFlag     = flag.Int("growth-tolerance", 7, "for growth stats, plots and exports, pair weight and height readings at most this many `days` apart")
+	sexFlag           = flag.String("sex", "", "the baby's sex, \"boy\" or \"girl\", for the WHO weight and length percentiles in export growth; they are left out if unset")
+	nowFlag           = flag.String("now", "", "if set, the `time` to report as of, as RFC 3339 or YYYY-MM-DD (midnight), instead of the current time, for gaps, status, next-feed, metrics and report -email; later events are still included unless -to excludes them")
+	outputTZFlag      = flag.String("output-timezone", "", "for export, the time `zone` (e.g. \"Europe/London\") to write times and divide days in; defaults to the local time zone. Records keep unix times")
+	importTZFlag      = flag.String("import-tz", "", "for import, the time `zone` (e.g. \"Europe/London\") of times in the imported file; defaults to the local time zone")
+
+	limitFlag       = flag.Int("limit", 0, "if more than 0, for plots and stats, only use the most recent `N` events of each kind within the -from/-to window, for a quick preview")
+	fromFlag        = flag.String("from", "", "if set, only consider events from this `date` (YYYY-MM-DD)")
+	toFlag          = flag.String("to", "", "if set, only consider events up to this `date` (YYYY-MM-DD), inclusive")
+	paletteFlag     = flag.String("palette", "default", "colour `palette` for plots")
+	themeFlag       = flag.String("theme", "light", "plot `theme` (\"light\" or \"dark\")")
+	transparentFlag = flag.Bool("transparent", false, "whether to leave the plot background transparent")
+	dpiFlag         = flag.Float64("dpi", 72, "resolution of plots, in dots per inch")
+	lineWidthFlag   = flag.Float64("linewidth", 1, "width in `pixels` of the arcs of polar plots and the lines of line charts")
+	titleFlag       = flag.String("title", "", "if set, the `title` for plots, instead of one naming the baby")
+	minimalFlag     = flag.Bool("minimal", false, "whether to leave the centre of polar plots unmarked")
+	gridFlag        = flag.Bool("grid", false, "whether to draw rings on polar plots, labelled with the age at each")
+	zeroFlag        = flag.String("zero", "", "if set, centre polar plots on this `date` (YYYY-MM-DD) rather than the birthday")
+	unitsFlag       = flag.String("units", "metric", "`units` for volumes in plots (\"metric\" or \"imperial\")")
+	zeroDaysFlag    = flag.Bool("zero-days", false, "for bottle-volume, plot days without bottle feeds as zero rather than skipping them")
+	smoothFlag      = flag.Int("smooth", 0, "if more than 1, overlay a moving average over this many `days` on line charts")
+	longSleepFlag   = flag.Duration("long-sleep", 5*time.Hour, "sleeps of at least this `duration` are coloured as long in the sleep plot")
+	minArcFlag      = flag.Duration("min-arc", 0, "for the feed plot, draw feeds as lasting at least this `duration`, so short ones stay visible")
+	scaleFeedFlag   = flag.Bool("scale-feed", false, "for the feed plot, draw feed durations on a logarithmic scale, so short feeds stand out; this distorts their true proportions")
+	shortSleepFlag  = flag.Duration("short-sleep", 90*time.Minute, "sleeps shorter than this `duration` are coloured as short in the sleep plot")
 )
 
-const domain = "baby.glowing.com"
+// clockFlag defines a flag for a time of day, set as "HH:MM".
+func clockFlag(name string, value glow.ClockTime, usage string) *glow.ClockTime {
+	ct := value
+	flag.Var(&ct, name, usage)
+	return &ct
+}
+
+// customColors are the plot colours set in the config file, by element (see glow.ColorElements).
+var customColors map[string]color.NRGBA
+
+// referenceTime returns the time to treat as now: that given by -now, or else the current time.
+func referenceTime() (time.Time, error) {
+	if *nowFlag == "" {
+		return time.Now(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, *nowFlag); err == nil {
+		return t, nil
+	}
+	// TODO: record baby timezone from Glow and use that instead of time.Local.
+	if t, err := time.ParseInLocation("2006-01-02", *nowFlag, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("bad -now %q; want a time like 2024-03-01T18:00:00Z or a date like 2024-03-01", *nowFlag)
+}
 
 const usage = `
 usage: glowbaby [options] <command>
 
 Commands:
 	init			initialise the database file (specified by -db)
-	login			log in to Glow Baby (using credentials ~/.glowbabyrc)
-	sync			synchronise all data from remote
-	plot <type> <dst>	plot data to PNG (type is "sleep" or "feed")
+	login			log in to Glow Baby (using credentials ~/.glowbabyrc,
+				or prompting for them if that doesn't exist)
+	sync			synchronise all data from remote (see -full to
+				recover from an interrupted or suspect sync)
+	plot <type> <dst>	plot data to PNG (see plot types below)
+	stats <type>		print statistics (type is "feed", "sleep", "tummy",
+				"medicine", "pump", "growth" or "growth-velocity")
+	export <type> <dst>	export data as a table (see -format); type is "growth"
+				for weight, height and BMI by date, "events" (or daily
+				totals, with -aggregate day), or "records" for the
+				stored rows, which import can read
+	import <src>		add or update rows from a "records" export (see -format)
+	import huckleberry <src>
+				import sleeps, feeds and diapers from a Huckleberry CSV
+				export into the -baby baby (see -import-tz)
+	report <dst>		write a PDF of the stats and plots (needs -format pdf),
+				or with -email, email a daily digest instead
+	backup <dst>		write a consistent copy of the database to a new file
+	compact			shrink the database file and rebuild its indexes
+	dedupe			remove duplicated records (see -dry-run)
+	forget			delete all of the -baby baby's data, after asking (see -yes and -dry-run)
+	gaps			report days with no recorded events
+	insights		list Glow's own insights, as of the last sync
+	status			say whether each baby is asleep now, as of the last sync
+	family			list the parents and others related to each baby, as of the last sync
+	next-feed		estimate when the next feed is due
+	regressions		look for weeks where sleep fell well below what came before
+	metrics			print today's totals per baby in OpenMetrics format
+	sync-log		list recent syncs, with their timings and record counts
+	schema			print the DB schema and its version, for bug reports
+	preset <action>		manage named command lines: "save <name> <command>...",
+				"run <name> [<args>...]", "list" or "delete <name>"
+
+Plot types:
+	sleep			polar plot of sleep segments
+	feed			polar plot of feeds
+	combined		polar plot of sleep segments, with feeds marked over them
+	longest-sleep		line chart of the longest sleep each day
+	daily-sleep		line chart of the total sleep each day
+	sleep-overview		line chart of the total sleep each day of every baby, by age
+	feed-intervals		histogram of the time between feeds
+	feed-tod		histogram of feeds by the hour of day they start
+	tummy			polar plot of tummy time sessions
+	medicine		polar plot of medicine doses, labelled
+	wake-windows		line chart of the average wake window each day
+	bottle-volume		line chart of the total bottle volume each day
+	bmi			line chart of BMI, from paired weights and heights
+	key=<key>		polar plot of any kind of event by its DB key (e.g. key=temperature)
+
+Palettes (for -palette):
+	default			blue/green/red
+	cb-safe			blue/orange/purple (colourblind-friendly)
+
+Configuration:
+	Each option may also be set with an environment variable named after it
+	(e.g. $GLOWBABY_DB for -db, $GLOWBABY_DRY_RUN for -dry-run), or in the
+	JSON config file (e.g. {"db": "baby.db"}). An option given on the command
+	line takes precedence over the environment, which takes precedence over
+	the config file, which takes precedence over the built-in default.
+	The config file may also set plot colours by element, overriding the
+	palette and theme (e.g. {"colors": {"grid": "#cccccc", "long": "#1e90ff"}});
+	the elements are long, medium, short, feed, feed-midnight, line, smooth,
+	bar, background, text and grid.
 
 Options:
 `
@@ -42,6 +185,33 @@ func main() {
 		flag.PrintDefaults()
 	}
 	flag.Parse()
+	if err := applyConfig(flag.CommandLine); err != nil {
+		log.Fatalf("Loading config: %v", err)
+	}
+
+	// Presets are handled before the DB is opened, since they may choose it.
+	if flag.Arg(0) == "preset" {
+		args, err := preset(flag.CommandLine, flag.Args()[1:], os.Stdout)
+		if err != nil {
+			log.Fatalf("Preset: %v", err)
+		}
+		if args == nil {
+			return
+		}
+		// Make the preset's command line the one the rest of main sees.
+		flag.CommandLine.Parse(append([]string{"--"}, args...))
+	}
+
+	now, err := referenceTime()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *limitFlag < 0 {
+		log.Fatalf("-limit must not be negative")
+	}
+	if cmd := flag.Arg(0); *limitFlag > 0 && cmd != "plot" && cmd != "stats" {
+		log.Fatalf("-limit only works with plot and stats")
+	}
 
 	db, err := sql.Open("sqlite3", *dbFlag)
 	if err != nil {
@@ -54,319 +224,458 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
+	// schema reports on the DB as it is.
+	if cmd := flag.Arg(0); cmd != "init" && cmd != "schema" {
+		if err := glow.Migrate(context.Background(), db); err != nil {
+			log.Fatalf("Upgrading DB: %v", err)
+		}
+	}
+
 	switch cmd := flag.Arg(0); cmd {
 	default:
 		log.Fatalf("Unknown command %q", cmd)
 	case "init":
-		// TODO: refuse if the DB file already exists?
-		_, err := db.Exec(initDB)
-		if err != nil {
+		if err := glow.Init(context.Background(), db); err != nil {
 			log.Fatalf("Initialising DB: %v", err)
 		}
 		log.Printf("DB init OK")
 	case "login":
-		if err := login(context.Background(), db); err != nil {
+		if err := glow.Login(context.Background(), db, loginOptionsFromFlags()); err != nil {
 			log.Fatalf("Logging in: %v", err)
 		}
 		log.Printf("Logged in OK")
 	case "sync":
 		start := time.Now()
-		if err := sync(context.Background(), db); err != nil {
+		opts := syncOptionsFromFlags()
+		if err := glow.Sync(context.Background(), db, opts); err != nil {
 			log.Fatalf("Syncing data: %v", err)
 		}
-		log.Printf("Synced data OK in %v", time.Since(start).Truncate(100*time.Millisecond))
+		var mode string
+		if opts.Synchronous != "" {
+			// So the time can be compared with that of a normal sync.
+			mode = " with -fast-sync " + opts.Synchronous
+		}
+		log.Printf("Synced data OK in %v%s", time.Since(start).Truncate(100*time.Millisecond), mode)
 	case "plot":
 		if flag.NArg() != 3 {
 			flag.Usage()
 			os.Exit(1)
 		}
 		typ, dst := flag.Arg(1), flag.Arg(2)
-		var data []byte
-		switch typ {
-		default:
+		// Zero means the default in plot options, so check these here.
+		if *dpiFlag <= 0 {
+			log.Fatalf("-dpi must be positive")
+		}
+		if *lineWidthFlag <= 0 {
+			log.Fatalf("-linewidth must be positive")
+		}
+		if *shortSleepFlag <= 0 {
+			log.Fatalf("-short-sleep must be positive and no more than -long-sleep")
+		}
+		if err := plotOptionsFromFlags().Check(); err != nil {
+			log.Fatal(err)
+		}
+		mode, err := outputMode()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !contains(glow.PlotTypes, typ) && !strings.HasPrefix(typ, "key=") {
 			flag.Usage()
 			os.Exit(1)
-		case "sleep", "feed":
-			b, err := plot(context.Background(), db, typ)
+		}
+		if typ == "sleep-overview" && *babyFlag == "all" {
+			log.Fatalf("sleep-overview already shows every baby; drop -baby all")
+		}
+		dests, err := glow.BabyDests(context.Background(), db, selectionFromFlags(), dst)
+		if err != nil {
+			log.Fatalf("Plotting: %v", err)
+		}
+		// With -baby all, the plots are independent, so render them in parallel.
+		err = glow.RenderEach(context.Background(), len(dests), func(ctx context.Context, i int) error {
+			dst := dests[i].Dst
+			// Rendering can be slow, so don't find out afterwards that it was wasted.
+			if err := glow.CheckWritable(dst); err != nil {
+				return fmt.Errorf("can't write plot to %s: %w", dst, err)
+			}
+			opts := plotOptionsFromFlags()
+			opts.Baby = dests[i].Baby
+			data, err := glow.Plot(ctx, db, typ, opts)
 			if err != nil {
-				log.Fatalf("Plotting data: %v", err)
+				return fmt.Errorf("plotting data: %w", err)
 			}
-			data = b
+			if err := glow.WriteFile(dst, data, mode); err != nil {
+				return fmt.Errorf("writing plot to %s: %w", dst, err)
+			}
+			log.Printf("OK; wrote %q plot to %s (%d bytes)", typ, dst, len(data))
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Plotting: %v", err)
+		}
+	case "stats":
+		if flag.NArg() != 2 || !contains(glow.StatsTypes, flag.Arg(1)) {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := glow.Stats(context.Background(), db, flag.Arg(1), os.Stdout, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Computing stats: %v", err)
+		}
+	case "export":
+		if flag.NArg() != 3 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		typ, dst := flag.Arg(1), flag.Arg(2)
+		mode, err := outputMode()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !contains(glow.ExportTypes, typ) {
+			flag.Usage()
+			os.Exit(1)
+		}
+		dests, err := glow.BabyDests(context.Background(), db, selectionFromFlags(), dst)
+		if err != nil {
+			log.Fatalf("Exporting: %v", err)
+		}
+		for _, d := range dests {
+			opts := exportOptionsFromFlags()
+			opts.Baby = d.Baby
+			var buf bytes.Buffer
+			if err := glow.Export(context.Background(), db, typ, &buf, opts); err != nil {
+				log.Fatalf("Exporting: exporting data: %v", err)
+			}
+			if err := glow.WriteFile(d.Dst, buf.Bytes(), mode); err != nil {
+				log.Fatalf("Exporting: writing export to %s: %v", d.Dst, err)
+			}
+			log.Printf("OK; wrote %q export to %s (%d bytes)", typ, d.Dst, buf.Len())
+		}
+	case "import":
+		if flag.NArg() == 2 {
+			src := flag.Arg(1)
+			f, err := os.Open(src)
+			if err != nil {
+				log.Fatalf("Opening import file: %v", err)
+			}
+			added, updated, err := glow.ImportRecords(context.Background(), db, f, importOptionsFromFlags())
+			f.Close()
+			if err != nil {
+				log.Fatalf("Importing %s: %v", src, err)
+			}
+			log.Printf("OK; imported %s from %s (%d new, %d updated)", plural(added+updated, "record"), src, added, updated)
+			break
+		}
+		if flag.NArg() != 3 || flag.Arg(1) != "huckleberry" {
+			flag.Usage()
+			os.Exit(1)
+		}
+		src := flag.Arg(2)
+		f, err := os.Open(src)
+		if err != nil {
+			log.Fatalf("Opening import file: %v", err)
+		}
+		hc, err := glow.ImportHuckleberry(context.Background(), db, f, importOptionsFromFlags())
+		f.Close()
+		if err != nil {
+			log.Fatalf("Importing %s: %v", src, err)
+		}
+		log.Printf("OK; imported %s, %s and %s from %s (skipped %d rows)",
+			plural(hc.Sleeps, "sleep"), plural(hc.Feeds, "feed"), plural(hc.Diapers, "diaper"), src, hc.Skipped)
+	case "report":
+		if *emailFlag {
+			if flag.NArg() != 1 {
+				flag.Usage()
+				os.Exit(1)
+			}
+			if err := glow.EmailReport(context.Background(), db, now, emailOptionsFromFlags()); err != nil {
+				log.Fatalf("Emailing report: %v", err)
+			}
+			break
+		}
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		dst := flag.Arg(1)
+		mode, err := outputMode()
+		if err != nil {
+			log.Fatal(err)
+		}
+		data, err := glow.Report(context.Background(), db, now, reportOptionsFromFlags())
+		if err != nil {
+			log.Fatalf("Making report: %v", err)
+		}
+		if err := glow.WriteFile(dst, data, mode); err != nil {
+			log.Fatalf("Writing report to %s: %v", dst, err)
+		}
+		log.Printf("OK; wrote report to %s (%d bytes)", dst, len(data))
+	case "backup":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		dst := flag.Arg(1)
+		mode, err := outputMode()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := glow.Backup(context.Background(), db, dst, mode); err != nil {
+			log.Fatalf("Backing up DB: %v", err)
+		}
+		fi, err := os.Stat(dst)
+		if err != nil {
+			log.Fatalf("Checking backup: %v", err)
+		}
+		log.Printf("OK; backed up DB to %s (%d bytes)", dst, fi.Size())
+	case "compact":
+		before, err := os.Stat(*dbFlag)
+		if err != nil {
+			log.Fatalf("Checking DB: %v", err)
+		}
+		if err := glow.Compact(context.Background(), db); err != nil {
+			log.Fatalf("Compacting DB: %v", err)
+		}
+		after, err := os.Stat(*dbFlag)
+		if err != nil {
+			log.Fatalf("Checking DB: %v", err)
+		}
+		log.Printf("OK; compacted DB from %d to %d bytes", before.Size(), after.Size())
+	case "dedupe":
+		n, err := glow.Dedupe(context.Background(), db, *dryRunFlag)
+		if err != nil {
+			log.Fatalf("Removing duplicates: %v", err)
+		}
+		if *dryRunFlag {
+			log.Printf("Dry run; would have removed %d duplicate records", n)
+		} else {
+			log.Printf("OK; removed %d duplicate records", n)
+		}
+	case "forget":
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(1)
 		}
-		if err := ioutil.WriteFile(dst, data, 0644); err != nil {
-			log.Fatalf("Writing plot to %s: %v", dst, err)
+		id, err := strconv.ParseInt(*babyFlag, 10, 64)
+		if err != nil {
+			log.Fatalf("forget needs -baby set to the ID of the baby to delete")
+		}
+		var first, last string
+		err = db.QueryRow(`SELECT FirstName, LastName FROM Babies WHERE BabyID = ?`, id).Scan(&first, &last)
+		if err == sql.ErrNoRows {
+			log.Fatalf("No baby with ID %d", id)
+		} else if err != nil {
+			log.Fatalf("Loading baby info: %v", err)
+		}
+		if !*dryRunFlag && !*yesFlag && !glow.Confirm(fmt.Sprintf("Delete all data for %s %s (baby ID %d)?", first, last, id)) {
+			log.Fatalf("Not deleting anything")
+		}
+		counts, err := glow.Forget(context.Background(), db, id, *dryRunFlag)
+		if err != nil {
+			log.Fatalf("Forgetting baby: %v", err)
+		}
+		verb := "removed"
+		if *dryRunFlag {
+			verb = "would have removed"
+		}
+		for _, c := range counts {
+			log.Printf("%s %d rows from %s", verb, c.N, c.Table)
+		}
+		if *dryRunFlag {
+			log.Printf("Dry run; nothing was deleted")
+		} else {
+			log.Printf("OK; forgot %s %s (baby ID %d)", first, last, id)
+		}
+	case "gaps":
+		if err := glow.Gaps(context.Background(), db, os.Stdout, now, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Finding gaps: %v", err)
+		}
+	case "insights":
+		if err := glow.Insights(context.Background(), db, os.Stdout, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Listing insights: %v", err)
+		}
+	case "status":
+		if err := glow.Status(context.Background(), db, os.Stdout, now, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Reporting status: %v", err)
+		}
+	case "family":
+		if err := glow.Family(context.Background(), db, os.Stdout, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Listing family: %v", err)
+		}
+	case "next-feed":
+		if err := glow.NextFeed(context.Background(), db, os.Stdout, now, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Predicting next feed: %v", err)
+		}
+	case "regressions":
+		if err := glow.Regressions(context.Background(), db, os.Stdout, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Finding sleep regressions: %v", err)
+		}
+	case "metrics":
+		if err := glow.Metrics(context.Background(), db, os.Stdout, now, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Computing metrics: %v", err)
+		}
+	case "sync-log":
+		if err := glow.SyncLog(context.Background(), db, os.Stdout, queryOptionsFromFlags()); err != nil {
+			log.Fatalf("Listing sync history: %v", err)
+		}
+	case "schema":
+		// Opening a missing DB file would create it.
+		if _, err := os.Stat(*dbFlag); err != nil {
+			log.Fatalf("Checking DB: %v", err)
+		}
+		err := glow.Schema(context.Background(), db, os.Stdout, queryOptionsFromFlags())
+		if errors.Is(err, glow.ErrUninitialised) {
+			log.Fatalf("Printing DB schema: DB %s isn't initialised; run init first", *dbFlag)
+		} else if err != nil {
+			log.Fatalf("Printing DB schema: %v", err)
 		}
-		log.Printf("OK; wrote %q plot to %s (%d bytes)", typ, dst, len(data))
 	}
 }
 
-const initDB = `
-CREATE TABLE Auth (
-	Domain TEXT NOT NULL PRIMARY KEY,  -- always "baby.glowing.com"
-	Token TEXT NOT NULL
-) STRICT;
-
-CREATE TABLE Babies (
-	BabyID INTEGER NOT NULL PRIMARY KEY,
-
-	FirstName TEXT NOT NULL,
-	LastName TEXT NOT NULL,
-	Birthday TEXT NOT NULL,  -- YYYY-MM-DD
-
-	-- Sync status.
-	SyncTime INTEGER,
-	SyncToken TEXT
-) STRICT;
-
-CREATE TABLE BabyData (
-	ID INTEGER NOT NULL PRIMARY KEY,
-	BabyID INTEGER NOT NULL,
-
-	StartTimestamp INTEGER NOT NULL,
-	EndTimestamp INTEGER,
-
-	Key TEXT,
-
-	ValInt INTEGER,
-	ValFloat REAL,
-	ValStr TEXT
-) STRICT;
-
-CREATE TABLE BabyFeedData (
-	ID INTEGER NOT NULL PRIMARY KEY,
-	BabyID INTEGER NOT NULL,
-
-	StartTimestamp INTEGER NOT NULL,
-	EndTimestamp INTEGER,
-
-	FeedType INTEGER,
-
-	BreastUsed TEXT,
-	BreastLeft INTEGER,
-	BreastRight INTEGER,
-
-	BottleML REAL
-) STRICT;
-`
-
-func login(ctx context.Context, db *sql.DB) error {
-	// Load credentials.
-	var creds struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}
-	rawCreds, err := ioutil.ReadFile(*credsFlag)
-	if err != nil {
-		return fmt.Errorf("loading creds from %s: %w", *credsFlag, err)
-	}
-	if err := json.Unmarshal(rawCreds, &creds); err != nil {
-		return fmt.Errorf("parsing creds from %s: %w", *credsFlag, err)
-	}
-	// Re-serialise to tidy up, compact, and remove any extraneous keys.
-	rawCreds, err = json.Marshal(creds)
-	if err != nil {
-		return fmt.Errorf("re-marshaling creds: %w", err)
+func loginOptionsFromFlags() glow.LoginOptions {
+	return glow.LoginOptions{
+		Account:       *accountFlag,
+		APIBase:       *apiBaseFlag,
+		Proxy:         *proxyFlag,
+		CredsFile:     *credsFlag,
+		InsecureCreds: *insecureCredsFlag,
+		Keyring:       *keyringFlag,
+		EncryptToken:  *encryptTokenFlag,
 	}
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://"+domain+"/android/user/sign_in", bytes.NewReader(rawCreds))
-	if err != nil {
-		return fmt.Errorf("internal error: constructing HTTP request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("making HTTP login request: %w", err)
-	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("HTTP login request gave non-200 status %q", resp.Status)
-	}
-	var loginResp LoginResponse
-	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
-		return fmt.Errorf("decoding JSON login response: %w", err)
+func syncOptionsFromFlags() glow.SyncOptions {
+	return glow.SyncOptions{
+		Account:       *accountFlag,
+		APIBase:       *apiBaseFlag,
+		Proxy:         *proxyFlag,
+		Full:          *fullFlag,
+		Only:          *onlyFlag,
+		Implausible:   *implausibleFlag,
+		SaveRaw:       *saveRawFlag,
+		TokenAge:      *tokenAgeFlag,
+		Synchronous:   *fastSyncFlag,
+		ReportUnknown: *reportUnknownFlag,
 	}
+}
 
-	// Start transaction.
-	// Any failures after this point should roll back the transaction.
-	txCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	tx, err := db.BeginTx(txCtx, nil)
-	if err != nil {
-		return fmt.Errorf("starting DB transaction: %w", err)
+func selectionFromFlags() glow.Selection {
+	return glow.Selection{
+		Account:  *accountFlag,
+		Baby:     *babyFlag,
+		From:     *fromFlag,
+		To:       *toFlag,
+		DayStart: *dayStartFlag,
+		Limit:    *limitFlag,
 	}
+}
 
-	user := loginResp.Data.User
-	log.Printf("Logging in as %s %s ...", user.FirstName, user.LastName)
-	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO Auth(Domain, Token) VALUES (?, ?)`, domain, user.AuthToken)
-	if err != nil {
-		return fmt.Errorf("recording auth info in DB: %w", err)
+func plotOptionsFromFlags() glow.PlotOptions {
+	return glow.PlotOptions{
+		Selection:       selectionFromFlags(),
+		Title:           *titleFlag,
+		DPI:             *dpiFlag,
+		LineWidth:       *lineWidthFlag,
+		Theme:           *themeFlag,
+		Palette:         *paletteFlag,
+		Transparent:     *transparentFlag,
+		Grid:            *gridFlag,
+		Minimal:         *minimalFlag,
+		Verbose:         *verboseFlag,
+		Zero:            *zeroFlag,
+		ShortSleep:      *shortSleepFlag,
+		LongSleep:       *longSleepFlag,
+		MinArc:          *minArcFlag,
+		ScaleFeed:       *scaleFeedFlag,
+		Units:           *unitsFlag,
+		ZeroDays:        *zeroDaysFlag,
+		Smooth:          *smoothFlag,
+		GrowthTolerance: *growthTolFlag,
+		Colors:          customColors,
 	}
+}
 
-	for _, babyRec := range loginResp.Data.Babies {
-		baby := babyRec.Baby
-		log.Printf("Setting up sync info for baby %s %s (baby ID %d) ...", baby.FirstName, baby.LastName, baby.BabyID)
-
-		// Transform birthday format into ISO 8601.
-		t, err := time.Parse("2006/01/02", baby.Birthday)
-		if err != nil {
-			return fmt.Errorf("baby has malformed birthday %q: %w", baby.Birthday, err)
-		}
-		tStr := t.Format("2006-01-02")
-
-		// TODO: automatic conflict resolution?
-		_, err = tx.ExecContext(ctx, `INSERT INTO Babies(BabyID, FirstName, LastName, Birthday) VALUES (?, ?, ?, ?)`,
-			baby.BabyID, baby.FirstName, baby.LastName, tStr)
-		if err != nil {
-			return fmt.Errorf("recording baby sync info in DB: %w", err)
-		}
+func queryOptionsFromFlags() glow.QueryOptions {
+	return glow.QueryOptions{
+		Selection:       selectionFromFlags(),
+		JSON:            *jsonFlag,
+		By:              *byFlag,
+		Night:           *nightFlag,
+		GrowthTolerance: *growthTolFlag,
 	}
+}
 
-	// Finalise transaction.
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("committing DB transaction: %w", err)
+func exportOptionsFromFlags() glow.ExportOptions {
+	return glow.ExportOptions{
+		Selection:       selectionFromFlags(),
+		Format:          *formatFlag,
+		Aggregate:       *aggregateFlag,
+		OutputTimezone:  *outputTZFlag,
+		Night:           *nightFlag,
+		Sex:             *sexFlag,
+		GrowthTolerance: *growthTolFlag,
 	}
-
-	return nil
 }
 
-func sync(ctx context.Context, db *sql.DB) error {
-	// Load auth token.
-	var authToken string
-	row := db.QueryRowContext(ctx, `SELECT Token FROM Auth WHERE Domain = ?`, domain)
-	if err := row.Scan(&authToken); err == sql.ErrNoRows {
-		return fmt.Errorf("no auth token; have you logged in?")
-	} else if err != nil {
-		return fmt.Errorf("loading auth token from DB: %w", err)
+func importOptionsFromFlags() glow.ImportOptions {
+	return glow.ImportOptions{
+		Account:  *accountFlag,
+		Baby:     *babyFlag,
+		Format:   *formatFlag,
+		Timezone: *importTZFlag,
 	}
+}
 
-	// Find all babies to synchronise.
-	type babyReq struct {
-		BabyID    int64  `json:"baby_id"`
-		SyncToken string `json:"sync_token,omitempty"`
-
-		first, last string
-	}
-	var pullReq struct {
-		Data struct {
-			Babies []babyReq `json:"babies"`
-			User   struct {
-				// TODO: anything needed? seems not.
-			} `json:"user"`
-		} `json:"data"`
-	}
-	rows, err := db.QueryContext(ctx, `SELECT BabyID, FirstName, LastName, SyncToken FROM Babies`)
-	if err != nil {
-		return fmt.Errorf("determining list of babies to sync: %w", err)
-	}
-	for rows.Next() {
-		var br babyReq
-		var st sql.NullString
-		if err := rows.Scan(&br.BabyID, &br.first, &br.last, &st); err != nil {
-			return fmt.Errorf("parsing list of babies to sync: %w", err)
-		}
-		if st.Valid {
-			br.SyncToken = st.String
-		}
-		pullReq.Data.Babies = append(pullReq.Data.Babies, br)
-		log.Printf("Going to sync data for baby %s %s (baby ID %d)", br.first, br.last, br.BabyID)
-	}
-	if err := rows.Err(); err != nil {
-		return fmt.Errorf("querying list of babies to sync: %w", err)
+func reportOptionsFromFlags() glow.ReportOptions {
+	return glow.ReportOptions{
+		Format: *formatFlag,
+		Stats:  queryOptionsFromFlags(),
+		Plot:   plotOptionsFromFlags(),
 	}
+}
 
-	rawPullReq, err := json.Marshal(pullReq)
-	if err != nil {
-		return fmt.Errorf("internal error: marshaling request: %w", err)
+func emailOptionsFromFlags() glow.EmailOptions {
+	opts := glow.EmailOptions{
+		To:       *emailToFlag,
+		From:     *emailFromFlag,
+		Server:   *smtpServerFlag,
+		User:     *smtpUserFlag,
+		Password: *smtpPasswordFlag,
+		Account:  *accountFlag,
 	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://"+domain+"/android/user/pull", bytes.NewReader(rawPullReq))
-	if err != nil {
-		return fmt.Errorf("internal error: constructing HTTP request: %w", err)
+	if *formatFlag == "pdf" {
+		report := reportOptionsFromFlags()
+		opts.Report = &report
 	}
-	req.Header.Set("Content-Type", "application/json; charset=utf-8")
-	req.Header.Set("Authorization", authToken)
+	return opts
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("making HTTP pull request: %w", err)
-	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("HTTP pull request gave non-200 status %q", resp.Status)
+// outputMode returns the permissions set by -mode.
+func outputMode() (os.FileMode, error) {
+	m, err := strconv.ParseUint(*modeFlag, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, fmt.Errorf("bad -mode %q; want octal permissions such as 0644", *modeFlag)
 	}
-	var pullResp PullResponse
-	if err := json.NewDecoder(resp.Body).Decode(&pullResp); err != nil {
-		return fmt.Errorf("decoding JSON pull response: %w", err)
+	if m&0600 != 0600 {
+		// We'd be unable to read or overwrite our own output.
+		return 0, fmt.Errorf("bad -mode %q; the owner needs to be able to read and write", *modeFlag)
 	}
+	return os.FileMode(m), nil
+}
 
-	// Start big transaction.
-	// Any failures after this point should roll back the transaction.
-	txCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	tx, err := db.BeginTx(txCtx, nil)
-	if err != nil {
-		return fmt.Errorf("starting DB transaction: %w", err)
-	}
-
-	// Update sync token and time.
-	for _, baby := range pullResp.Data.Babies {
-		_, err = tx.ExecContext(ctx, `UPDATE Babies SET SyncTime = ?, SyncToken = ? WHERE BabyID = ?`,
-			baby.SyncTime, baby.SyncToken, baby.BabyID)
-		if err != nil {
-			return fmt.Errorf("updating baby sync status in DB: %w", err)
-		}
-
-		for _, bd := range baby.BabyData.Remove {
-			_, err := tx.ExecContext(ctx, `DELETE FROM BabyData WHERE ID = ?`, bd.ID)
-			if err != nil {
-				return fmt.Errorf("deleting baby data from DB: %w", err)
-			}
-		}
-		if n := len(baby.BabyData.Remove); n > 0 {
-			log.Printf("Removed %d old baby data events", n)
-		}
-		for _, bd := range baby.BabyData.Update {
-			_, err := tx.ExecContext(ctx,
-				`INSERT OR REPLACE INTO BabyData(ID, BabyID, StartTimestamp, EndTimestamp, Key, ValInt, ValFloat, ValStr)
-				VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
-				bd.ID, bd.BabyID, bd.StartTimestamp, sqlNullInt64(bd.EndTimestamp), bd.Key, bd.ValInt, bd.ValFloat, bd.ValStr)
-			if err != nil {
-				return fmt.Errorf("applying baby data update in DB: %w", err)
-			}
-		}
-		log.Printf("Applied %d baby data updates", len(baby.BabyData.Update))
-
-		for _, bd := range baby.BabyFeedData.Remove {
-			_, err := tx.ExecContext(ctx, `DELETE FROM BabyFeedData WHERE ID = ?`, bd.ID)
-			if err != nil {
-				return fmt.Errorf("deleting baby data from DB: %w", err)
-			}
-		}
-		if n := len(baby.BabyFeedData.Remove); n > 0 {
-			log.Printf("Removed %d old baby feed data events", n)
+// contains reports whether list has s.
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
 		}
-		for _, bfd := range baby.BabyFeedData.Update {
-			_, err = tx.ExecContext(ctx,
-				`INSERT OR REPLACE INTO BabyFeedData(ID, BabyID, StartTimestamp, FeedType, BreastUsed, BreastLeft, BreastRight, BottleML)
-				VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
-				bfd.ID, bfd.BabyID, bfd.StartTimestamp, bfd.FeedType, bfd.BreastUsed, bfd.BreastLeft, bfd.BreastRight, bfd.BottleML)
-			if err != nil {
-				return fmt.Errorf("applying baby feed data update in DB: %w", err)
-			}
-		}
-		log.Printf("Applied %d baby feed data updates", len(baby.BabyFeedData.Update))
 	}
-
-	// Finalise transaction.
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("committing DB transaction: %w", err)
-	}
-
-	return nil
+	return false
 }
 
-func sqlNullInt64(x *int64) (ret sql.NullInt64) {
-	if x != nil {
-		ret.Int64, ret.Valid = *x, true
+// plural returns n and noun, with an "s" unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
 	}
-	return
+	return fmt.Sprintf("%d %ss", n, noun)
 }
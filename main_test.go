@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dsymonds/glowbaby/glow"
+)
+
+func TestOutputMode(t *testing.T) {
+	defer func(m string) { *modeFlag = m }(*modeFlag)
+	for _, test := range []struct {
+		flag string
+		want os.FileMode
+		ok   bool
+	}{
+		{"0644", 0644, true},
+		{"600", 0600, true},
+		{"0755", 0755, true},
+		{"0400", 0, false}, // owner can't write
+		{"0888", 0, false},
+		{"01644", 0, false},
+		{"rw-r--r--", 0, false},
+		{"", 0, false},
+	} {
+		*modeFlag = test.flag
+		got, err := outputMode()
+		if ok := err == nil; ok != test.ok || got != test.want {
+			t.Errorf("outputMode with -mode %q = %v, %v; want %v, ok=%t", test.flag, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestReferenceTime(t *testing.T) {
+	defer func(now string) { *nowFlag = now }(*nowFlag)
+	tests := []struct {
+		flag string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-03-01T18:30:00Z", time.Date(2024, time.March, 1, 18, 30, 0, 0, time.UTC), true},
+		{"2024-03-01", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local), true},
+		{"2024-03-01 18:30", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for _, test := range tests {
+		*nowFlag = test.flag
+		got, err := referenceTime()
+		if ok := err == nil; ok != test.ok || !got.Equal(test.want) {
+			t.Errorf("referenceTime with -now %q = %v, %v; want %v, ok=%t", test.flag, got, err, test.want, test.ok)
+		}
+	}
+
+	*nowFlag = ""
+	before := time.Now()
+	if got, err := referenceTime(); err != nil || got.Before(before) || got.After(time.Now()) {
+		t.Errorf("referenceTime without -now = %v, %v; want the current time", got, err)
+	}
+}
+
+// TestColorElementsUsage checks that the usage text lists exactly the elements in glow.ColorElements.
+func TestColorElementsUsage(t *testing.T) {
+	section := usage[strings.Index(usage, "the elements are"):]
+	section = section[:strings.Index(section, ".")]
+	listed := regexp.MustCompile(`[a-z]+(-[a-z]+)*`).FindAllString(strings.TrimPrefix(section, "the elements are"), -1)
+	seen := make(map[string]bool)
+	for _, name := range listed {
+		if name == "and" {
+			continue
+		}
+		seen[name] = true
+		if _, ok := glow.ColorElements[name]; !ok {
+			t.Errorf("usage lists colour element %q, which isn't in glow.ColorElements", name)
+		}
+	}
+	for name := range glow.ColorElements {
+		if !seen[name] {
+			t.Errorf("usage doesn't list colour element %q", name)
+		}
+	}
+}
+
+// TestPlotTypesUsage checks that the usage text lists exactly glow.PlotTypes, and key= ones.
+func TestPlotTypesUsage(t *testing.T) {
+	var listed []string
+	section := usage[strings.Index(usage, "Plot types:"):]
+	for _, line := range strings.Split(section, "\n")[1:] {
+		if !strings.HasPrefix(line, "\t") {
+			break
+		}
+		if typ := strings.Fields(line)[0]; typ != "key=<key>" {
+			listed = append(listed, typ)
+		}
+	}
+	if !reflect.DeepEqual(listed, glow.PlotTypes) {
+		t.Errorf("usage lists plot types %q, want %q", listed, glow.PlotTypes)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dsymonds/glowbaby/glow"
+)
+
+// Presets are named command lines, such as
+//
+//	glowbaby preset save weekly-sleep plot sleep -from 2024-03-01 -grid
+//	glowbaby preset run weekly-sleep out.png
+//
+// They are kept in presets.json, next to the config file, as a JSON object
+// mapping each name to its arguments. Running a preset applies its options
+// over the environment and config file, but not over options given on the
+// command line, and appends any extra arguments to its own.
+
+// presetsPath returns the file presets are kept in, given the -config flag's value.
+func presetsPath(configPath string) (string, error) {
+	if configPath == "" {
+		return "", errors.New("no config directory for presets; set -config")
+	}
+	return filepath.Join(filepath.Dir(configPath), "presets.json"), nil
+}
+
+func loadPresets(path string) (map[string][]string, error) {
+	presets := make(map[string][]string)
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return presets, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("loading presets: %w", err)
+	}
+	if err := json.Unmarshal(raw, &presets); err != nil {
+		return nil, fmt.Errorf("parsing presets from %s: %w", path, err)
+	}
+	return presets, nil
+}
+
+func savePresets(path string, presets map[string][]string) error {
+	raw, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling presets: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	if err := glow.WriteFile(path, append(raw, '\n'), 0644); err != nil {
+		return fmt.Errorf("saving presets: %w", err)
+	}
+	return nil
+}
+
+// presetOption is an option given in a preset.
+type presetOption struct {
+	name, value string
+}
+
+// presetValue records the values given for one of fs's flags,
+// without touching the flag itself.
+type presetValue struct {
+	name    string
+	isBool  bool
+	options *[]presetOption
+}
+
+func (pv presetValue) String() string   { return "" }
+func (pv presetValue) IsBoolFlag() bool { return pv.isBool }
+func (pv presetValue) Set(v string) error {
+	*pv.options = append(*pv.options, presetOption{pv.name, v})
+	return nil
+}
+
+// splitPresetArgs separates a preset's options, which may be mixed in
+// with its other arguments, from those arguments, checking them against fs.
+func splitPresetArgs(fs *flag.FlagSet, args []string) (opts []presetOption, rest []string, err error) {
+	scratch := flag.NewFlagSet("preset", flag.ContinueOnError)
+	scratch.SetOutput(ioutil.Discard)
+	fs.VisitAll(func(f *flag.Flag) {
+		bf, isBool := f.Value.(interface{ IsBoolFlag() bool })
+		scratch.Var(presetValue{f.Name, isBool && bf.IsBoolFlag(), &opts}, f.Name, "")
+	})
+	for {
+		if err := scratch.Parse(args); err != nil {
+			return nil, nil, err
+		}
+		args = scratch.Args()
+		if len(args) == 0 {
+			return opts, rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// preset carries out the preset command with the given arguments
+// (those after "preset"), using fs's -config flag to find the presets.
+// For "run", it applies the preset's options to fs, and returns the
+// command line to run in place of the preset command; otherwise it returns nil.
+func preset(fs *flag.FlagSet, args []string, w io.Writer) ([]string, error) {
+	path, err := presetsPath(fs.Lookup("config").Value.String())
+	if err != nil {
+		return nil, err
+	}
+	presets, err := loadPresets(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New(`missing action; want "save", "run", "list" or "delete"`)
+	}
+	switch action := args[0]; action {
+	default:
+		return nil, fmt.Errorf(`unknown action %q; want "save", "run", "list" or "delete"`, action)
+	case "list":
+		var names []string
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s\t%s\n", name, quoteArgs(presets[name]))
+		}
+		return nil, nil
+	case "save":
+		if len(args) < 3 {
+			return nil, errors.New("usage: preset save <name> <command> [<args and options>...]")
+		}
+		name, cmd := args[1], args[2:]
+		_, rest, err := splitPresetArgs(fs, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("bad preset: %w", err)
+		}
+		if len(rest) == 0 || rest[0] == "preset" {
+			return nil, errors.New("a preset must run a command, other than preset")
+		}
+		presets[name] = cmd
+		return nil, savePresets(path, presets)
+	case "delete":
+		if len(args) != 2 {
+			return nil, errors.New("usage: preset delete <name>")
+		}
+		if _, ok := presets[args[1]]; !ok {
+			return nil, fmt.Errorf("no preset named %q", args[1])
+		}
+		delete(presets, args[1])
+		return nil, savePresets(path, presets)
+	case "run":
+		if len(args) < 2 {
+			return nil, errors.New("usage: preset run <name> [<args>...]")
+		}
+		cmd, ok := presets[args[1]]
+		if !ok {
+			return nil, fmt.Errorf("no preset named %q", args[1])
+		}
+		opts, rest, err := splitPresetArgs(fs, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("bad preset %q: %w", args[1], err)
+		}
+		explicit := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		for _, opt := range opts {
+			if explicit[opt.name] {
+				continue
+			}
+			if err := fs.Set(opt.name, opt.value); err != nil {
+				return nil, fmt.Errorf("bad value %q for -%s in preset %q: %w", opt.value, opt.name, args[1], err)
+			}
+		}
+		return append(rest, args[2:]...), nil
+	}
+}
+
+// quoteArgs formats a command line for display, quoting arguments where needed.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "glowbaby", "config.json")
+
+	fs, _, _, _ := newTestFlagSet(configPath)
+	fs.Bool("grid", false, "")
+	if _, err := preset(fs, []string{"save", "dark-sleep", "plot", "sleep", "-theme", "dark", "-grid", "-palette=cb-safe"}, nil); err != nil {
+		t.Fatalf("preset save: %v", err)
+	}
+	if _, err := preset(fs, []string{"save", "bad", "plot", "-nonsense"}, nil); err == nil {
+		t.Errorf("preset save with an unknown option succeeded, want error")
+	}
+	if _, err := preset(fs, []string{"save", "loop", "preset", "run", "dark-sleep"}, nil); err == nil {
+		t.Errorf("preset save of a preset command succeeded, want error")
+	}
+
+	var buf strings.Builder
+	if _, err := preset(fs, []string{"list"}, &buf); err != nil {
+		t.Fatalf("preset list: %v", err)
+	}
+	if want := "dark-sleep\tplot sleep -theme dark -grid -palette=cb-safe\n"; buf.String() != want {
+		t.Errorf("preset list wrote %q, want %q", buf.String(), want)
+	}
+
+	// Options on the command line win over the preset's.
+	fs, _, theme, palette := newTestFlagSet(configPath)
+	grid := fs.Bool("grid", false, "")
+	if err := fs.Parse([]string{"-palette", "default", "preset", "run", "dark-sleep", "out.png"}); err != nil {
+		t.Fatal(err)
+	}
+	args, err := preset(fs, fs.Args()[1:], nil)
+	if err != nil {
+		t.Fatalf("preset run: %v", err)
+	}
+	if want := []string{"plot", "sleep", "out.png"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("preset run = %q, want %q", args, want)
+	}
+	if *theme != "dark" || !*grid || *palette != "default" {
+		t.Errorf("after preset run, -theme %q -grid=%t -palette %q; want dark, true, default", *theme, *grid, *palette)
+	}
+
+	if _, err := preset(fs, []string{"delete", "dark-sleep"}, nil); err != nil {
+		t.Fatalf("preset delete: %v", err)
+	}
+	if _, err := preset(fs, []string{"run", "dark-sleep"}, nil); err == nil {
+		t.Errorf("preset run after delete succeeded, want error")
+	}
+}